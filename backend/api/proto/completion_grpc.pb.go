@@ -19,7 +19,10 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	CompletionService_GetCompletion_FullMethodName = "/completion.CompletionService/GetCompletion"
+	CompletionService_GetCompletion_FullMethodName     = "/completion.CompletionService/GetCompletion"
+	CompletionService_StreamCompletion_FullMethodName  = "/completion.CompletionService/StreamCompletion"
+	CompletionService_EmergencyStop_FullMethodName     = "/completion.CompletionService/EmergencyStop"
+	CompletionService_SubscribeCommands_FullMethodName = "/completion.CompletionService/SubscribeCommands"
 )
 
 // CompletionServiceClient is the client API for CompletionService service.
@@ -30,6 +33,12 @@ const (
 type CompletionServiceClient interface {
 	// GetCompletion 处理AI生成请求
 	GetCompletion(ctx context.Context, in *CompletionRequest, opts ...grpc.CallOption) (*CompletionResponse, error)
+	// StreamCompletion 流式返回content增量和逐个完成的function，最后返回done事件
+	StreamCompletion(ctx context.Context, in *CompletionRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CompletionStreamEvent], error)
+	// EmergencyStop 停止指定机器人，需要在metadata中携带 authorization: Bearer <token>
+	EmergencyStop(ctx context.Context, in *EmergencyStopRequest, opts ...grpc.CallOption) (*CompletionResponse, error)
+	// SubscribeCommands 机器人订阅下发的指令，stop指令总是优先送达；需要在metadata中携带 authorization: Bearer <设备令牌>
+	SubscribeCommands(ctx context.Context, in *SubscribeCommandsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DeviceCommand], error)
 }
 
 type completionServiceClient struct {
@@ -50,6 +59,54 @@ func (c *completionServiceClient) GetCompletion(ctx context.Context, in *Complet
 	return out, nil
 }
 
+func (c *completionServiceClient) StreamCompletion(ctx context.Context, in *CompletionRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CompletionStreamEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CompletionService_ServiceDesc.Streams[0], CompletionService_StreamCompletion_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CompletionRequest, CompletionStreamEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CompletionService_StreamCompletionClient = grpc.ServerStreamingClient[CompletionStreamEvent]
+
+func (c *completionServiceClient) EmergencyStop(ctx context.Context, in *EmergencyStopRequest, opts ...grpc.CallOption) (*CompletionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CompletionResponse)
+	err := c.cc.Invoke(ctx, CompletionService_EmergencyStop_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *completionServiceClient) SubscribeCommands(ctx context.Context, in *SubscribeCommandsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DeviceCommand], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CompletionService_ServiceDesc.Streams[1], CompletionService_SubscribeCommands_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeCommandsRequest, DeviceCommand]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CompletionService_SubscribeCommandsClient = grpc.ServerStreamingClient[DeviceCommand]
+
 // CompletionServiceServer is the server API for CompletionService service.
 // All implementations must embed UnimplementedCompletionServiceServer
 // for forward compatibility.
@@ -58,6 +115,12 @@ func (c *completionServiceClient) GetCompletion(ctx context.Context, in *Complet
 type CompletionServiceServer interface {
 	// GetCompletion 处理AI生成请求
 	GetCompletion(context.Context, *CompletionRequest) (*CompletionResponse, error)
+	// StreamCompletion 流式返回content增量和逐个完成的function，最后返回done事件
+	StreamCompletion(*CompletionRequest, grpc.ServerStreamingServer[CompletionStreamEvent]) error
+	// EmergencyStop 停止指定机器人，需要在metadata中携带 authorization: Bearer <token>
+	EmergencyStop(context.Context, *EmergencyStopRequest) (*CompletionResponse, error)
+	// SubscribeCommands 机器人订阅下发的指令，stop指令总是优先送达；需要在metadata中携带 authorization: Bearer <设备令牌>
+	SubscribeCommands(*SubscribeCommandsRequest, grpc.ServerStreamingServer[DeviceCommand]) error
 	mustEmbedUnimplementedCompletionServiceServer()
 }
 
@@ -71,6 +134,15 @@ type UnimplementedCompletionServiceServer struct{}
 func (UnimplementedCompletionServiceServer) GetCompletion(context.Context, *CompletionRequest) (*CompletionResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetCompletion not implemented")
 }
+func (UnimplementedCompletionServiceServer) StreamCompletion(*CompletionRequest, grpc.ServerStreamingServer[CompletionStreamEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamCompletion not implemented")
+}
+func (UnimplementedCompletionServiceServer) EmergencyStop(context.Context, *EmergencyStopRequest) (*CompletionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EmergencyStop not implemented")
+}
+func (UnimplementedCompletionServiceServer) SubscribeCommands(*SubscribeCommandsRequest, grpc.ServerStreamingServer[DeviceCommand]) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeCommands not implemented")
+}
 func (UnimplementedCompletionServiceServer) mustEmbedUnimplementedCompletionServiceServer() {}
 func (UnimplementedCompletionServiceServer) testEmbeddedByValue()                           {}
 
@@ -110,6 +182,46 @@ func _CompletionService_GetCompletion_Handler(srv interface{}, ctx context.Conte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CompletionService_StreamCompletion_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CompletionRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CompletionServiceServer).StreamCompletion(m, &grpc.GenericServerStream[CompletionRequest, CompletionStreamEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CompletionService_StreamCompletionServer = grpc.ServerStreamingServer[CompletionStreamEvent]
+
+func _CompletionService_EmergencyStop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmergencyStopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CompletionServiceServer).EmergencyStop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CompletionService_EmergencyStop_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CompletionServiceServer).EmergencyStop(ctx, req.(*EmergencyStopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CompletionService_SubscribeCommands_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeCommandsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CompletionServiceServer).SubscribeCommands(m, &grpc.GenericServerStream[SubscribeCommandsRequest, DeviceCommand]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CompletionService_SubscribeCommandsServer = grpc.ServerStreamingServer[DeviceCommand]
+
 // CompletionService_ServiceDesc is the grpc.ServiceDesc for CompletionService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -121,7 +233,22 @@ var CompletionService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetCompletion",
 			Handler:    _CompletionService_GetCompletion_Handler,
 		},
+		{
+			MethodName: "EmergencyStop",
+			Handler:    _CompletionService_EmergencyStop_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamCompletion",
+			Handler:       _CompletionService_StreamCompletion_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SubscribeCommands",
+			Handler:       _CompletionService_SubscribeCommands_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "api/proto/completion.proto",
 }
@@ -0,0 +1,94 @@
+// answercheck 使用回答样本集检查 dify.ExtractAnswerJSON 的修复效果。
+// 样本集每行一个JSON：{"name", "answer", "content", "functions", "expect_error"}，
+// 线上出现的 invalid JSON format in answer 可直接追加到样本集中回归。
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ai-generation/pkg/dify"
+)
+
+type sample struct {
+	Name        string  `json:"name"`
+	Answer      string  `json:"answer"`
+	Content     *string `json:"content"`
+	Functions   *int    `json:"functions"`
+	ExpectError bool    `json:"expect_error"`
+}
+
+func main() {
+	path := "testdata/answer_corpus.jsonl"
+	if len(os.Args) > 1 {
+		path = os.Args[1]
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open corpus: %v\n", err)
+		os.Exit(2)
+	}
+	defer file.Close()
+
+	failed, total := 0, 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var s sample
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid sample line: %v\n", err)
+			os.Exit(2)
+		}
+		total++
+		if problem := check(s); problem != "" {
+			failed++
+			fmt.Printf("❌ %s: %s\n", s.Name, problem)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "read corpus: %v\n", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("%d/%d samples passed\n", total-failed, total)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func check(s sample) string {
+	result, err := dify.ExtractAnswerJSON(s.Answer)
+	if s.ExpectError {
+		if err == nil {
+			return fmt.Sprintf("expected error, got %s", result.JSON)
+		}
+		fmt.Printf("✅ %s: %v\n", s.Name, err)
+		return ""
+	}
+	if err != nil {
+		return err.Error()
+	}
+
+	var answer struct {
+		Content   string        `json:"content"`
+		Functions []interface{} `json:"functions"`
+	}
+	if err := json.Unmarshal([]byte(result.JSON), &answer); err != nil {
+		return fmt.Sprintf("repaired JSON does not decode: %v: %s", err, result.JSON)
+	}
+	if s.Content != nil && answer.Content != *s.Content {
+		return fmt.Sprintf("content = %q, want %q", answer.Content, *s.Content)
+	}
+	if s.Functions != nil && len(answer.Functions) != *s.Functions {
+		return fmt.Sprintf("functions = %d, want %d: %s", len(answer.Functions), *s.Functions, result.JSON)
+	}
+	fmt.Printf("✅ %s: %v\n", s.Name, result.Repairs)
+	return ""
+}
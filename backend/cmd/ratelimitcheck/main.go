@@ -0,0 +1,252 @@
+// ratelimitcheck 回归令牌桶和滑动窗口限流的边界，不需要启动服务。
+// 样本集每行一个JSON：{"name", "algorithm", "limit", "window", "burst", "policies", "requests", "concurrent", "allowed"}。
+// requests 按时间顺序给出同一个key的请求：at_ms 为相对第一个请求的毫秒数，allowed 为期望结果，
+// 给出 remaining、retry_after_ms 时还要求剩余次数和重试时间相同，在进程内限流器上用虚拟时钟执行；
+// concurrent 大于0时改为同时发出这么多个请求，要求恰好 allowed 个通过，默认使用内存存储，-redis 指定时在Redis脚本上执行。
+// 给出 policies（策略文件格式的数组，或 "default" 表示以样本的额度使用默认策略）时按策略检查 requests，
+// 请求的 user、ip 为请求的用户和客户端IP，policy 为期望的拒绝策略或剩余额度最少的策略。
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ai-generation/internal/service"
+	"github.com/ai-generation/internal/types"
+	"github.com/ai-generation/pkg/redis"
+)
+
+type request struct {
+	User         string `json:"user"`
+	IP           string `json:"ip"`
+	Policy       string `json:"policy"`
+	AtMs         int64  `json:"at_ms"`
+	Allowed      bool   `json:"allowed"`
+	Remaining    *int   `json:"remaining"`
+	RetryAfterMs *int64 `json:"retry_after_ms"`
+}
+
+type sample struct {
+	Name       string          `json:"name"`
+	Algorithm  string          `json:"algorithm"`
+	Limit      int             `json:"limit"`
+	Window     string          `json:"window"`
+	Burst      int             `json:"burst"`
+	Policies   json.RawMessage `json:"policies"`
+	Requests   []request       `json:"requests"`
+	Concurrent int             `json:"concurrent"`
+	Allowed    int             `json:"allowed"`
+}
+
+func main() {
+	redisAddr := flag.String("redis", "", "run concurrent and policy samples against this Redis address instead of in-process storage")
+	flag.Parse()
+
+	path := "testdata/rate_limit_corpus.jsonl"
+	if flag.NArg() > 0 {
+		path = flag.Arg(0)
+	}
+	storageKind, redisClient := service.StorageMemory, (*redis.Client)(nil)
+	if *redisAddr != "" {
+		storageKind = service.StorageRedis
+		redisClient = redis.NewClient(&redis.Config{Addr: *redisAddr})
+	}
+	storage, err := service.NewStorage(storageKind, redisClient, 1000, time.Hour)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "configure storage: %v\n", err)
+		os.Exit(2)
+	}
+	cacheService := service.NewCacheService(storage)
+
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open corpus: %v\n", err)
+		os.Exit(2)
+	}
+	defer file.Close()
+
+	failed, total := 0, 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var s sample
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid sample line: %v\n", err)
+			os.Exit(2)
+		}
+		total++
+		var summary, problem string
+		switch {
+		case s.Concurrent > 0:
+			summary, problem = checkConcurrent(cacheService, s)
+		case len(s.Policies) > 0:
+			summary, problem = checkPolicies(storageKind, redisClient, s)
+		default:
+			summary, problem = checkSequence(s)
+		}
+		if problem != "" {
+			failed++
+			fmt.Printf("❌ %s: %s\n", s.Name, problem)
+		} else {
+			fmt.Printf("✅ %s: %s\n", s.Name, summary)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "read corpus: %v\n", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("%d/%d samples passed\n", total-failed, total)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// rule 按策略文件相同的格式解析样本的限流规则
+func rule(s sample) (service.RateLimit, error) {
+	window, err := time.ParseDuration(s.Window)
+	if err != nil {
+		return service.RateLimit{}, fmt.Errorf("invalid window %q: %v", s.Window, err)
+	}
+	return service.RateLimit{Algorithm: s.Algorithm, Limit: s.Limit, Window: window, Burst: s.Burst}, nil
+}
+
+// checkSequence 用虚拟时钟按顺序执行请求，逐个比较结果
+func checkSequence(s sample) (string, string) {
+	limit, err := rule(s)
+	if err != nil {
+		return "", err.Error()
+	}
+	offsets := make([]time.Duration, len(s.Requests))
+	for i, r := range s.Requests {
+		offsets[i] = time.Duration(r.AtMs) * time.Millisecond
+	}
+	results, err := service.SimulateRateLimit(limit, offsets)
+	if err != nil {
+		return "", err.Error()
+	}
+	allowed := 0
+	for i, r := range s.Requests {
+		got := results[i]
+		if got.Allowed {
+			allowed++
+		}
+		if got.Allowed != r.Allowed {
+			return "", fmt.Sprintf("request #%d at %dms allowed = %v, want %v", i, r.AtMs, got.Allowed, r.Allowed)
+		}
+		if r.Remaining != nil && got.Remaining != *r.Remaining {
+			return "", fmt.Sprintf("request #%d at %dms remaining = %d, want %d", i, r.AtMs, got.Remaining, *r.Remaining)
+		}
+		if r.RetryAfterMs != nil && got.RetryAfter.Milliseconds() != *r.RetryAfterMs {
+			return "", fmt.Sprintf("request #%d at %dms retry after = %dms, want %dms", i, r.AtMs, got.RetryAfter.Milliseconds(), *r.RetryAfterMs)
+		}
+	}
+	return fmt.Sprintf("%d/%d requests allowed", allowed, len(s.Requests)), ""
+}
+
+// checkPolicies 在新的存储上按顺序执行请求，检查各请求适用的策略。请求之间不等待，样本应使用足够长的window
+func checkPolicies(storageKind string, redisClient *redis.Client, s sample) (string, string) {
+	var policies []service.RateLimitPolicy
+	if bytes.Equal(bytes.TrimSpace(s.Policies), []byte(`"default"`)) {
+		limit, err := rule(s)
+		if err != nil {
+			return "", err.Error()
+		}
+		policies = service.DefaultRateLimitPolicies(limit)
+	} else {
+		var err error
+		if policies, err = service.ParseRateLimitPolicies(s.Policies); err != nil {
+			return "", err.Error()
+		}
+	}
+	// 策略名作为计数键的前缀，加上本次运行的标识，避免Redis中上一次运行的计数
+	run := fmt.Sprintf(":%s:%d", s.Name, time.Now().UnixNano())
+	for i := range policies {
+		if policies[i].Name == "" {
+			policies[i].Name = fmt.Sprintf("%s_%d", policies[i].Key, i)
+		}
+		policies[i].Name += run
+	}
+	storage, err := service.NewStorage(storageKind, redisClient, 1000, time.Hour)
+	if err != nil {
+		return "", err.Error()
+	}
+	limiter, err := service.NewRateLimiter(service.NewCacheService(storage), policies)
+	if err != nil {
+		return "", err.Error()
+	}
+	allowed := 0
+	for i, r := range s.Requests {
+		status, err := limiter.Check(context.Background(), &types.CompletionRequest{User: r.User, ClientIP: r.IP})
+		if err != nil {
+			return "", err.Error()
+		}
+		got, policy := true, ""
+		if status != nil {
+			got, policy = status.Allowed, strings.TrimSuffix(status.Policy, run)
+		}
+		if got {
+			allowed++
+		}
+		if got != r.Allowed {
+			return "", fmt.Sprintf("request #%d (user %q, ip %q) allowed = %v by policy %q, want %v", i, r.User, r.IP, got, policy, r.Allowed)
+		}
+		if r.Policy != "" && policy != r.Policy {
+			return "", fmt.Sprintf("request #%d (user %q, ip %q) policy = %q, want %q", i, r.User, r.IP, policy, r.Policy)
+		}
+	}
+	return fmt.Sprintf("%d/%d requests allowed", allowed, len(s.Requests)), ""
+}
+
+// checkConcurrent 同时发出请求，检查通过的数量没有超过配额
+func checkConcurrent(cacheService *service.CacheService, s sample) (string, string) {
+	limit, err := rule(s)
+	if err != nil {
+		return "", err.Error()
+	}
+	// 每次运行使用新的key，避免Redis中上一次运行的计数
+	key := fmt.Sprintf("ratelimitcheck:%s:%d", s.Name, time.Now().UnixNano())
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		allowed  int
+		firstErr error
+	)
+	for i := 0; i < s.Concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := cacheService.CheckRateLimit(context.Background(), key, limit)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			if result.Allowed {
+				allowed++
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return "", firstErr.Error()
+	}
+	if allowed != s.Allowed {
+		return "", fmt.Sprintf("%d/%d concurrent requests allowed, want %d", allowed, s.Concurrent, s.Allowed)
+	}
+	return fmt.Sprintf("%d/%d concurrent requests allowed", allowed, s.Concurrent), ""
+}
@@ -0,0 +1,144 @@
+// safetycheck 回归舵机安全限位，不需要真机。
+// 样本集每行一个JSON：{"name", "device_type", "safety", "functions", "expect", "output"}。
+// functions 为翻译后的设备动作，按型号的安全限位（或样本中的 safety 覆盖）检查；
+// expect 为期望出现的诊断代码，为空表示必须原样通过；给出 output 时还要求检查后的functions与之相同。
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ai-generation/internal/service"
+	"github.com/ai-generation/internal/types"
+)
+
+type sample struct {
+	Name       string                      `json:"name"`
+	DeviceType string                      `json:"device_type"`
+	Safety     *service.SafetyLimits       `json:"safety"`
+	Functions  []types.CompletionFunctions `json:"functions"`
+	Expect     []string                    `json:"expect"`
+	Output     json.RawMessage             `json:"output"`
+}
+
+func main() {
+	profilesFile := flag.String("profiles", "", "device profiles file (JSON), defaults to built-in profiles")
+	flag.Parse()
+
+	path := "testdata/safety_corpus.jsonl"
+	if flag.NArg() > 0 {
+		path = flag.Arg(0)
+	}
+	profiles, err := service.LoadDeviceProfiles(*profilesFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load device profiles: %v\n", err)
+		os.Exit(2)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open corpus: %v\n", err)
+		os.Exit(2)
+	}
+	defer file.Close()
+
+	failed, total := 0, 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var s sample
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid sample line: %v\n", err)
+			os.Exit(2)
+		}
+		total++
+		kept, problem := check(profiles, s)
+		if problem != "" {
+			failed++
+			fmt.Printf("❌ %s: %s\n", s.Name, problem)
+		} else {
+			fmt.Printf("✅ %s: %d/%d functions kept\n", s.Name, kept, len(s.Functions))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "read corpus: %v\n", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("%d/%d samples passed\n", total-failed, total)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// check 按服务端相同的方式对整组functions做安全检查，返回保留的function数量
+func check(profiles *service.DeviceProfiles, s sample) (int, string) {
+	limits, err := sampleLimits(profiles, s)
+	if err != nil {
+		return 0, err.Error()
+	}
+	if limits == nil {
+		return 0, fmt.Sprintf("device type %q has no safety limits", s.DeviceType)
+	}
+	functions, _, diagnostics := limits.NewCheck().Apply(s.Functions, s.Functions)
+
+	var got []string
+	seen := make(map[string]bool)
+	for _, d := range diagnostics {
+		if !seen[d.Code] {
+			seen[d.Code] = true
+			got = append(got, d.Code)
+		}
+	}
+	want := append([]string{}, s.Expect...)
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		var messages []string
+		for _, d := range diagnostics {
+			messages = append(messages, fmt.Sprintf("#%d %s", d.Index, d.Message))
+		}
+		return len(functions), fmt.Sprintf("diagnostics = [%s], want [%s]: %s", strings.Join(got, ","), strings.Join(want, ","), strings.Join(messages, "; "))
+	}
+	if len(s.Output) > 0 {
+		var gotOutput, wantOutput interface{}
+		raw, _ := json.Marshal(functions)
+		_ = json.Unmarshal(raw, &gotOutput)
+		if err := json.Unmarshal(s.Output, &wantOutput); err != nil {
+			return len(functions), fmt.Sprintf("invalid output: %v", err)
+		}
+		if !reflect.DeepEqual(gotOutput, wantOutput) {
+			return len(functions), fmt.Sprintf("output = %s, want %s", raw, s.Output)
+		}
+	}
+	return len(functions), ""
+}
+
+// sampleLimits 样本给出 safety 时按配置文件相同的方式校验后使用，否则使用型号（默认yan）的限位
+func sampleLimits(profiles *service.DeviceProfiles, s sample) (*service.SafetyLimits, error) {
+	if s.Safety != nil {
+		custom, err := service.NewDeviceProfiles([]service.DeviceProfile{{Type: "corpus", Safety: s.Safety}}, nil)
+		if err != nil {
+			return nil, err
+		}
+		profiles = custom
+		s.DeviceType = "corpus"
+	}
+	if s.DeviceType == "" {
+		s.DeviceType = service.DeviceTypeYan
+	}
+	profile, err := profiles.Resolve(s.DeviceType, "")
+	if err != nil {
+		return nil, err
+	}
+	return profile.Safety, nil
+}
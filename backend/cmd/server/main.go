@@ -16,7 +16,9 @@ import (
 	"github.com/ai-generation/internal/api"
 	"github.com/ai-generation/internal/config"
 	"github.com/ai-generation/internal/grpc"
+	"github.com/ai-generation/internal/normalize"
 	"github.com/ai-generation/internal/service"
+	"github.com/ai-generation/pkg/dify"
 	"github.com/gin-gonic/gin"
 	grpclib "google.golang.org/grpc"
 )
@@ -28,18 +30,100 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	// 初始化Redis客户端
-	redisClient := redis.NewClient(&redis.Config{
-		Addr:     cfg.RedisAddr,
-		Password: cfg.RedisPassword,
-		DB:       cfg.RedisDB,
-	})
+	// 初始化存储，memory 模式不连接Redis
+	var redisClient *redis.Client
+	if cfg.Storage != service.StorageMemory {
+		redisClient = redis.NewClient(&redis.Config{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+		})
+	}
+	storage, err := service.NewStorage(cfg.Storage, redisClient, cfg.MemoryCacheSize, cfg.MemoryCacheTTL)
+	if err != nil {
+		log.Fatalf("Failed to configure storage: %v", err)
+	}
 
-	// 初始化缓存服务
-	cacheService := service.NewCacheService(redisClient)
+	// 初始化缓存服务；存储暂时不可用时照常启动：缓存按未命中处理，限流改为进程内计数
+	cacheService := service.NewCacheService(storage)
+	pingCtx, cancelPing := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := cacheService.Ping(pingCtx); err != nil {
+		log.Printf("Storage %s is not reachable: %v", cfg.Storage, err)
+	} else {
+		log.Printf("Storage %s is available", cfg.Storage)
+	}
+	cancelPing()
+
+	// 加载动作注册表
+	actionRegistry, err := service.LoadActionRegistry(cfg.ActionRegistryFile)
+	if err != nil {
+		log.Fatalf("Failed to load action registry: %v", err)
+	}
+	deviceProfiles, err := service.LoadDeviceProfiles(cfg.DeviceProfilesFile)
+	if err != nil {
+		log.Fatalf("Failed to load device profiles: %v", err)
+	}
+	rateLimit := service.RateLimit{
+		Algorithm: cfg.RateLimitAlgorithm,
+		Limit:     cfg.RateLimitRequests,
+		Window:    cfg.RateLimitWindow,
+		Burst:     cfg.RateLimitBurst,
+	}
+	rateLimitPolicies, err := service.LoadRateLimitPolicies(cfg.RateLimitPoliciesFile, rateLimit)
+	if err != nil {
+		log.Fatalf("Failed to load rate limit policies: %v", err)
+	}
+	queryNormalizer, err := normalize.New(cfg.QueryNormalization, cfg.QueryFillers)
+	if err != nil {
+		log.Fatalf("Failed to configure query normalization: %v", err)
+	}
+	macroLibrary := service.NewMacroLibrary(cacheService, actionRegistry)
+	auditLog := service.NewAuditLog(cacheService)
+	deviceHub := service.NewDeviceHub(cacheService, auditLog)
+
+	// 回答修复默认在新会话中重新询问，可配置为在原会话中询问；配置了专用应用时使用专用应用
+	var repairClient *dify.Client
+	if cfg.AnswerRepairAPIKey != "" {
+		repairClient = dify.NewClient(cfg.AnswerRepairAPIKey, cfg.DifyAPIEndpoint)
+	}
 
 	// 初始化AI服务
-	aiService, error := service.NewAIService(cfg.DifyAPIKey, cfg.DifyAPIEndpoint, cacheService)
+	aiService, error := service.NewAIService(cfg.DifyAPIKey, cfg.DifyAPIEndpoint, cacheService, actionRegistry, service.AIServiceOptions{
+		AnswerFallback: service.AnswerFallbackOptions{
+			Enabled: cfg.AnswerFallbackEnabled,
+			Gesture: cfg.AnswerFallbackGesture,
+		},
+		AnswerRepair: service.AnswerRepairOptions{
+			MaxAttempts:      cfg.AnswerRepairAttempts,
+			Timeout:          cfg.AnswerRepairTimeout,
+			SameConversation: cfg.AnswerRepairSameConversation,
+			Client:           repairClient,
+		},
+		ParamsFormat:      cfg.ParamsFormat,
+		TimelineDelayMode: cfg.TimelineDelayMode,
+		DeviceProfiles:    deviceProfiles,
+		Macros:            macroLibrary,
+		DeviceHub:         deviceHub,
+		RateLimit:         rateLimit,
+		RateLimitPolicies: rateLimitPolicies,
+		CachePolicy: service.CachePolicy{
+			CacheFollowUps: cfg.CacheFollowUps,
+			IntentInput:    cfg.CacheIntentInput,
+			Intents:        cfg.CacheIntents,
+			TTL:            cfg.CacheTTL,
+			ClassTTLs:      cfg.CacheClassTTLs,
+		},
+		QueryNormalizer: queryNormalizer,
+		Stampede: service.StampedeOptions{
+			LockTTL:     cfg.CompletionLockTTL,
+			WaitTimeout: cfg.CompletionWaitTimeout,
+		},
+		SimilarCache: service.SimilarCacheOptions{
+			Enabled:    cfg.SimilarCacheEnabled,
+			Threshold:  cfg.SimilarCacheThreshold,
+			MaxEntries: cfg.SimilarCacheMaxEntries,
+		},
+	})
 	// 检查ai服务是否成功创建
 	if error != nil {
 		log.Fatal(error)
@@ -47,6 +131,20 @@ func main() {
 	// 创建HTTP路由
 	r := gin.Default()
 	api.RegisterHandlers(r, aiService)
+	api.RegisterEmergencyStopHandler(r, cfg.EmergencyStopToken, deviceHub)
+
+	// 注册管理接口
+	if cfg.AdminToken == "" {
+		log.Println("ADMIN_TOKEN未设置，管理接口将拒绝所有请求")
+	}
+	admin := api.NewAdminGroup(r, cfg.AdminToken)
+	datasetService := service.NewDatasetService(dify.NewDatasetClient(cfg.DifyDatasetAPIKey, cfg.DifyAPIEndpoint), cacheService, cfg.DifyDatasetIDs, aiService.CacheNamespace())
+	api.RegisterDatasetHandlers(admin, datasetService)
+	api.RegisterMacroHandlers(admin, macroLibrary)
+	api.RegisterPerformanceHandlers(admin, service.NewPerformanceLibrary(cacheService, aiService, deviceHub, auditLog))
+	api.RegisterCacheHandlers(admin, service.NewCacheAdmin(cacheService, auditLog))
+	api.RegisterCacheWarmupHandler(admin, service.NewCacheWarmer(aiService, auditLog))
+	api.RegisterTimelineHandlers(admin, aiService)
 
 	// 创建HTTP服务器
 	httpServer := &http.Server{
@@ -56,9 +154,14 @@ func main() {
 
 	// 创建gRPC服务器
 	grpcServer := grpclib.NewServer()
-	completionServer := grpc.NewServer(aiService)
+	completionServer := grpc.NewServer(aiService, deviceHub, cfg.EmergencyStopToken, cfg.DeviceTokens)
 	proto.RegisterCompletionServiceServer(grpcServer, completionServer)
 
+	// 订阅其他实例的急停广播
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	defer stopHub()
+	go deviceHub.Run(hubCtx)
+
 	// 启动HTTP服务器（后台运行）
 	go func() {
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
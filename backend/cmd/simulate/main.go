@@ -0,0 +1,125 @@
+// simulate 在模拟器上回归动作序列，不需要真机。
+// 样本集每行一个JSON：{"name", "functions", "delay_mode", "expect", "duration"}，
+// expect 为期望出现的问题代码（error和warning），为空表示序列必须能干净地执行完。
+// 使用 -trace 打印每个样本的完整状态轨迹，-sample 指定轨迹的采样间隔(毫秒)。
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ai-generation/internal/service"
+	"github.com/ai-generation/internal/simulator"
+	"github.com/ai-generation/internal/types"
+)
+
+type sample struct {
+	Name      string                      `json:"name"`
+	Functions []types.CompletionFunctions `json:"functions"`
+	DelayMode string                      `json:"delay_mode"`
+	Expect    []string                    `json:"expect"`
+	Duration  *int                        `json:"duration"`
+}
+
+func main() {
+	registryFile := flag.String("registry", "", "action registry file (JSON), defaults to built-in actions")
+	printTrace := flag.Bool("trace", false, "print the state trace of every sample")
+	sampleInterval := flag.Int("sample", 0, "extra trace frame every N milliseconds")
+	flag.Parse()
+
+	path := "testdata/simulator_corpus.jsonl"
+	if flag.NArg() > 0 {
+		path = flag.Arg(0)
+	}
+	registry, err := service.LoadActionRegistry(*registryFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load action registry: %v\n", err)
+		os.Exit(2)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open corpus: %v\n", err)
+		os.Exit(2)
+	}
+	defer file.Close()
+
+	sim := simulator.New(nil, *sampleInterval)
+	failed, total := 0, 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var s sample
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid sample line: %v\n", err)
+			os.Exit(2)
+		}
+		total++
+		trace, problem := check(registry, sim, s)
+		if problem != "" {
+			failed++
+			fmt.Printf("❌ %s: %s\n", s.Name, problem)
+		} else {
+			fmt.Printf("✅ %s: %dms, %d issues\n", s.Name, trace.Duration, len(trace.Issues))
+		}
+		if *printTrace && trace != nil {
+			out, _ := json.MarshalIndent(trace, "", "  ")
+			fmt.Println(string(out))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "read corpus: %v\n", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("%d/%d samples passed\n", total-failed, total)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// check 按服务端相同的流程校验并编译时间线，再交给模拟器执行
+func check(registry *service.ActionRegistry, sim *simulator.Simulator, s sample) (*simulator.Trace, string) {
+	compiler, err := service.NewTimelineCompiler(registry, s.DelayMode)
+	if err != nil {
+		return nil, err.Error()
+	}
+	functions, diagnostics := registry.Validate(s.Functions)
+	for _, d := range diagnostics {
+		if d.Severity == service.SeverityDropped {
+			return nil, fmt.Sprintf("function #%d dropped by validation: %s", d.Index, d.Message)
+		}
+	}
+	trace := sim.Simulate(functions, compiler.Compile(functions))
+
+	var got []string
+	seen := make(map[string]bool)
+	for _, issue := range trace.Issues {
+		if !seen[issue.Code] {
+			seen[issue.Code] = true
+			got = append(got, issue.Code)
+		}
+	}
+	want := append([]string{}, s.Expect...)
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		var messages []string
+		for _, issue := range trace.Issues {
+			messages = append(messages, fmt.Sprintf("#%d %s", issue.Index, issue.Message))
+		}
+		return trace, fmt.Sprintf("issues = [%s], want [%s]: %s", strings.Join(got, ","), strings.Join(want, ","), strings.Join(messages, "; "))
+	}
+	if s.Duration != nil && trace.Duration != *s.Duration {
+		return trace, fmt.Sprintf("duration = %dms, want %dms", trace.Duration, *s.Duration)
+	}
+	return trace, ""
+}
@@ -0,0 +1,96 @@
+// warmup 展会开放前预热常见问题的回答。
+// 读取问题清单（JSONL每行一个 {"query", "inputs", "device_type", "device_id", "user"}，
+// 或带表头的CSV），提交给服务的 /admin/cache/warmup 接口，按正常流程请求Dify并写入缓存。
+// 有失败或不合格的回答时退出码为1。
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ai-generation/internal/types"
+	"github.com/ai-generation/internal/warmup"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8080", "service base URL")
+	token := flag.String("token", os.Getenv("ADMIN_TOKEN"), "admin token, defaults to $ADMIN_TOKEN")
+	actor := flag.String("actor", os.Getenv("USER"), "operator recorded in the audit log")
+	concurrency := flag.Int("concurrency", 4, "concurrent Dify requests")
+	refresh := flag.Bool("refresh", false, "regenerate answers that are already cached")
+	timeout := flag.Duration("timeout", 30*time.Minute, "overall timeout")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: warmup [flags] questions.jsonl|questions.csv")
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open question list: %v\n", err)
+		os.Exit(2)
+	}
+	items, err := warmup.Parse(file, warmup.Format(path, ""))
+	file.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid question list: %v\n", err)
+		os.Exit(2)
+	}
+
+	body, _ := json.Marshal(types.WarmupRequest{Items: items, Concurrency: *concurrency, Refresh: *refresh})
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(*server, "/")+"/admin/cache/warmup", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "build request: %v\n", err)
+		os.Exit(2)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+*token)
+	if *actor != "" {
+		req.Header.Set("X-Admin-User", *actor)
+	}
+	fmt.Printf("warming %d queries from %s ...\n", len(items), path)
+	resp, err := (&http.Client{Timeout: *timeout}).Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warmup request: %v\n", err)
+		os.Exit(2)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Code int                 `json:"code"`
+		Msg  string              `json:"msg"`
+		Data *types.WarmupResult `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		fmt.Fprintf(os.Stderr, "decode response (HTTP %d): %v\n", resp.StatusCode, err)
+		os.Exit(2)
+	}
+	if envelope.Data == nil {
+		fmt.Fprintf(os.Stderr, "warmup failed (HTTP %d): %s\n", resp.StatusCode, envelope.Msg)
+		os.Exit(2)
+	}
+
+	result := envelope.Data
+	for _, issue := range result.Issues {
+		mark := "❌"
+		if issue.Status == types.WarmupViolation {
+			mark = "⚠️"
+		}
+		fmt.Printf("%s line %d %q [%s]: %s\n", mark, issue.Line, issue.Query, issue.Status, issue.Message)
+		for _, d := range issue.Diagnostics {
+			fmt.Printf("    #%d %s %s: %s\n", d.Index, d.Severity, d.Code, d.Message)
+		}
+	}
+	fmt.Printf("%d warmed, %d already cached, %d schema violations, %d failed in %s\n",
+		result.Warmed, result.Skipped, result.Violations, result.Failed, time.Duration(result.Duration)*time.Millisecond)
+	if result.Failed > 0 || result.Violations > 0 {
+		os.Exit(1)
+	}
+}
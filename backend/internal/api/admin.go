@@ -0,0 +1,59 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminActorKey 管理员身份在gin.Context中的键，供审计使用
+const AdminActorKey = "admin_actor"
+
+// NewAdminGroup 创建需要管理令牌认证的路由组
+func NewAdminGroup(r *gin.Engine, adminToken string) *gin.RouterGroup {
+	admin := r.Group("/admin")
+	admin.Use(AdminAuth(adminToken))
+	return admin
+}
+
+// AdminAuth 校验 Authorization: Bearer <token>，X-Admin-User 头记录操作人
+func AdminAuth(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminToken == "" {
+			respondError(c, &HTTPError{StatusCode: http.StatusServiceUnavailable, Message: "admin api is disabled"})
+			c.Abort()
+			return
+		}
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			respondError(c, &HTTPError{StatusCode: http.StatusUnauthorized, Message: "invalid admin token"})
+			c.Abort()
+			return
+		}
+		actor := c.GetHeader("X-Admin-User")
+		if actor == "" {
+			actor = "admin"
+		}
+		c.Set(AdminActorKey, actor)
+		c.Next()
+	}
+}
+
+// respond 管理接口统一使用 code/msg/data 响应格式
+func respond(c *gin.Context, data interface{}) {
+	c.JSON(http.StatusOK, gin.H{"code": http.StatusOK, "msg": "success", "data": data})
+}
+
+func respondError(c *gin.Context, err error) {
+	if httpErr, ok := err.(*HTTPError); ok {
+		c.JSON(httpErr.StatusCode, gin.H{"code": httpErr.StatusCode, "msg": httpErr.Message, "data": nil})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"code": http.StatusInternalServerError, "msg": err.Error(), "data": nil})
+}
+
+func badRequest(c *gin.Context, msg string) {
+	respondError(c, &HTTPError{StatusCode: http.StatusBadRequest, Message: msg})
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ai-generation/internal/types"
+	"github.com/ai-generation/internal/warmup"
+	"github.com/gin-gonic/gin"
+)
+
+// CacheAdminService 定义了缓存管理服务的接口
+type CacheAdminService interface {
+	ListNamespaces(ctx context.Context) ([]*types.CacheNamespace, error)
+	FlushNamespace(ctx context.Context, namespace, actor string) (*types.CachePurgeResult, error)
+	BumpNamespace(ctx context.Context, namespace, actor string) (*types.CacheNamespace, error)
+	SearchCache(ctx context.Context, req *types.CacheSearchRequest) (*types.CacheSearchResult, error)
+	GetCacheEntry(ctx context.Context, key string) (*types.CacheEntry, error)
+	PurgeCache(ctx context.Context, req *types.CachePurgeRequest, actor string) (*types.CachePurgeResult, error)
+}
+
+// RegisterCacheHandlers 注册缓存管理接口，删除操作记录在审计日志中
+func RegisterCacheHandlers(admin *gin.RouterGroup, cacheAdmin CacheAdminService) {
+	cache := admin.Group("/cache")
+
+	cache.GET("/namespaces", func(c *gin.Context) {
+		resp, err := cacheAdmin.ListNamespaces(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	cache.DELETE("/namespaces/:namespace", func(c *gin.Context) {
+		resp, err := cacheAdmin.FlushNamespace(c.Request.Context(), c.Param("namespace"), c.GetString(AdminActorKey))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	// 递增命名空间的版本，其中的回答立即失效
+	cache.POST("/namespaces/:namespace/bump", func(c *gin.Context) {
+		resp, err := cacheAdmin.BumpNamespace(c.Request.Context(), c.Param("namespace"), c.GetString(AdminActorKey))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	cache.GET("/entries", func(c *gin.Context) {
+		var req types.CacheSearchRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			badRequest(c, err.Error())
+			return
+		}
+		resp, err := cacheAdmin.SearchCache(c.Request.Context(), &req)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	cache.GET("/entries/:key", func(c *gin.Context) {
+		resp, err := cacheAdmin.GetCacheEntry(c.Request.Context(), c.Param("key"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	cache.DELETE("/entries/:key", func(c *gin.Context) {
+		resp, err := cacheAdmin.PurgeCache(c.Request.Context(), &types.CachePurgeRequest{Key: c.Param("key")}, c.GetString(AdminActorKey))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	// 按查询模式或是否已失效删除，可限定命名空间
+	cache.POST("/purge", func(c *gin.Context) {
+		var req types.CachePurgeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			badRequest(c, err.Error())
+			return
+		}
+		resp, err := cacheAdmin.PurgeCache(c.Request.Context(), &req, c.GetString(AdminActorKey))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+}
+
+// CacheWarmupService 定义了缓存预热服务的接口
+type CacheWarmupService interface {
+	WarmCache(ctx context.Context, req *types.WarmupRequest, actor string) (*types.WarmupResult, error)
+}
+
+// RegisterCacheWarmupHandler 注册缓存预热接口，全部问题处理完后返回报告。
+// 请求体为JSON {"items", "concurrency", "refresh"}，或multipart上传的问题清单文件(file字段)，
+// 也可以直接以JSONL/CSV作为请求体，此时concurrency、refresh通过查询参数传递
+func RegisterCacheWarmupHandler(admin *gin.RouterGroup, warmer CacheWarmupService) {
+	admin.POST("/cache/warmup", func(c *gin.Context) {
+		var req types.WarmupRequest
+		switch {
+		case c.ContentType() == "application/json":
+			if err := c.ShouldBindJSON(&req); err != nil {
+				badRequest(c, err.Error())
+				return
+			}
+		case isMultipart(c):
+			fileHeader, err := c.FormFile("file")
+			if err != nil {
+				badRequest(c, "file is required")
+				return
+			}
+			file, err := fileHeader.Open()
+			if err != nil {
+				badRequest(c, err.Error())
+				return
+			}
+			defer file.Close()
+			if req.Items, err = warmup.Parse(file, warmup.Format(fileHeader.Filename, fileHeader.Header.Get("Content-Type"))); err != nil {
+				badRequest(c, err.Error())
+				return
+			}
+		default:
+			items, err := warmup.Parse(c.Request.Body, warmup.Format("", c.ContentType()))
+			if err != nil {
+				badRequest(c, err.Error())
+				return
+			}
+			req.Items = items
+		}
+		if value := c.Query("concurrency"); value != "" {
+			req.Concurrency, _ = strconv.Atoi(value)
+		} else if value := c.PostForm("concurrency"); value != "" {
+			req.Concurrency, _ = strconv.Atoi(value)
+		}
+		if value := c.Query("refresh"); value != "" {
+			req.Refresh, _ = strconv.ParseBool(value)
+		} else if value := c.PostForm("refresh"); value != "" {
+			req.Refresh, _ = strconv.ParseBool(value)
+		}
+		resp, err := warmer.WarmCache(c.Request.Context(), &req, c.GetString(AdminActorKey))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+}
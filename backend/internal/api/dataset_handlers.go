@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ai-generation/pkg/dify"
+	"github.com/gin-gonic/gin"
+)
+
+// DatasetService 定义了知识库管理服务的接口
+type DatasetService interface {
+	CreateDocumentByText(datasetID string, req *dify.DocumentRequest) (*dify.DocumentResponse, error)
+	CreateDocumentByFile(datasetID string, req *dify.DocumentRequest, filename string, file io.Reader) (*dify.DocumentResponse, error)
+	UpdateDocumentByText(datasetID, documentID string, req *dify.DocumentRequest) (*dify.DocumentResponse, error)
+	UpdateDocumentByFile(datasetID, documentID string, req *dify.DocumentRequest, filename string, file io.Reader) (*dify.DocumentResponse, error)
+	DeleteDocument(datasetID, documentID string) error
+	ListDocuments(datasetID, keyword string, page, limit int) (*dify.DocumentList, error)
+	ListSegments(datasetID, documentID, keyword, status string) (*dify.SegmentList, error)
+	IndexingStatus(datasetID, batch string) (*dify.IndexingStatusList, error)
+}
+
+// RegisterDatasetHandlers 注册知识库管理接口，供管理后台直接上传展品介绍
+func RegisterDatasetHandlers(admin *gin.RouterGroup, datasetService DatasetService) {
+	datasets := admin.Group("/datasets/:dataset_id")
+
+	datasets.GET("/documents", func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.Query("page"))
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		resp, err := datasetService.ListDocuments(c.Param("dataset_id"), c.Query("keyword"), page, limit)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	// 创建文档：JSON请求体按文本创建，multipart请求按文件创建
+	datasets.POST("/documents", func(c *gin.Context) {
+		datasetID := c.Param("dataset_id")
+		if isMultipart(c) {
+			req, filename, file, ok := bindDocumentFile(c)
+			if !ok {
+				return
+			}
+			defer file.Close()
+			resp, err := datasetService.CreateDocumentByFile(datasetID, req, filename, file)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			respond(c, resp)
+			return
+		}
+
+		var req dify.DocumentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			badRequest(c, err.Error())
+			return
+		}
+		if req.Name == "" || req.Text == "" {
+			badRequest(c, "name and text are required")
+			return
+		}
+		resp, err := datasetService.CreateDocumentByText(datasetID, &req)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	datasets.PUT("/documents/:document_id", func(c *gin.Context) {
+		datasetID, documentID := c.Param("dataset_id"), c.Param("document_id")
+		if isMultipart(c) {
+			req, filename, file, ok := bindDocumentFile(c)
+			if !ok {
+				return
+			}
+			defer file.Close()
+			resp, err := datasetService.UpdateDocumentByFile(datasetID, documentID, req, filename, file)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			respond(c, resp)
+			return
+		}
+
+		var req dify.DocumentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			badRequest(c, err.Error())
+			return
+		}
+		resp, err := datasetService.UpdateDocumentByText(datasetID, documentID, &req)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	datasets.DELETE("/documents/:document_id", func(c *gin.Context) {
+		if err := datasetService.DeleteDocument(c.Param("dataset_id"), c.Param("document_id")); err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, nil)
+	})
+
+	datasets.GET("/documents/:document_id/segments", func(c *gin.Context) {
+		resp, err := datasetService.ListSegments(c.Param("dataset_id"), c.Param("document_id"), c.Query("keyword"), c.Query("status"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	datasets.GET("/batches/:batch/indexing-status", func(c *gin.Context) {
+		resp, err := datasetService.IndexingStatus(c.Param("dataset_id"), c.Param("batch"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+}
+
+func isMultipart(c *gin.Context) bool {
+	return strings.HasPrefix(c.ContentType(), "multipart/form-data")
+}
+
+// bindDocumentFile 读取multipart中的file字段，可选的data字段为DocumentRequest的JSON
+func bindDocumentFile(c *gin.Context) (*dify.DocumentRequest, string, io.ReadCloser, bool) {
+	req := &dify.DocumentRequest{}
+	if data := c.PostForm("data"); data != "" {
+		if err := json.Unmarshal([]byte(data), req); err != nil {
+			badRequest(c, "invalid data field: "+err.Error())
+			return nil, "", nil, false
+		}
+	}
+	if name := c.PostForm("name"); name != "" {
+		req.Name = name
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		badRequest(c, "file is required")
+		return nil, "", nil, false
+	}
+	file, err := header.Open()
+	if err != nil {
+		badRequest(c, "failed to open uploaded file: "+err.Error())
+		return nil, "", nil, false
+	}
+	return req, header.Filename, file, true
+}
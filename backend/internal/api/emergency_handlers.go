@@ -0,0 +1,28 @@
+package api
+
+import (
+	"context"
+
+	"github.com/ai-generation/internal/types"
+	"github.com/gin-gonic/gin"
+)
+
+// EmergencyStopService 定义了急停服务的接口
+type EmergencyStopService interface {
+	EmergencyStop(ctx context.Context, req *types.EmergencyStopRequest, actor string) *types.EmergencyStopResult
+}
+
+// RegisterEmergencyStopHandler 注册急停接口，使用独立的令牌，现场人员无需管理权限
+func RegisterEmergencyStopHandler(r *gin.Engine, stopToken string, stopService EmergencyStopService) {
+	r.POST("/emergency-stop", AdminAuth(stopToken), func(c *gin.Context) {
+		// 请求体可以为空，表示停止全部机器人
+		var req types.EmergencyStopRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				badRequest(c, err.Error())
+				return
+			}
+		}
+		respond(c, stopService.EmergencyStop(c.Request.Context(), &req, c.GetString(AdminActorKey)))
+	})
+}
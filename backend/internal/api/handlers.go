@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
@@ -20,6 +21,7 @@ func (e *HTTPError) Error() string {
 // AIService 定义了AI服务的接口
 type AIService interface {
 	GetCompletion(req *types.CompletionRequest) (*types.CompletionResponse, error)
+	StreamCompletion(ctx context.Context, req *types.CompletionRequest, emit func(event *types.StreamEvent) error) error
 }
 
 func RegisterHandlers(r *gin.Engine, aiService AIService) {
@@ -39,8 +41,15 @@ func RegisterHandlers(r *gin.Engine, aiService AIService) {
 		if req.ResponseMode == "" {
 			req.ResponseMode = "blocking"
 		}
+		fillClientIdentity(c, &req)
+
+		if req.ResponseMode == "streaming" {
+			streamCompletion(c, aiService, &req)
+			return
+		}
 
 		resp, err := aiService.GetCompletion(&req)
+		setRateLimitHeaders(c, req.RateLimit)
 		if err != nil {
 			// 检查是否是HTTP错误
 			if httpErr, ok := err.(*HTTPError); ok {
@@ -59,6 +68,39 @@ func RegisterHandlers(r *gin.Engine, aiService AIService) {
 			return
 		}
 
-		c.Data(http.StatusOK, "application/json", formattedResp)
+		status := http.StatusOK
+		if req.RateLimit != nil && !req.RateLimit.Allowed {
+			status = http.StatusTooManyRequests
+		}
+		c.Data(status, "application/json", formattedResp)
+	})
+}
+
+// streamCompletion 以SSE推送流式事件，事件名与StreamEvent.Event一致
+func streamCompletion(c *gin.Context, aiService AIService, req *types.CompletionRequest) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	// 限流在推送第一个事件之前完成，此时状态码和响应头还未写出，被拒绝时返回429
+	headersSet := false
+	err := aiService.StreamCompletion(c.Request.Context(), req, func(event *types.StreamEvent) error {
+		if !headersSet {
+			setRateLimitHeaders(c, req.RateLimit)
+			status := http.StatusOK
+			if req.RateLimit != nil && !req.RateLimit.Allowed {
+				status = http.StatusTooManyRequests
+			}
+			c.Status(status)
+			headersSet = true
+		}
+		c.SSEvent(event.Event, event)
+		c.Writer.Flush()
+		return c.Request.Context().Err()
 	})
+	if err != nil && c.Request.Context().Err() == nil {
+		c.SSEvent("error", types.StreamEvent{Event: types.StreamEventError, Code: http.StatusInternalServerError, Msg: err.Error()})
+		c.Writer.Flush()
+	}
 }
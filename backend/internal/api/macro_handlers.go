@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+
+	"github.com/ai-generation/internal/types"
+	"github.com/gin-gonic/gin"
+)
+
+// MacroService 定义了编排宏管理服务的接口
+type MacroService interface {
+	ListMacros(ctx context.Context) ([]*types.Macro, error)
+	GetMacro(ctx context.Context, name string) (*types.Macro, error)
+	SaveMacro(ctx context.Context, macro *types.Macro, actor string) (*types.Macro, error)
+	DeleteMacro(ctx context.Context, name string) error
+}
+
+// RegisterMacroHandlers 注册编排宏管理接口
+func RegisterMacroHandlers(admin *gin.RouterGroup, macroService MacroService) {
+	macros := admin.Group("/macros")
+
+	macros.GET("", func(c *gin.Context) {
+		resp, err := macroService.ListMacros(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	macros.GET("/:name", func(c *gin.Context) {
+		resp, err := macroService.GetMacro(c.Request.Context(), c.Param("name"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	// 创建或覆盖宏，路径中的名称优先于请求体
+	macros.PUT("/:name", func(c *gin.Context) {
+		var macro types.Macro
+		if err := c.ShouldBindJSON(&macro); err != nil {
+			badRequest(c, err.Error())
+			return
+		}
+		macro.Name = c.Param("name")
+		resp, err := macroService.SaveMacro(c.Request.Context(), &macro, c.GetString(AdminActorKey))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	macros.DELETE("/:name", func(c *gin.Context) {
+		if err := macroService.DeleteMacro(c.Request.Context(), c.Param("name")); err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, nil)
+	})
+}
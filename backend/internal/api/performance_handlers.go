@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ai-generation/internal/types"
+	"github.com/gin-gonic/gin"
+)
+
+// PerformanceService 定义了表演库管理服务的接口
+type PerformanceService interface {
+	ListPerformances(ctx context.Context) ([]*types.Performance, error)
+	GetPerformance(ctx context.Context, name string) (*types.Performance, error)
+	SavePerformance(ctx context.Context, performance *types.Performance, actor string) (*types.Performance, error)
+	DeletePerformance(ctx context.Context, name string) error
+	RecordPerformance(ctx context.Context, name string, req *types.RecordPerformanceRequest, actor string) (*types.Performance, error)
+	ExportPerformances(ctx context.Context) (*types.PerformanceExport, error)
+	ImportPerformances(ctx context.Context, export *types.PerformanceExport, overwrite bool, actor string) (*types.PerformanceImportResult, error)
+	PlayPerformance(ctx context.Context, name string, req *types.PlayPerformanceRequest, actor string) (*types.CompletionResponse, error)
+}
+
+// RegisterPerformanceHandlers 注册表演库管理接口
+func RegisterPerformanceHandlers(admin *gin.RouterGroup, performanceService PerformanceService) {
+	performances := admin.Group("/performances")
+
+	performances.GET("", func(c *gin.Context) {
+		resp, err := performanceService.ListPerformances(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	// 导出为JSON文件，可直接用于导入
+	performances.GET("/export", func(c *gin.Context) {
+		resp, err := performanceService.ExportPerformances(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		filename := fmt.Sprintf("performances-%s.json", time.Now().Format("20060102-150405"))
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.JSON(http.StatusOK, resp)
+	})
+
+	performances.POST("/import", func(c *gin.Context) {
+		var export types.PerformanceExport
+		if err := c.ShouldBindJSON(&export); err != nil {
+			badRequest(c, err.Error())
+			return
+		}
+		overwrite, _ := strconv.ParseBool(c.Query("overwrite"))
+		resp, err := performanceService.ImportPerformances(c.Request.Context(), &export, overwrite, c.GetString(AdminActorKey))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	performances.GET("/:name", func(c *gin.Context) {
+		resp, err := performanceService.GetPerformance(c.Request.Context(), c.Param("name"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	// 创建或覆盖表演，路径中的名称优先于请求体
+	performances.PUT("/:name", func(c *gin.Context) {
+		var performance types.Performance
+		if err := c.ShouldBindJSON(&performance); err != nil {
+			badRequest(c, err.Error())
+			return
+		}
+		performance.Name = c.Param("name")
+		resp, err := performanceService.SavePerformance(c.Request.Context(), &performance, c.GetString(AdminActorKey))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	performances.DELETE("/:name", func(c *gin.Context) {
+		if err := performanceService.DeletePerformance(c.Request.Context(), c.Param("name")); err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, nil)
+	})
+
+	// 向LLM提问并把回答保存为表演
+	performances.POST("/:name/record", func(c *gin.Context) {
+		var req types.RecordPerformanceRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			badRequest(c, err.Error())
+			return
+		}
+		resp, err := performanceService.RecordPerformance(c.Request.Context(), c.Param("name"), &req, c.GetString(AdminActorKey))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		respond(c, resp)
+	})
+
+	// 重放表演，响应格式与 /completion 相同
+	performances.POST("/:name/play", func(c *gin.Context) {
+		var req types.PlayPerformanceRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				badRequest(c, err.Error())
+				return
+			}
+		}
+		resp, err := performanceService.PlayPerformance(c.Request.Context(), c.Param("name"), &req, c.GetString(AdminActorKey))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(resp.Code, resp)
+	})
+}
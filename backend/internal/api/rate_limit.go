@@ -0,0 +1,43 @@
+package api
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ai-generation/internal/types"
+	"github.com/gin-gonic/gin"
+)
+
+// 限流维度对应的请求头
+const (
+	TenantHeader = "X-Tenant-ID"
+	APIKeyHeader = "X-API-Key"
+)
+
+// fillClientIdentity 从请求头和连接中填写限流使用的租户、API密钥和客户端IP
+func fillClientIdentity(c *gin.Context, req *types.CompletionRequest) {
+	req.Tenant = strings.TrimSpace(c.GetHeader(TenantHeader))
+	req.APIKey = strings.TrimSpace(c.GetHeader(APIKeyHeader))
+	req.ClientIP = c.ClientIP()
+}
+
+// setRateLimitHeaders 设置 X-RateLimit-* 响应头，被拒绝时附加 Retry-After；必须在写出响应体之前调用
+func setRateLimitHeaders(c *gin.Context, status *types.RateLimitStatus) {
+	if status == nil {
+		return
+	}
+	c.Header("X-RateLimit-Limit", strconv.Itoa(status.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(status.Reset)))
+	c.Header("X-RateLimit-Policy", status.Policy)
+	if !status.Allowed {
+		c.Header("Retry-After", strconv.Itoa(ceilSeconds(status.RetryAfter)))
+	}
+}
+
+// ceilSeconds 向上取整到秒，Retry-After 等头只接受整秒
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ai-generation/internal/preview"
+	"github.com/ai-generation/internal/types"
+	"github.com/gin-gonic/gin"
+)
+
+// TimelinePreviewService 定义了时间线预览所需的服务接口
+type TimelinePreviewService interface {
+	GetCompletion(req *types.CompletionRequest) (*types.CompletionResponse, error)
+	PlanFunctions(req *types.CompletionRequest, content string, functions []types.CompletionFunctions) (*types.CompletionOptimizeData, error)
+}
+
+// RegisterTimelineHandlers 在管理接口下注册时间线预览接口。只给query时会请求LLM、写入缓存并占用限流额度，
+// 因此与其他管理接口一样需要管理令牌，不能被任意页面以<img>触发。
+// POST 请求体可以直接给出functions，也可以只给query由LLM生成；GET 只支持query。
+// format=svg 返回甘特图，默认返回JSON泳道模型。
+func RegisterTimelineHandlers(admin *gin.RouterGroup, previewService TimelinePreviewService) {
+	admin.POST("/timeline/preview", func(c *gin.Context) {
+		var req types.TimelinePreviewRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			badRequest(c, err.Error())
+			return
+		}
+		renderTimelinePreview(c, previewService, &req)
+	})
+
+	admin.GET("/timeline/preview", func(c *gin.Context) {
+		req := types.TimelinePreviewRequest{
+			Query:      c.Query("query"),
+			User:       c.Query("user"),
+			DeviceType: c.Query("device_type"),
+			DeviceID:   c.Query("device_id"),
+		}
+		renderTimelinePreview(c, previewService, &req)
+	})
+}
+
+func renderTimelinePreview(c *gin.Context, previewService TimelinePreviewService, req *types.TimelinePreviewRequest) {
+	// 预览总是使用结构化params，以便读取语音文本等参数
+	completionReq := &types.CompletionRequest{
+		Query:        req.Query,
+		Inputs:       req.Inputs,
+		User:         req.User,
+		ParamsFormat: types.ParamsFormatStructured,
+		DeviceType:   req.DeviceType,
+		DeviceID:     req.DeviceID,
+	}
+	fillClientIdentity(c, completionReq)
+
+	var data *types.CompletionOptimizeData
+	if len(req.Functions) > 0 {
+		var err error
+		if data, err = previewService.PlanFunctions(completionReq, req.Content, req.Functions); err != nil {
+			respondError(c, err)
+			return
+		}
+	} else {
+		if req.Query == "" {
+			badRequest(c, "query or functions is required")
+			return
+		}
+		resp, err := previewService.GetCompletion(completionReq)
+		setRateLimitHeaders(c, completionReq.RateLimit)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if resp.Code != http.StatusOK || resp.Data == nil {
+			code := resp.Code
+			if limit := completionReq.RateLimit; limit != nil && !limit.Allowed {
+				code = http.StatusTooManyRequests
+			} else if code == 0 {
+				code = http.StatusInternalServerError
+			}
+			respondError(c, &HTTPError{StatusCode: code, Message: fmt.Sprintf("completion failed: %s", resp.Msg)})
+			return
+		}
+		data = resp.Data
+	}
+
+	lanes := preview.Lanes(data)
+	if c.Query("format") == "svg" {
+		c.Data(http.StatusOK, "image/svg+xml; charset=utf-8", preview.SVG(lanes))
+		return
+	}
+	respond(c, lanes)
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -16,6 +18,60 @@ type Config struct {
 	RedisAddr       string `json:"redis_addr"`
 	RedisPassword   string `json:"redis_password"`
 	RedisDB         int    `json:"redis_db"`
+	// 存储：redis、memory(进程内，不依赖Redis) 或 tiered(进程内LRU + Redis)
+	Storage string `json:"storage"`
+	// 进程内缓存的条目上限，以及tiered模式下本地副本的有效期
+	MemoryCacheSize int           `json:"memory_cache_size"`
+	MemoryCacheTTL  time.Duration `json:"memory_cache_ttl"`
+	// 知识库接口使用独立的dataset API密钥
+	DifyDatasetAPIKey string   `json:"dify_dataset_api_key"`
+	DifyDatasetIDs    []string `json:"dify_dataset_ids"`
+	// 管理接口的访问令牌，为空时不开放管理接口
+	AdminToken string `json:"admin_token"`
+	// 自定义动作注册表文件(JSON)，按名称覆盖或追加内置动作
+	ActionRegistryFile string `json:"action_registry_file"`
+	// 回答不是JSON时降级为纯文本语音播报
+	AnswerFallbackEnabled bool   `json:"answer_fallback_enabled"`
+	AnswerFallbackGesture string `json:"answer_fallback_gesture"`
+	// 回答不合格时重新询问的次数与总时限，可在原会话中询问或使用专用的修复应用
+	AnswerRepairAttempts         int           `json:"answer_repair_attempts"`
+	AnswerRepairTimeout          time.Duration `json:"answer_repair_timeout"`
+	AnswerRepairAPIKey           string        `json:"answer_repair_api_key"`
+	AnswerRepairSameConversation bool          `json:"answer_repair_same_conversation"`
+	// 默认的params格式：structured 或 string(兼容旧客户端)
+	ParamsFormat string `json:"params_format"`
+	// functions中delay的解释方式：absolute、relative 或 sequential
+	TimelineDelayMode string `json:"timeline_delay_mode"`
+	// 设备型号配置文件(JSON)，按type覆盖或追加内置型号，并绑定设备ID
+	DeviceProfilesFile string `json:"device_profiles_file"`
+	// 急停接口的访问令牌，现场人员使用，未设置时使用管理令牌
+	EmergencyStopToken string `json:"emergency_stop_token"`
+	// 机器人订阅指令的凭证，设备ID到令牌；未配置的设备不能订阅
+	DeviceTokens map[string]string `json:"device_tokens"`
+	// 每个用户的限流：算法(token_bucket 或 sliding_window)、窗口内次数、窗口时长与令牌桶容量
+	RateLimitAlgorithm string        `json:"rate_limit_algorithm"`
+	RateLimitRequests  int           `json:"rate_limit_requests"`
+	RateLimitWindow    time.Duration `json:"rate_limit_window"`
+	RateLimitBurst     int           `json:"rate_limit_burst"`
+	// 限流策略文件(JSON数组)，按user、device、tenant、api_key、ip分别配置额度，为空时按user和ip使用上面的额度
+	RateLimitPoliciesFile string `json:"rate_limit_policies_file"`
+	// 缓存策略：是否缓存多轮对话的后续回答，以及只缓存哪些意图(inputs中的意图字段)
+	CacheFollowUps   bool     `json:"cache_follow_ups"`
+	CacheIntentInput string   `json:"cache_intent_input"`
+	CacheIntents     []string `json:"cache_intents"`
+	// 本应用回答的有效期，以及按可缓存类别(default、follow_up、forced、intent:<意图>)覆盖的有效期
+	CacheTTL       time.Duration            `json:"cache_ttl"`
+	CacheClassTTLs map[string]time.Duration `json:"cache_class_ttls"`
+	// 计算缓存键前的查询规范化步骤，none 表示不规范化；口头语列表为空时使用内置列表
+	QueryNormalization []string `json:"query_normalization"`
+	QueryFillers       []string `json:"query_fillers"`
+	// 相似问题缓存：精确缓存未命中时复用相似度达到阈值的已缓存问题的回答
+	SimilarCacheEnabled    bool    `json:"similar_cache_enabled"`
+	SimilarCacheThreshold  float64 `json:"similar_cache_threshold"`
+	SimilarCacheMaxEntries int     `json:"similar_cache_max_entries"`
+	// 相同问题同时到达时跨实例生成锁的有效期，以及等待其他实例写入缓存的最长时间
+	CompletionLockTTL     time.Duration `json:"completion_lock_ttl"`
+	CompletionWaitTimeout time.Duration `json:"completion_wait_timeout"`
 }
 
 func Load() (*Config, error) {
@@ -30,6 +86,23 @@ func Load() (*Config, error) {
 	cfg.RedisAddr = "localhost:6379"
 	cfg.RedisPassword = ""
 	cfg.RedisDB = 0
+	cfg.Storage = "redis"
+	cfg.MemoryCacheSize = 10000
+	cfg.MemoryCacheTTL = 30 * time.Second
+	cfg.CacheTTL = 24 * time.Hour
+	cfg.AnswerFallbackEnabled = true
+	cfg.AnswerRepairAttempts = 0
+	cfg.AnswerRepairTimeout = 30 * time.Second
+	cfg.ParamsFormat = "structured"
+	cfg.TimelineDelayMode = "absolute"
+	cfg.SimilarCacheThreshold = 0.92
+	cfg.CompletionLockTTL = 60 * time.Second
+	cfg.CompletionWaitTimeout = 30 * time.Second
+	cfg.SimilarCacheMaxEntries = 2000
+	cfg.QueryNormalization = []string{"nfkc", "lowercase", "simplified", "fillers", "punctuation"}
+	cfg.RateLimitAlgorithm = "token_bucket"
+	cfg.RateLimitRequests = 100
+	cfg.RateLimitWindow = time.Minute
 
 	// 从环境变量加载服务器配置
 	if difyAPIEndpoint := os.Getenv("DIFY_API_ENDPOINT"); difyAPIEndpoint != "" {
@@ -49,6 +122,188 @@ func Load() (*Config, error) {
 			cfg.RedisDB = db
 		}
 	}
+	if storage := os.Getenv("STORAGE"); storage != "" {
+		cfg.Storage = strings.ToLower(storage)
+	}
+	if size := os.Getenv("MEMORY_CACHE_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			cfg.MemoryCacheSize = n
+		}
+	}
+	if ttl := os.Getenv("MEMORY_CACHE_TTL"); ttl != "" {
+		if d, err := time.ParseDuration(ttl); err == nil {
+			cfg.MemoryCacheTTL = d
+		}
+	}
+
+	if datasetAPIKey := os.Getenv("DIFY_DATASET_API_KEY"); datasetAPIKey != "" {
+		cfg.DifyDatasetAPIKey = datasetAPIKey
+	}
+	if datasetIDs := os.Getenv("DIFY_DATASET_IDS"); datasetIDs != "" {
+		cfg.DifyDatasetIDs = splitList(datasetIDs)
+	}
+	if adminToken := os.Getenv("ADMIN_TOKEN"); adminToken != "" {
+		cfg.AdminToken = adminToken
+	}
+	if actionRegistryFile := os.Getenv("ACTION_REGISTRY_FILE"); actionRegistryFile != "" {
+		cfg.ActionRegistryFile = actionRegistryFile
+	}
+	if fallbackEnabled := os.Getenv("ANSWER_FALLBACK_ENABLED"); fallbackEnabled != "" {
+		if enabled, err := strconv.ParseBool(fallbackEnabled); err == nil {
+			cfg.AnswerFallbackEnabled = enabled
+		}
+	}
+	if fallbackGesture := os.Getenv("ANSWER_FALLBACK_GESTURE"); fallbackGesture != "" {
+		cfg.AnswerFallbackGesture = fallbackGesture
+	}
+	if repairAttempts := os.Getenv("ANSWER_REPAIR_ATTEMPTS"); repairAttempts != "" {
+		if attempts, err := strconv.Atoi(repairAttempts); err == nil {
+			cfg.AnswerRepairAttempts = attempts
+		}
+	}
+	if repairTimeout := os.Getenv("ANSWER_REPAIR_TIMEOUT"); repairTimeout != "" {
+		if timeout, err := time.ParseDuration(repairTimeout); err == nil {
+			cfg.AnswerRepairTimeout = timeout
+		}
+	}
+	if repairAPIKey := os.Getenv("ANSWER_REPAIR_API_KEY"); repairAPIKey != "" {
+		cfg.AnswerRepairAPIKey = repairAPIKey
+	}
+	if sameConversation := os.Getenv("ANSWER_REPAIR_SAME_CONVERSATION"); sameConversation != "" {
+		if enabled, err := strconv.ParseBool(sameConversation); err == nil {
+			cfg.AnswerRepairSameConversation = enabled
+		}
+	}
+	if paramsFormat := os.Getenv("PARAMS_FORMAT"); paramsFormat != "" {
+		cfg.ParamsFormat = paramsFormat
+	}
+	if delayMode := os.Getenv("TIMELINE_DELAY_MODE"); delayMode != "" {
+		cfg.TimelineDelayMode = delayMode
+	}
+	if profilesFile := os.Getenv("DEVICE_PROFILES_FILE"); profilesFile != "" {
+		cfg.DeviceProfilesFile = profilesFile
+	}
+	if stopToken := os.Getenv("EMERGENCY_STOP_TOKEN"); stopToken != "" {
+		cfg.EmergencyStopToken = stopToken
+	}
+	if cfg.EmergencyStopToken == "" {
+		cfg.EmergencyStopToken = cfg.AdminToken
+	}
+	if deviceTokens := os.Getenv("DEVICE_TOKENS"); deviceTokens != "" {
+		cfg.DeviceTokens = parsePairs(deviceTokens)
+	}
+	if algorithm := os.Getenv("RATE_LIMIT_ALGORITHM"); algorithm != "" {
+		cfg.RateLimitAlgorithm = algorithm
+	}
+	if requests := os.Getenv("RATE_LIMIT_REQUESTS"); requests != "" {
+		if n, err := strconv.Atoi(requests); err == nil {
+			cfg.RateLimitRequests = n
+		}
+	}
+	if window := os.Getenv("RATE_LIMIT_WINDOW"); window != "" {
+		if d, err := time.ParseDuration(window); err == nil {
+			cfg.RateLimitWindow = d
+		}
+	}
+	if burst := os.Getenv("RATE_LIMIT_BURST"); burst != "" {
+		if n, err := strconv.Atoi(burst); err == nil {
+			cfg.RateLimitBurst = n
+		}
+	}
+	if policiesFile := os.Getenv("RATE_LIMIT_POLICIES_FILE"); policiesFile != "" {
+		cfg.RateLimitPoliciesFile = policiesFile
+	}
+	if followUps := os.Getenv("CACHE_FOLLOW_UPS"); followUps != "" {
+		if enabled, err := strconv.ParseBool(followUps); err == nil {
+			cfg.CacheFollowUps = enabled
+		}
+	}
+	if intentInput := os.Getenv("CACHE_INTENT_INPUT"); intentInput != "" {
+		cfg.CacheIntentInput = intentInput
+	}
+	if intents := os.Getenv("CACHE_INTENTS"); intents != "" {
+		cfg.CacheIntents = splitList(intents)
+	}
+	if steps := os.Getenv("QUERY_NORMALIZATION"); steps != "" {
+		cfg.QueryNormalization = splitList(steps)
+		if strings.EqualFold(steps, "none") {
+			cfg.QueryNormalization = []string{}
+		}
+	}
+	if ttl := os.Getenv("CACHE_TTL"); ttl != "" {
+		if d, err := time.ParseDuration(ttl); err == nil {
+			cfg.CacheTTL = d
+		}
+	}
+	if classTTLs := os.Getenv("CACHE_CLASS_TTLS"); classTTLs != "" {
+		cfg.CacheClassTTLs = parseDurations(classTTLs)
+	}
+	if fillers := os.Getenv("QUERY_FILLERS"); fillers != "" {
+		cfg.QueryFillers = splitList(fillers)
+	}
+	if similarEnabled := os.Getenv("SIMILAR_CACHE_ENABLED"); similarEnabled != "" {
+		if enabled, err := strconv.ParseBool(similarEnabled); err == nil {
+			cfg.SimilarCacheEnabled = enabled
+		}
+	}
+	if threshold := os.Getenv("SIMILAR_CACHE_THRESHOLD"); threshold != "" {
+		if value, err := strconv.ParseFloat(threshold, 64); err == nil {
+			cfg.SimilarCacheThreshold = value
+		}
+	}
+	if maxEntries := os.Getenv("SIMILAR_CACHE_MAX_ENTRIES"); maxEntries != "" {
+		if n, err := strconv.Atoi(maxEntries); err == nil {
+			cfg.SimilarCacheMaxEntries = n
+		}
+	}
+	if lockTTL := os.Getenv("COMPLETION_LOCK_TTL"); lockTTL != "" {
+		if d, err := time.ParseDuration(lockTTL); err == nil {
+			cfg.CompletionLockTTL = d
+		}
+	}
+	if waitTimeout := os.Getenv("COMPLETION_WAIT_TIMEOUT"); waitTimeout != "" {
+		if d, err := time.ParseDuration(waitTimeout); err == nil {
+			cfg.CompletionWaitTimeout = d
+		}
+	}
 
 	return cfg, nil
 }
+
+// splitList 解析逗号分隔的配置项，忽略空白元素
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parsePairs 解析 name=value 逗号分隔的配置项，忽略没有值的元素
+func parsePairs(value string) map[string]string {
+	pairs := make(map[string]string)
+	for _, item := range splitList(value) {
+		name, raw, ok := strings.Cut(item, "=")
+		if name, raw = strings.TrimSpace(name), strings.TrimSpace(raw); ok && name != "" && raw != "" {
+			pairs[name] = raw
+		}
+	}
+	return pairs
+}
+
+// parseDurations 解析 name=duration 逗号分隔的配置项，忽略无法解析的元素
+func parseDurations(value string) map[string]time.Duration {
+	durations := make(map[string]time.Duration)
+	for _, item := range splitList(value) {
+		name, raw, ok := strings.Cut(item, "=")
+		if !ok {
+			continue
+		}
+		if d, err := time.ParseDuration(strings.TrimSpace(raw)); err == nil {
+			durations[strings.TrimSpace(name)] = d
+		}
+	}
+	return durations
+}
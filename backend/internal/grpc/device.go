@@ -0,0 +1,124 @@
+package grpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ai-generation/api/proto"
+	"github.com/ai-generation/internal/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// DeviceHub 定义了设备中心的接口
+type DeviceHub interface {
+	EmergencyStop(ctx context.Context, req *types.EmergencyStopRequest, actor string) *types.EmergencyStopResult
+	Serve(ctx context.Context, deviceID string, send func(cmd *types.DeviceCommand) error) error
+}
+
+// EmergencyStop 实现急停接口，令牌与HTTP接口相同，通过metadata传递
+func (s *Server) EmergencyStop(ctx context.Context, req *proto.EmergencyStopRequest) (*proto.CompletionResponse, error) {
+	if s.deviceHub == nil {
+		return nil, status.Error(codes.Unimplemented, "emergency stop is not configured")
+	}
+	actor, err := s.authorizeStop(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.deviceHub.EmergencyStop(ctx, &types.EmergencyStopRequest{DeviceIDs: req.DeviceIds, Reason: req.Reason}, actor)
+	value, err := jsonValue(result)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "convert result: %v", err)
+	}
+	data, err := structpb.NewValue(value)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "convert result: %v", err)
+	}
+	return &proto.CompletionResponse{
+		Code: wrapperspb.Int32(200),
+		Msg:  wrapperspb.String("success"),
+		Data: data,
+	}, nil
+}
+
+// authorizeStop 校验 authorization: Bearer <token>，x-admin-user 记录操作人
+func (s *Server) authorizeStop(ctx context.Context) (string, error) {
+	if s.stopToken == "" {
+		return "", status.Error(codes.Unavailable, "emergency stop is disabled")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if !validToken(md, s.stopToken) {
+		return "", status.Error(codes.Unauthenticated, "invalid admin token")
+	}
+	actor := "admin"
+	if values := md.Get("x-admin-user"); len(values) > 0 && values[0] != "" {
+		actor = values[0]
+	}
+	return actor, nil
+}
+
+// authorizeDevice 校验机器人的凭证 authorization: Bearer <设备令牌>
+func (s *Server) authorizeDevice(ctx context.Context, deviceID string) error {
+	expected, ok := s.deviceTokens[deviceID]
+	if !ok || expected == "" {
+		return status.Errorf(codes.PermissionDenied, "device %s has no credential", deviceID)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if !validToken(md, expected) {
+		return status.Error(codes.Unauthenticated, "invalid device token")
+	}
+	return nil
+}
+
+// validToken 以常量时间比较metadata中的Bearer令牌
+func validToken(md metadata.MD, expected string) bool {
+	var token string
+	if values := md.Get("authorization"); len(values) > 0 {
+		token = strings.TrimPrefix(values[0], "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// SubscribeCommands 实现机器人指令订阅，需要该设备的凭证，连接断开时结束。
+// 同一设备重复订阅时旧的订阅保留到其连接结束，期间急停同时下发给新旧订阅
+func (s *Server) SubscribeCommands(req *proto.SubscribeCommandsRequest, stream proto.CompletionService_SubscribeCommandsServer) error {
+	if s.deviceHub == nil {
+		return status.Error(codes.Unimplemented, "device commands are not configured")
+	}
+	if req.DeviceId == "" {
+		return status.Error(codes.InvalidArgument, "device_id is required")
+	}
+	if err := s.authorizeDevice(stream.Context(), req.DeviceId); err != nil {
+		return err
+	}
+
+	err := s.deviceHub.Serve(stream.Context(), req.DeviceId, func(cmd *types.DeviceCommand) error {
+		out := &proto.DeviceCommand{
+			Id:        cmd.ID,
+			DeviceId:  cmd.DeviceID,
+			Type:      cmd.Type,
+			Priority:  int32(cmd.Priority),
+			Reason:    cmd.Reason,
+			CreatedAt: cmd.CreatedAt,
+		}
+		if cmd.Data != nil {
+			value, err := structpb.NewValue(completionDataMap(cmd.Data))
+			if err != nil {
+				return fmt.Errorf("convert data: %w", err)
+			}
+			out.Data = value
+		}
+		return stream.Send(out)
+	})
+	if stream.Context().Err() != nil || errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
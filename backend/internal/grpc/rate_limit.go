@@ -0,0 +1,53 @@
+package grpc
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ai-generation/internal/types"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// fillClientIdentity 从metadata(x-tenant-id、x-api-key)和对端地址填写限流使用的身份
+func fillClientIdentity(ctx context.Context, req *types.CompletionRequest) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-tenant-id"); len(values) > 0 {
+		req.Tenant = strings.TrimSpace(values[0])
+	}
+	if values := md.Get("x-api-key"); len(values) > 0 {
+		req.APIKey = strings.TrimSpace(values[0])
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr := p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+		req.ClientIP = addr
+	}
+}
+
+// rateLimitTrailer 把限流状态转换为trailer，键名与HTTP响应头一致（小写）
+func rateLimitTrailer(status *types.RateLimitStatus) metadata.MD {
+	if status == nil {
+		return nil
+	}
+	md := metadata.Pairs(
+		"x-ratelimit-limit", strconv.Itoa(status.Limit),
+		"x-ratelimit-remaining", strconv.Itoa(status.Remaining),
+		"x-ratelimit-reset", strconv.Itoa(ceilSeconds(status.Reset)),
+		"x-ratelimit-policy", status.Policy,
+	)
+	if !status.Allowed {
+		md.Set("retry-after", strconv.Itoa(ceilSeconds(status.RetryAfter)))
+	}
+	return md
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
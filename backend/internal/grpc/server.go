@@ -2,11 +2,13 @@ package grpc
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 
 	"github.com/ai-generation/api/proto"
 	"github.com/ai-generation/internal/types"
+	grpclib "google.golang.org/grpc"
 	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
@@ -15,16 +17,21 @@ import (
 type Server struct {
 	proto.UnimplementedCompletionServiceServer
 	aiService AIService
+	deviceHub DeviceHub
+	stopToken string
+	// deviceTokens 机器人订阅指令的凭证，设备ID到令牌
+	deviceTokens map[string]string
 }
 
 // AIService 定义了AI服务的接口
 type AIService interface {
 	GetCompletion(req *types.CompletionRequest) (*types.CompletionResponse, error)
+	StreamCompletion(ctx context.Context, req *types.CompletionRequest, emit func(event *types.StreamEvent) error) error
 }
 
-// NewServer 创建新的gRPC服务器实例
-func NewServer(aiService AIService) *Server {
-	return &Server{aiService: aiService}
+// NewServer 创建新的gRPC服务器实例，deviceHub为nil时不提供急停和指令订阅
+func NewServer(aiService AIService, deviceHub DeviceHub, stopToken string, deviceTokens map[string]string) *Server {
+	return &Server{aiService: aiService, deviceHub: deviceHub, stopToken: stopToken, deviceTokens: deviceTokens}
 }
 
 // GetCompletion 实现gRPC服务接口
@@ -40,13 +47,22 @@ func (s *Server) GetCompletion(ctx context.Context, req *proto.CompletionRequest
 
 	// 转换请求格式
 	internalReq := &types.CompletionRequest{
-		Query:        req.Query,
-		Inputs:       req.Inputs,
-		User:         req.User,
-		ResponseMode: req.GetResponseMode(),
+		Query:          req.Query,
+		Inputs:         req.Inputs,
+		User:           req.User,
+		ResponseMode:   req.GetResponseMode(),
+		ParamsFormat:   req.GetParamsFormat(),
+		DeviceType:     req.GetDeviceType(),
+		DeviceID:       req.GetDeviceId(),
+		ConversationID: req.GetConversationId(),
+		Cache:          req.GetCache(),
 	}
+	fillClientIdentity(ctx, internalReq)
 	// 调用内部服务
 	resp, err := s.aiService.GetCompletion(internalReq)
+	if trailer := rateLimitTrailer(internalReq.RateLimit); trailer != nil {
+		grpclib.SetTrailer(ctx, trailer)
+	}
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "internal service error: %v\n", err)
@@ -92,21 +108,7 @@ func (s *Server) GetCompletion(ctx context.Context, req *proto.CompletionRequest
 	}
 
 	// 将 CompletionOptimizeData 转换为 map
-	dataMap := make(map[string]interface{})
-	dataMap["content"] = resp.Data.Content
-
-	// 转换functions数组
-	functions := make([]interface{}, len(resp.Data.Functions))
-	for i, f := range resp.Data.Functions {
-		functionMap := make(map[string]interface{})
-		functionMap["action"] = f.Action
-		functionMap["delay"] = float64(f.Delay)
-		if f.Params != "" {
-			functionMap["params"] = f.Params
-		}
-		functions[i] = functionMap
-	}
-	dataMap["functions"] = functions
+	dataMap := completionDataMap(resp.Data)
 
 	// 将map转换为proto.Struct
 	answerStruct, err := structpb.NewStruct(dataMap)
@@ -125,3 +127,146 @@ func (s *Server) GetCompletion(ctx context.Context, req *proto.CompletionRequest
 		Data: structpb.NewStructValue(answerStruct),
 	}, nil
 }
+
+// StreamCompletion 实现流式gRPC接口，每个内部事件对应一条CompletionStreamEvent
+func (s *Server) StreamCompletion(req *proto.CompletionRequest, stream proto.CompletionService_StreamCompletionServer) error {
+	internalReq := &types.CompletionRequest{
+		Query:          req.Query,
+		Inputs:         req.Inputs,
+		User:           req.User,
+		ResponseMode:   "streaming",
+		ParamsFormat:   req.GetParamsFormat(),
+		DeviceType:     req.GetDeviceType(),
+		DeviceID:       req.GetDeviceId(),
+		ConversationID: req.GetConversationId(),
+		Cache:          req.GetCache(),
+	}
+	fillClientIdentity(stream.Context(), internalReq)
+	defer func() {
+		if trailer := rateLimitTrailer(internalReq.RateLimit); trailer != nil {
+			stream.SetTrailer(trailer)
+		}
+	}()
+
+	return s.aiService.StreamCompletion(stream.Context(), internalReq, func(event *types.StreamEvent) error {
+		out := &proto.CompletionStreamEvent{
+			Event: event.Event,
+			Delta: event.Delta,
+			Index: int32(event.Index),
+		}
+		if event.Function != nil {
+			value, err := structpb.NewValue(functionMap(*event.Function))
+			if err != nil {
+				return fmt.Errorf("convert function: %w", err)
+			}
+			out.Function = value
+		}
+		if event.Diagnostic != nil {
+			value, err := structpb.NewValue(diagnosticMap(*event.Diagnostic))
+			if err != nil {
+				return fmt.Errorf("convert diagnostic: %w", err)
+			}
+			out.Diagnostic = value
+		}
+		if event.Data != nil {
+			value, err := structpb.NewValue(completionDataMap(event.Data))
+			if err != nil {
+				return fmt.Errorf("convert data: %w", err)
+			}
+			out.Data = value
+		}
+		if event.Code != 0 {
+			out.Code = wrapperspb.Int32(int32(event.Code))
+		}
+		if event.Msg != "" {
+			out.Msg = wrapperspb.String(event.Msg)
+		}
+		return stream.Send(out)
+	})
+}
+
+// completionDataMap 将 CompletionOptimizeData 转换为可以放入structpb的map
+func completionDataMap(data *types.CompletionOptimizeData) map[string]interface{} {
+	dataMap := make(map[string]interface{})
+	dataMap["content"] = data.Content
+
+	// 转换functions数组
+	functions := make([]interface{}, len(data.Functions))
+	for i, f := range data.Functions {
+		functions[i] = functionMap(f)
+	}
+	dataMap["functions"] = functions
+
+	if data.DegradedFormat {
+		dataMap["degraded_format"] = true
+	}
+
+	if len(data.Diagnostics) > 0 {
+		diagnostics := make([]interface{}, len(data.Diagnostics))
+		for i, d := range data.Diagnostics {
+			diagnostics[i] = diagnosticMap(d)
+		}
+		dataMap["diagnostics"] = diagnostics
+	}
+
+	if data.DeviceType != "" {
+		dataMap["device_type"] = data.DeviceType
+	}
+
+	if data.ConversationID != "" {
+		dataMap["conversation_id"] = data.ConversationID
+	}
+
+	if data.Cache != nil {
+		cache := map[string]interface{}{
+			"match": data.Cache.Match,
+			"score": data.Cache.Score,
+		}
+		if data.Cache.Query != "" {
+			cache["query"] = data.Cache.Query
+		}
+		dataMap["cache"] = cache
+	}
+
+	if data.Timeline != nil {
+		if timeline, err := jsonValue(data.Timeline); err == nil {
+			dataMap["timeline"] = timeline
+		} else {
+			fmt.Fprintf(os.Stderr, "failed to convert timeline: %v\n", err)
+		}
+	}
+	return dataMap
+}
+
+func functionMap(f types.CompletionFunctions) map[string]interface{} {
+	functionMap := make(map[string]interface{})
+	functionMap["action"] = f.Action
+	functionMap["delay"] = float64(f.Delay)
+	if f.Params != nil {
+		functionMap["params"] = f.Params
+	}
+	return functionMap
+}
+
+func diagnosticMap(d types.Diagnostic) map[string]interface{} {
+	return map[string]interface{}{
+		"index":    float64(d.Index),
+		"action":   d.Action,
+		"code":     d.Code,
+		"severity": d.Severity,
+		"message":  d.Message,
+	}
+}
+
+// jsonValue 经JSON编解码把结构体转换为structpb可以接受的通用值
+func jsonValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
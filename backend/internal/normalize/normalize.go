@@ -0,0 +1,161 @@
+// Package normalize 在查询缓存前规范化访客的提问：统一全角半角、大小写和繁简体，
+// 去掉口头语、标点和空白，使说法略有不同的相同问题命中同一条缓存。
+package normalize
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// 规范化步骤，按下面的顺序执行
+const (
+	// StepNFKC Unicode NFKC：全角字母数字转半角，兼容字符转标准形式
+	StepNFKC = "nfkc"
+	// StepLowercase 英文字母转小写
+	StepLowercase = "lowercase"
+	// StepSimplified 繁体字转简体字
+	StepSimplified = "simplified"
+	// StepFillers 去掉句首和分句开头单独成句的口头语
+	StepFillers = "fillers"
+	// StepPunctuation 去掉标点、符号和空白，保留数学符号和数字之间的标点
+	StepPunctuation = "punctuation"
+)
+
+// DefaultSteps 默认启用全部步骤
+var DefaultSteps = []string{StepNFKC, StepLowercase, StepSimplified, StepFillers, StepPunctuation}
+
+// DefaultFillers 默认的口头语，按简体字书写。不包含常作为词语开头的字（如“额度”的“额”）
+// 和本身可以是问题的说法（如“你好”）
+var DefaultFillers = []string{"请问一下", "请问", "那个", "这个这个", "就是说", "就是", "麻烦问一下", "麻烦你", "麻烦", "嗯", "呃", "啊", "哎", "哦", "喂"}
+
+// Normalizer 按配置的步骤规范化查询，可并发使用
+type Normalizer struct {
+	nfkc        bool
+	lowercase   bool
+	simplified  bool
+	punctuation bool
+	fillers     []string
+}
+
+// New 创建规范化器，steps 为空时不做任何处理，fillers 为nil时使用 DefaultFillers
+func New(steps []string, fillers []string) (*Normalizer, error) {
+	n := &Normalizer{}
+	for _, step := range steps {
+		switch strings.ToLower(strings.TrimSpace(step)) {
+		case StepNFKC:
+			n.nfkc = true
+		case StepLowercase:
+			n.lowercase = true
+		case StepSimplified:
+			n.simplified = true
+		case StepFillers:
+			if fillers == nil {
+				fillers = DefaultFillers
+			}
+			n.fillers = fillers
+		case StepPunctuation:
+			n.punctuation = true
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown normalization step %q", step)
+		}
+	}
+	return n, nil
+}
+
+// Normalize 返回规范化后的查询；全部内容都被去掉时（如只有标点）返回去掉首尾空白的原查询
+func (n *Normalizer) Normalize(query string) string {
+	original := strings.TrimSpace(query)
+	if n == nil {
+		return original
+	}
+	if n.nfkc {
+		query = norm.NFKC.String(query)
+	}
+	if n.lowercase {
+		query = strings.ToLower(query)
+	}
+	if n.simplified {
+		query = strings.Map(func(r rune) rune {
+			if s, ok := t2s[r]; ok {
+				return s
+			}
+			return r
+		}, query)
+	}
+	if len(n.fillers) > 0 {
+		query = n.removeFillers(query)
+	}
+	if n.punctuation {
+		query = removePunctuation(query)
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return original
+	}
+	return query
+}
+
+// removePunctuation 去掉标点、符号和空白。数学符号（Unicode Sm，如 + = < >）是问题的一部分，保留；
+// 数字之间的标点（小数点、时间的冒号、减号、斜杠）也保留，否则“1+1等于几”和“11等于几”、“1.5”和“15”会得到相同的缓存键
+func removePunctuation(query string) string {
+	runes := []rune(query)
+	var b strings.Builder
+	for i, r := range runes {
+		switch {
+		case unicode.IsSpace(r):
+			continue
+		case unicode.Is(unicode.Sm, r):
+		case unicode.IsPunct(r):
+			if i == 0 || i+1 == len(runes) || !unicode.IsDigit(runes[i-1]) || !unicode.IsDigit(runes[i+1]) {
+				continue
+			}
+		case unicode.IsSymbol(r):
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// removeFillers 去掉句首和每个分句（标点或空白之后）开头单独成句的口头语，
+// 即口头语之后紧跟标点、空白或查询结束，如“请问，”“嗯那个 ”；
+// 后面直接跟着其他字时是词语的一部分（“那个是什么”“请问展厅几点开门”），保留不动
+func (n *Normalizer) removeFillers(query string) string {
+	var b strings.Builder
+	atStart := true
+	for i := 0; i < len(query); {
+		if atStart {
+			if size := n.fillerClause(query[i:]); size > 0 {
+				i += size
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(query[i:])
+		b.WriteString(query[i : i+size])
+		atStart = unicode.IsPunct(r) || unicode.IsSpace(r)
+		i += size
+	}
+	return b.String()
+}
+
+// fillerClause 返回s开头由一个或连续多个口头语组成、之后是分句边界的最长前缀的字节数，没有时返回0
+func (n *Normalizer) fillerClause(s string) int {
+	longest := 0
+	for _, filler := range n.fillers {
+		if filler == "" || len(filler) <= longest || !strings.HasPrefix(s, filler) {
+			continue
+		}
+		rest := s[len(filler):]
+		if r, _ := utf8.DecodeRuneInString(rest); rest == "" || unicode.IsPunct(r) || unicode.IsSpace(r) {
+			longest = len(filler)
+		} else if size := n.fillerClause(rest); size > 0 && len(filler)+size > longest {
+			longest = len(filler) + size
+		}
+	}
+	return longest
+}
@@ -0,0 +1,44 @@
+package normalize
+
+// t2sPairs 常用繁体字到简体字的对照，每两个字符为一组：繁体、简体。
+// 只收录访客提问中常见的字，不追求完整；一对多的情况取最常用的简体字
+const t2sPairs = "" +
+	"個个們们這这來来時时會会說说對对為为國国學学發发後后經经還还麼么點点電电開开關关" +
+	"問问題题樣样東东車车長长門门見见親亲現现實实體体機机動动畫画話话語语請请謝谢讓让" +
+	"記记認认識识讀读寫写聽听講讲論论誰谁調调該该課课變变邊边過过進进運运達达遠远選选" +
+	"遺遗館馆飯饭馬马魚鱼鳥鸟龍龙龜龟島岛風风飛飞雲云氣气歲岁歷历曆历區区醫医華华萬万" +
+	"與与產产業业廠厂廣广應应從从眾众價价傳传億亿優优儀仪兒儿內内兩两劃划劇剧務务勞劳" +
+	"勝胜協协單单壓压報报場场塊块壯壮聲声處处備备夠够頭头夢梦奮奋媽妈嗎吗嘗尝團团園园" +
+	"圖图圓圆專专將将導导層层屬属師师帶带幫帮幹干幾几庫库廳厅張张彈弹強强當当錄录徑径" +
+	"復复愛爱憶忆戰战戲戏擊击據据擇择數数斷断無无舊旧書书條条極极構构標标樂乐樓楼歡欢" +
+	"歸归殺杀漢汉湯汤滿满溫温燈灯熱热爾尔牆墙獎奖獨独環环療疗盡尽監监盤盘確确礎础禮礼" +
+	"種种稱称穩稳積积窮穷節节範范簡简類类糧粮紀纪約约紅红級级細细組组結结給给統统絲丝" +
+	"綠绿維维網网線线練练總总績绩續续義义習习聯联聖圣職职腦脑臉脸興兴舉举艦舰藝艺蘋苹" +
+	"號号蟲虫術术衛卫裝装複复襲袭規规視视覺觉觀观計计訊讯許许設设試试詩诗詞词誤误談谈" +
+	"證证議议護护貓猫貝贝負负財财責责貨货質质費费資资賽赛趕赶趙赵躍跃軍军軟软轉转輕轻" +
+	"輪轮辦办農农連连週周遊游遞递郵邮鄉乡釋释針针鐘钟錢钱鐵铁銀银錯错閉闭間间閱阅隊队" +
+	"陽阳陰阴際际隨随險险隻只雖虽雙双雞鸡難难雜杂離离靜静響响頁页順顺須须預预領领顏颜" +
+	"願愿顯显飲饮驗验髮发鬥斗魯鲁鮮鲜鹽盐麗丽黃黄齊齐齒齿勢势參参廟庙鍵键陳陈劉刘楊杨" +
+	"吳吴鄭郑韓韩馮冯葉叶蘇苏盧卢蔣蒋帥帅鎮镇權权縣县爭争員员貴贵買买賣卖讚赞係系倆俩" +
+	"倉仓偉伟側侧傘伞傷伤僅仅儲储兇凶凍冻別别剛刚創创劍剑勁劲勵励卻却厲厉啟启喚唤嚇吓" +
+	"嚴严囑嘱圍围執执堅坚壞坏壽寿奪夺奧奥婦妇孫孙寧宁寶宝審审寬宽寵宠尋寻屆届岡冈嶺岭" +
+	"巖岩幣币廢废彎弯徵征態态慣惯懷怀懶懒戶户拋抛掛挂掃扫換换揚扬損损搖摇擁拥擔担擬拟" +
+	"擴扩攝摄敵敌曉晓暫暂曬晒棄弃檢检櫃柜歐欧殘残決决沒没況况淚泪淨净淺浅測测濟济濕湿" +
+	"灣湾災灾烏乌煙烟爐炉犧牺狀状猶犹獅狮獲获瑪玛畢毕異异疊叠瘋疯皺皱盜盗碼码祕秘禍祸" +
+	"稅税競竞筆笔築筑簽签籃篮紙纸紛纷納纳純纯緊紧編编緣缘縮缩織织繼继罰罚羅罗聞闻肅肃" +
+	"脫脱腳脚膽胆臨临艱艰莊庄蓋盖蘭兰虛虚衝冲補补製制褲裤覽览訂订訓训託托訪访評评詢询" +
+	"詳详誌志誕诞諾诺謀谋譯译豐丰豬猪貞贞敗败販贩貪贪貫贯購购賀贺賴赖贈赠趨趋蹤踪軌轨" +
+	"較较載载輔辅輸输遲迟醜丑釣钓鈴铃鉛铅銅铜鋼钢錶表鍋锅鏡镜閃闪閒闲陣阵陸陆隱隐霧雾" +
+	"靈灵韋韦頂顶項项頓顿頻频額额顧顾飄飘餘余駐驻騎骑驚惊骯肮鬆松鳳凤鴨鸭麥麦黨党齡龄" +
+	"蝦虾儘尽麵面燒烧慶庆藥药鑰钥櫥橱藍蓝鏈链漁渔貿贸亞亚鵝鹅獸兽礦矿爺爷孃娘謎谜聰聪" +
+	"穎颖嶄崭漸渐濱滨滅灭滾滚滯滞潔洁潛潜澤泽濃浓瀏浏灑洒" +
+	"裡里裏里廁厕嗚呜噹当歎叹燭烛嬰婴屍尸壩坝彙汇滬沪臺台颱台甦苏"
+
+var t2s = func() map[rune]rune {
+	runes := []rune(t2sPairs)
+	table := make(map[rune]rune, len(runes)/2)
+	for i := 0; i+1 < len(runes); i += 2 {
+		table[runes[i]] = runes[i+1]
+	}
+	return table
+}()
@@ -0,0 +1,128 @@
+package preview
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"unicode/utf8"
+
+	"github.com/ai-generation/internal/types"
+)
+
+// SVG布局，单位为像素
+const (
+	svgWidth     = 960
+	labelWidth   = 120
+	axisHeight   = 28
+	laneHeight   = 32
+	barHeight    = 22
+	chartPadding = 12
+	minBarWidth  = 3
+)
+
+// palette 动作颜色，同一动作在不同图中颜色一致
+var palette = []string{"#42a5f5", "#66bb6a", "#ffa726", "#ab47bc", "#26c6da", "#8d6e63", "#ec407a", "#78909c"}
+
+// SVG 把泳道模型绘制为甘特图：每个执行器一行，冲突的动作描红，语音显示文本，鼠标悬停显示详情
+func SVG(p *types.TimelinePreview) []byte {
+	duration := p.Duration
+	if duration <= 0 {
+		duration = 1000
+	}
+	chartWidth := float64(svgWidth - labelWidth - 2*chartPadding)
+	x := func(t int) float64 {
+		return float64(labelWidth+chartPadding) + float64(t)/float64(duration)*chartWidth
+	}
+	height := axisHeight + len(p.Lanes)*laneHeight + chartPadding
+	if len(p.Lanes) == 0 {
+		height += laneHeight
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`, svgWidth, height, svgWidth, height)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#ffffff"/>`, svgWidth, height)
+
+	// 时间轴与网格线
+	step := tickStep(duration)
+	for t := 0; t <= duration; t += step {
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#e0e0e0"/>`, x(t), axisHeight-6, x(t), height-chartPadding)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle" fill="#757575">%s</text>`, x(t), axisHeight-10, formatTime(t))
+	}
+
+	if len(p.Lanes) == 0 {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" fill="#9e9e9e">no actions</text>`, svgWidth/2, axisHeight+laneHeight/2+4)
+	}
+	for i, lane := range p.Lanes {
+		top := axisHeight + i*laneHeight
+		if i%2 == 1 {
+			fmt.Fprintf(&b, `<rect x="0" y="%d" width="%d" height="%d" fill="#fafafa"/>`, top, svgWidth, laneHeight)
+		}
+		fmt.Fprintf(&b, `<text x="%d" y="%d" fill="#424242">%s</text>`, chartPadding, top+laneHeight/2+4, escape(lane.Actuator))
+
+		barTop := top + (laneHeight-barHeight)/2
+		for _, span := range lane.Spans {
+			left := x(span.Start)
+			width := x(span.End) - left
+			if width < minBarWidth {
+				width = minBarWidth
+			}
+			stroke := "none"
+			if span.Conflict {
+				stroke = "#d32f2f"
+			}
+			title := fmt.Sprintf("#%d %s %d-%dms", span.Index, span.Action, span.Start, span.End)
+			if span.Label != "" {
+				title += " " + span.Label
+			}
+			fmt.Fprintf(&b, `<g><title>%s</title>`, escape(title))
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%d" width="%.1f" height="%d" rx="3" fill="%s" fill-opacity="0.85" stroke="%s" stroke-width="2"/>`,
+				left, barTop, width, barHeight, actionColor(span.Action), stroke)
+			text := span.Action
+			if span.Label != "" {
+				text = span.Label
+			}
+			// 按每个字符约7像素截断，放不下时只保留悬停提示
+			if maxChars := int(width-8) / 7; maxChars >= 2 {
+				fmt.Fprintf(&b, `<text x="%.1f" y="%d" fill="#ffffff">%s</text>`, left+4, barTop+barHeight/2+4, escape(truncate(text, maxChars)))
+			}
+			b.WriteString(`</g>`)
+		}
+	}
+	b.WriteString(`</svg>`)
+	return b.Bytes()
+}
+
+// tickStep 选择让刻度数量在10个左右的整齐间隔
+func tickStep(duration int) int {
+	for _, step := range []int{100, 200, 250, 500, 1000, 2000, 5000, 10000, 30000, 60000} {
+		if duration/step <= 10 {
+			return step
+		}
+	}
+	return 60000
+}
+
+func formatTime(ms int) string {
+	return fmt.Sprintf("%gs", float64(ms)/1000)
+}
+
+func actionColor(action string) string {
+	h := fnv.New32a()
+	h.Write([]byte(action))
+	return palette[h.Sum32()%uint32(len(palette))]
+}
+
+func truncate(text string, maxChars int) string {
+	if utf8.RuneCountInString(text) <= maxChars {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:maxChars-1]) + "…"
+}
+
+func escape(text string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
@@ -0,0 +1,130 @@
+// Package preview 把编译好的时间线转换为泳道模型，并绘制成SVG甘特图，供管理后台查看动作编排。
+package preview
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ai-generation/internal/types"
+)
+
+// LaneOther 不占用执行器的动作所在的泳道
+const LaneOther = "other"
+
+// laneOrder 常见执行器的显示顺序，其余按名称排在后面
+var laneOrder = map[string]int{
+	"speaker":   0,
+	"head":      1,
+	"left_arm":  2,
+	"right_arm": 3,
+	"led":       4,
+}
+
+// Lanes 按执行器把时间线拆成泳道。data.Timeline 必须与 data.Functions 一一对应
+func Lanes(data *types.CompletionOptimizeData) *types.TimelinePreview {
+	result := &types.TimelinePreview{
+		DeviceType:  data.DeviceType,
+		Content:     data.Content,
+		Lanes:       []types.TimelineLane{},
+		Diagnostics: data.Diagnostics,
+	}
+	timeline := data.Timeline
+	if timeline == nil {
+		return result
+	}
+	result.DelayMode = timeline.DelayMode
+	result.Duration = timeline.Duration
+	result.Conflicts = timeline.Conflicts
+
+	conflicted := make(map[string]map[int]bool)
+	for _, c := range timeline.Conflicts {
+		if conflicted[c.Actuator] == nil {
+			conflicted[c.Actuator] = make(map[int]bool)
+		}
+		conflicted[c.Actuator][c.First] = true
+		conflicted[c.Actuator][c.Second] = true
+	}
+
+	lanes := make(map[string]*types.TimelineLane)
+	var names []string
+	for _, entry := range timeline.Entries {
+		actuators := entry.Actuators
+		if len(actuators) == 0 {
+			actuators = []string{LaneOther}
+		}
+		var label string
+		if entry.Index >= 0 && entry.Index < len(data.Functions) {
+			label = textLabel(data.Functions[entry.Index].Params)
+		}
+		for _, actuator := range actuators {
+			lane, ok := lanes[actuator]
+			if !ok {
+				lane = &types.TimelineLane{Actuator: actuator}
+				lanes[actuator] = lane
+				names = append(names, actuator)
+			}
+			lane.Spans = append(lane.Spans, types.TimelineSpan{
+				Index:    entry.Index,
+				Action:   entry.Action,
+				Start:    entry.Start,
+				End:      entry.End,
+				Label:    label,
+				Conflict: conflicted[actuator][entry.Index],
+			})
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool { return laneLess(names[i], names[j]) })
+	for _, name := range names {
+		lane := lanes[name]
+		sort.SliceStable(lane.Spans, func(i, j int) bool { return lane.Spans[i].Start < lane.Spans[j].Start })
+		result.Lanes = append(result.Lanes, *lane)
+	}
+	return result
+}
+
+// laneLess 常见执行器在前，舵机按编号排序，other 在最后
+func laneLess(a, b string) bool {
+	rank := func(name string) int {
+		if r, ok := laneOrder[name]; ok {
+			return r
+		}
+		if name == LaneOther {
+			return 1000
+		}
+		return 100
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra < rb
+	}
+	na, okA := actuatorNumber(a)
+	nb, okB := actuatorNumber(b)
+	if okA && okB && strings.SplitN(a, ":", 2)[0] == strings.SplitN(b, ":", 2)[0] {
+		return na < nb
+	}
+	return a < b
+}
+
+// actuatorNumber 解析 servo:3 这类执行器的编号
+func actuatorNumber(name string) (int, bool) {
+	i := strings.LastIndexByte(name, ':')
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	return n, err == nil
+}
+
+// textLabel 语音等文本参数：字符串本身，或翻译后 {text: ...} 形式的对象
+func textLabel(params interface{}) string {
+	switch v := params.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if text, ok := v["text"].(string); ok {
+			return text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,543 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ai-generation/internal/types"
+)
+
+// 动作参数形式
+const (
+	ParamNone   = "none"   // 不接受参数
+	ParamText   = "text"   // 纯文本参数，如语音内容
+	ParamObject = "object" // JSON对象参数，按Fields校验
+	ParamAny    = "any"    // 任意JSON值，原样透传
+)
+
+// 诊断级别
+const (
+	SeverityRepaired = "repaired"
+	SeverityDropped  = "dropped"
+	SeverityInfo     = "info"
+)
+
+// FieldSpec 对象参数中单个字段的约束
+type FieldSpec struct {
+	Type     string      `json:"type"` // number, integer, string, boolean
+	Required bool        `json:"required,omitempty"`
+	Min      *float64    `json:"min,omitempty"`
+	Max      *float64    `json:"max,omitempty"`
+	Enum     []string    `json:"enum,omitempty"`
+	Default  interface{} `json:"default,omitempty"`
+}
+
+// ActionSpec 一个可下发到设备的动作定义
+type ActionSpec struct {
+	Name           string               `json:"name"`
+	Aliases        []string             `json:"aliases,omitempty"`
+	Params         string               `json:"params"`
+	ParamsRequired bool                 `json:"params_required,omitempty"`
+	Fields         map[string]FieldSpec `json:"fields,omitempty"`
+	// Multiple 为true时params也可以是对象数组，如一次移动多个舵机
+	Multiple      bool `json:"multiple,omitempty"`
+	MaxTextLength int  `json:"max_text_length,omitempty"`
+	MaxDelay      int  `json:"max_delay,omitempty"`
+
+	// Actuators 动作占用的执行器，同一执行器上时间重叠的两个动作视为冲突；
+	// ActuatorParam 不为空时再按params中该字段的值追加执行器，如 servo:3
+	Actuators     []string `json:"actuators,omitempty"`
+	ActuatorParam string   `json:"actuator_param,omitempty"`
+	// Duration 预估执行时长（毫秒），DurationParam 指定params中覆盖时长的字段，
+	// DurationPerChar 按文本字数追加时长，用于语音
+	Duration        int    `json:"duration,omitempty"`
+	DurationParam   string `json:"duration_param,omitempty"`
+	DurationPerChar int    `json:"duration_per_char,omitempty"`
+}
+
+// ActionRegistry 动作白名单，LLM输出的每个function都必须通过校验才能下发
+type ActionRegistry struct {
+	specs   map[string]*ActionSpec
+	aliases map[string]string
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+// DefaultActionSpecs 内置动作定义
+func DefaultActionSpecs() []ActionSpec {
+	return []ActionSpec{
+		{
+			Name:      "handsup",
+			Aliases:   []string{"hands_up", "hand_up", "raise_hand", "raise_hands", "举手"},
+			Params:    ParamNone,
+			MaxDelay:  60000,
+			Actuators: []string{"left_arm", "right_arm"},
+			Duration:  1000,
+		},
+		{
+			Name:      "handsdown",
+			Aliases:   []string{"hands_down", "hand_down", "lower_hand", "lower_hands", "放下手"},
+			Params:    ParamNone,
+			MaxDelay:  60000,
+			Actuators: []string{"left_arm", "right_arm"},
+			Duration:  1000,
+		},
+		{
+			Name:           "headturn",
+			Aliases:        []string{"head_turn", "turn_head", "转头"},
+			Params:         ParamObject,
+			ParamsRequired: true,
+			Fields: map[string]FieldSpec{
+				"angle": {Type: "number", Required: true, Min: float(-90), Max: float(90)},
+			},
+			MaxDelay:  60000,
+			Actuators: []string{"head"},
+			Duration:  800,
+		},
+		{
+			Name:           "servo_move",
+			Aliases:        []string{"servo", "servomove", "move_servo"},
+			Params:         ParamObject,
+			ParamsRequired: true,
+			Fields: map[string]FieldSpec{
+				"servo":    {Type: "integer", Required: true, Min: float(1), Max: float(17)},
+				"angle":    {Type: "number", Required: true, Min: float(0), Max: float(180)},
+				"duration": {Type: "integer", Min: float(0), Max: float(10000)},
+			},
+			Multiple:      true,
+			MaxDelay:      60000,
+			ActuatorParam: "servo",
+			Duration:      500,
+			DurationParam: "duration",
+		},
+		{
+			Name:            "voice",
+			Aliases:         []string{"speak", "say", "tts", "speech", "说话"},
+			Params:          ParamText,
+			ParamsRequired:  true,
+			MaxTextLength:   500,
+			MaxDelay:        60000,
+			Actuators:       []string{"speaker"},
+			Duration:        300,
+			DurationPerChar: 250,
+		},
+		{
+			Name:           "led",
+			Aliases:        []string{"light", "lights", "set_led"},
+			Params:         ParamObject,
+			ParamsRequired: true,
+			Fields: map[string]FieldSpec{
+				"color": {Type: "string", Required: true, Enum: []string{"red", "green", "blue", "white", "yellow", "purple", "cyan", "orange", "off"}},
+				"mode":  {Type: "string", Enum: []string{"on", "off", "blink", "breath"}, Default: "on"},
+			},
+			MaxDelay:  60000,
+			Actuators: []string{"led"},
+		},
+	}
+}
+
+// NewActionRegistry 根据动作定义创建注册表
+func NewActionRegistry(specs []ActionSpec) (*ActionRegistry, error) {
+	r := &ActionRegistry{
+		specs:   make(map[string]*ActionSpec),
+		aliases: make(map[string]string),
+	}
+	for i := range specs {
+		spec := specs[i]
+		name := normalizeActionName(spec.Name)
+		if name == "" {
+			return nil, fmt.Errorf("action spec #%d has empty name", i)
+		}
+		switch spec.Params {
+		case "":
+			spec.Params = ParamNone
+		case ParamNone, ParamText, ParamObject, ParamAny:
+		default:
+			return nil, fmt.Errorf("action %s has unknown params kind %q", name, spec.Params)
+		}
+		spec.Name = name
+		r.specs[name] = &spec
+		for _, alias := range spec.Aliases {
+			r.aliases[normalizeActionName(alias)] = name
+		}
+	}
+	return r, nil
+}
+
+// LoadActionRegistry 加载内置动作定义，path不为空时用文件中的定义按名称覆盖或追加
+func LoadActionRegistry(path string) (*ActionRegistry, error) {
+	specs := DefaultActionSpecs()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read action registry: %w", err)
+		}
+		var custom []ActionSpec
+		if err := json.Unmarshal(data, &custom); err != nil {
+			return nil, fmt.Errorf("parse action registry: %w", err)
+		}
+		index := make(map[string]int, len(specs))
+		for i, spec := range specs {
+			index[spec.Name] = i
+		}
+		for _, spec := range custom {
+			if i, ok := index[normalizeActionName(spec.Name)]; ok {
+				specs[i] = spec
+			} else {
+				specs = append(specs, spec)
+			}
+		}
+	}
+	return NewActionRegistry(specs)
+}
+
+// Lookup 按名称或别名查找动作定义
+func (r *ActionRegistry) Lookup(action string) (*ActionSpec, bool) {
+	name := normalizeActionName(action)
+	if spec, ok := r.specs[name]; ok {
+		return spec, true
+	}
+	if canonical, ok := r.aliases[name]; ok {
+		return r.specs[canonical], true
+	}
+	return nil, false
+}
+
+// Actions 返回所有已注册的动作名称
+func (r *ActionRegistry) Actions() []string {
+	names := make([]string, 0, len(r.specs))
+	for name := range r.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate 校验并规范化所有function，无法修复的条目被丢弃，所有改动记录在诊断信息中
+func (r *ActionRegistry) Validate(functions []types.CompletionFunctions) ([]types.CompletionFunctions, []types.Diagnostic) {
+	valid := make([]types.CompletionFunctions, 0, len(functions))
+	var diagnostics []types.Diagnostic
+	for i, function := range functions {
+		normalized, diags, ok := r.validateFunction(i, function)
+		diagnostics = append(diagnostics, diags...)
+		if ok {
+			valid = append(valid, normalized)
+		}
+	}
+	return valid, diagnostics
+}
+
+func (r *ActionRegistry) validateFunction(index int, function types.CompletionFunctions) (types.CompletionFunctions, []types.Diagnostic, bool) {
+	var diagnostics []types.Diagnostic
+	report := func(code, severity, format string, args ...interface{}) {
+		diagnostics = append(diagnostics, types.Diagnostic{
+			Index:    index,
+			Action:   function.Action,
+			Code:     code,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	spec, ok := r.Lookup(function.Action)
+	if !ok {
+		report("unknown_action", SeverityDropped, "action %q is not registered", function.Action)
+		return function, diagnostics, false
+	}
+	normalized := function
+	if spec.Name != function.Action {
+		report("action_renamed", SeverityRepaired, "action %q normalized to %q", function.Action, spec.Name)
+		normalized.Action = spec.Name
+	}
+
+	if normalized.Delay < 0 {
+		report("delay_clamped", SeverityRepaired, "negative delay %d set to 0", normalized.Delay)
+		normalized.Delay = 0
+	}
+	if spec.MaxDelay > 0 && normalized.Delay > spec.MaxDelay {
+		report("delay_clamped", SeverityRepaired, "delay %d exceeds max %d", normalized.Delay, spec.MaxDelay)
+		normalized.Delay = spec.MaxDelay
+	}
+
+	switch spec.Params {
+	case ParamNone:
+		if normalized.Params != nil && normalized.Params != "" {
+			report("params_removed", SeverityRepaired, "action %s takes no params", spec.Name)
+		}
+		normalized.Params = nil
+	case ParamText:
+		raw, isString := normalized.Params.(string)
+		text := strings.TrimSpace(textParam(normalized.Params))
+		if normalized.Params != nil && (!isString || text != raw) {
+			report("params_normalized", SeverityRepaired, "text params normalized")
+		}
+		if text == "" {
+			if spec.ParamsRequired {
+				report("missing_params", SeverityDropped, "action %s requires text params", spec.Name)
+				return function, diagnostics, false
+			}
+			normalized.Params = nil
+			break
+		}
+		if spec.MaxTextLength > 0 && utf8.RuneCountInString(text) > spec.MaxTextLength {
+			report("params_truncated", SeverityRepaired, "text truncated to %d characters", spec.MaxTextLength)
+			text = string([]rune(text)[:spec.MaxTextLength])
+		}
+		normalized.Params = text
+	case ParamObject:
+		params, fieldDiags, ok := validateObjectParams(spec, normalized.Params)
+		for _, d := range fieldDiags {
+			report(d.Code, d.Severity, "%s", d.Message)
+		}
+		if !ok {
+			return function, diagnostics, false
+		}
+		normalized.Params = params
+	case ParamAny:
+		// 自定义动作的参数原样透传，只解开被编码成字符串的JSON
+		normalized.Params = decodeJSONString(normalized.Params)
+	}
+	return normalized, diagnostics, true
+}
+
+// textParam 兼容LLM把文本包在对象里的写法，如 {"text": "..."}
+func textParam(params interface{}) string {
+	switch v := decodeJSONString(params).(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}:
+		for _, key := range []string{"text", "content", "voice", "message"} {
+			if text, ok := v[key].(string); ok {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// decodeJSONString 旧提示词会把对象参数写成JSON字符串，如 "{\"angle\": 30}"，解开后按结构处理
+func decodeJSONString(params interface{}) interface{} {
+	str, ok := params.(string)
+	if !ok {
+		return params
+	}
+	trimmed := strings.TrimSpace(str)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return params
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(trimmed), &decoded); err != nil {
+		return params
+	}
+	return decoded
+}
+
+// validateObjectParams 校验对象参数；Multiple的动作还接受对象数组，逐个校验
+func validateObjectParams(spec *ActionSpec, params interface{}) (interface{}, []types.Diagnostic, bool) {
+	var diagnostics []types.Diagnostic
+	report := func(code, severity, format string, args ...interface{}) {
+		diagnostics = append(diagnostics, types.Diagnostic{Code: code, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch v := decodeJSONString(params).(type) {
+	case nil:
+		if spec.ParamsRequired && !hasDefaults(spec) {
+			report("missing_params", SeverityDropped, "action %s requires params", spec.Name)
+			return nil, diagnostics, false
+		}
+		obj, diags, ok := validateFields(spec, map[string]interface{}{})
+		return obj, append(diagnostics, diags...), ok
+	case string:
+		if strings.TrimSpace(v) == "" && (!spec.ParamsRequired || hasDefaults(spec)) {
+			obj, diags, ok := validateFields(spec, map[string]interface{}{})
+			return obj, append(diagnostics, diags...), ok
+		}
+		report("invalid_params", SeverityDropped, "params of %s must be an object, got string %q", spec.Name, v)
+		return nil, diagnostics, false
+	case map[string]interface{}:
+		obj, diags, ok := validateFields(spec, v)
+		return obj, append(diagnostics, diags...), ok
+	case []interface{}:
+		if !spec.Multiple {
+			if len(v) == 1 {
+				report("params_unwrapped", SeverityRepaired, "single-element array unwrapped")
+				obj, diags, ok := validateObjectParams(spec, v[0])
+				return obj, append(diagnostics, diags...), ok
+			}
+			report("invalid_params", SeverityDropped, "params of %s must be an object, got array", spec.Name)
+			return nil, diagnostics, false
+		}
+		if len(v) == 0 {
+			report("missing_params", SeverityDropped, "action %s requires at least one item", spec.Name)
+			return nil, diagnostics, false
+		}
+		items := make([]interface{}, 0, len(v))
+		for i, item := range v {
+			obj, ok := item.(map[string]interface{})
+			if !ok {
+				report("invalid_params", SeverityDropped, "params[%d] of %s must be an object, got %T", i, spec.Name, item)
+				return nil, diagnostics, false
+			}
+			normalized, diags, ok := validateFields(spec, obj)
+			for _, d := range diags {
+				d.Message = fmt.Sprintf("params[%d]: %s", i, d.Message)
+				diagnostics = append(diagnostics, d)
+			}
+			if !ok {
+				return nil, diagnostics, false
+			}
+			items = append(items, normalized)
+		}
+		return items, diagnostics, true
+	default:
+		report("invalid_params", SeverityDropped, "params of %s must be an object, got %T", spec.Name, v)
+		return nil, diagnostics, false
+	}
+}
+
+// validateFields 按字段定义校验单个参数对象，返回规范化后的新对象
+func validateFields(spec *ActionSpec, params map[string]interface{}) (map[string]interface{}, []types.Diagnostic, bool) {
+	var diagnostics []types.Diagnostic
+	report := func(code, severity, format string, args ...interface{}) {
+		diagnostics = append(diagnostics, types.Diagnostic{Code: code, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	obj := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		if _, ok := spec.Fields[key]; !ok {
+			report("unknown_param", SeverityRepaired, "unknown param %q removed", key)
+			continue
+		}
+		obj[key] = value
+	}
+
+	names := make([]string, 0, len(spec.Fields))
+	for name := range spec.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field := spec.Fields[name]
+		value, present := obj[name]
+		if !present || value == nil {
+			if field.Default != nil {
+				obj[name] = field.Default
+				if field.Required {
+					report("param_defaulted", SeverityRepaired, "missing param %q set to default %v", name, field.Default)
+				}
+				continue
+			}
+			delete(obj, name)
+			if field.Required {
+				report("missing_param", SeverityDropped, "required param %q of %s is missing", name, spec.Name)
+				return nil, diagnostics, false
+			}
+			continue
+		}
+
+		coerced, err := coerceField(field, value)
+		if err != nil {
+			if field.Required {
+				report("invalid_param", SeverityDropped, "param %q of %s: %v", name, spec.Name, err)
+				return nil, diagnostics, false
+			}
+			report("invalid_param", SeverityRepaired, "param %q removed: %v", name, err)
+			delete(obj, name)
+			continue
+		}
+		if f, ok := coerced.(float64); ok {
+			if field.Min != nil && f < *field.Min {
+				report("param_clamped", SeverityRepaired, "param %q %v below min %v", name, f, *field.Min)
+				coerced = *field.Min
+			} else if field.Max != nil && f > *field.Max {
+				report("param_clamped", SeverityRepaired, "param %q %v above max %v", name, f, *field.Max)
+				coerced = *field.Max
+			}
+		}
+		obj[name] = coerced
+	}
+	return obj, diagnostics, true
+}
+
+func hasDefaults(spec *ActionSpec) bool {
+	for _, field := range spec.Fields {
+		if field.Required && field.Default == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// coerceField 按字段类型转换值，LLM常把数字写成字符串
+func coerceField(field FieldSpec, value interface{}) (interface{}, error) {
+	switch field.Type {
+	case "number", "integer":
+		var f float64
+		switch v := value.(type) {
+		case float64:
+			f = v
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("expected %s, got %q", field.Type, v)
+			}
+			f = parsed
+		default:
+			return nil, fmt.Errorf("expected %s, got %T", field.Type, value)
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("expected finite %s", field.Type)
+		}
+		if field.Type == "integer" {
+			f = math.Round(f)
+		}
+		return f, nil
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("expected boolean, got %q", v)
+			}
+			return parsed, nil
+		}
+		return nil, fmt.Errorf("expected boolean, got %T", value)
+	default:
+		var s string
+		switch v := value.(type) {
+		case string:
+			s = v
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return nil, fmt.Errorf("expected string, got %T", value)
+		}
+		if len(field.Enum) == 0 {
+			return s, nil
+		}
+		for _, option := range field.Enum {
+			if strings.EqualFold(strings.TrimSpace(s), option) {
+				return option, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not one of %v", s, field.Enum)
+	}
+}
+
+// normalizeActionName 统一大小写与分隔符，如 "Hands-Up" -> "hands_up"
+func normalizeActionName(action string) string {
+	name := strings.ToLower(strings.TrimSpace(action))
+	return strings.NewReplacer("-", "_", " ", "_").Replace(name)
+}
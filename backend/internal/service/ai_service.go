@@ -3,49 +3,113 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/ai-generation/internal/api"
+	"github.com/ai-generation/internal/normalize"
 	"github.com/ai-generation/internal/types"
 	"github.com/ai-generation/pkg/dify"
+	"golang.org/x/sync/singleflight"
 )
 
 type AIService struct {
-	difyClient   *dify.Client
-	cacheService *CacheService
+	difyClient     *dify.Client
+	cacheService   *CacheService
+	actionRegistry *ActionRegistry
+	timeline       *TimelineCompiler
+	profiles       *DeviceProfiles
+	macros         *MacroLibrary
+	rateLimiter    *RateLimiter
+	// appID 应用的缓存标识，见 appCacheID
+	appID   string
+	similar *similarCache
+	// flight 合并实例内相同缓存键的进行中请求
+	flight  singleflight.Group
+	options AIServiceOptions
 }
 
-func NewAIService(difyAPIKey, difyAPIEndpoint string, cacheService *CacheService) (*AIService, error) {
-	// 检查Redis连接是否可用
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// AIServiceOptions 回答处理相关的可选配置
+type AIServiceOptions struct {
+	// AnswerFallback 回答不是JSON时按纯文本降级处理
+	AnswerFallback AnswerFallbackOptions
+	// AnswerRepair 回答不合格时重新询问
+	AnswerRepair AnswerRepairOptions
+	// ParamsFormat 请求未指定params_format时使用的格式
+	ParamsFormat string
+	// TimelineDelayMode functions中delay的解释方式，见 DelayModeAbsolute 等
+	TimelineDelayMode string
+	// DeviceProfiles 设备型号表，为nil时使用内置型号
+	DeviceProfiles *DeviceProfiles
+	// Macros 编排宏库，为nil时不展开宏
+	Macros *MacroLibrary
+	// DeviceHub 设备中心，登记进行中的请求以便急停取消，为nil时不登记
+	DeviceHub *DeviceHub
+	// RateLimit 默认策略的额度，Limit为0时使用 DefaultRateLimit
+	RateLimit RateLimit
+	// RateLimitPolicies 限流策略，为nil时按user和客户端IP以RateLimit计数
+	RateLimitPolicies []RateLimitPolicy
+	// CachePolicy 哪些请求的回答可以缓存
+	CachePolicy CachePolicy
+	// Stampede 相同问题同时到达时只请求一次Dify
+	Stampede StampedeOptions
+	// SimilarCache 精确缓存未命中时复用相似问题的回答，默认关闭
+	SimilarCache SimilarCacheOptions
+	// QueryNormalizer 计算缓存键前规范化查询，为nil时启用全部默认步骤；发给Dify的仍是原始查询
+	QueryNormalizer *normalize.Normalizer
+}
+
+// DefaultRateLimit 默认限流：令牌桶，每分钟100次
+var DefaultRateLimit = RateLimit{Algorithm: RateLimitTokenBucket, Limit: 100, Window: time.Minute}
 
-	if err := cacheService.redisClient.Ping(ctx); err != nil {
-		return nil, fmt.Errorf("redis连接检查失败: %v", err)
+func NewAIService(difyAPIKey, difyAPIEndpoint string, cacheService *CacheService, actionRegistry *ActionRegistry, options AIServiceOptions) (*AIService, error) {
+	timeline, err := NewTimelineCompiler(actionRegistry, options.TimelineDelayMode)
+	if err != nil {
+		return nil, fmt.Errorf("timeline compiler: %w", err)
+	}
+	if options.RateLimit.Limit == 0 {
+		options.RateLimit = DefaultRateLimit
+	}
+	options.Stampede = options.Stampede.withDefaults()
+	if options.QueryNormalizer == nil {
+		if options.QueryNormalizer, err = normalize.New(normalize.DefaultSteps, nil); err != nil {
+			return nil, fmt.Errorf("query normalizer: %w", err)
+		}
+	}
+	policies := options.RateLimitPolicies
+	if policies == nil {
+		policies = DefaultRateLimitPolicies(options.RateLimit)
+	}
+	rateLimiter, err := NewRateLimiter(cacheService, policies)
+	if err != nil {
+		return nil, fmt.Errorf("rate limit: %w", err)
+	}
+	profiles := options.DeviceProfiles
+	if profiles == nil {
+		if profiles, err = NewDeviceProfiles(DefaultDeviceProfiles(), nil); err != nil {
+			return nil, fmt.Errorf("device profiles: %w", err)
+		}
 	}
-	// 打印redis连接成功
-	fmt.Println("redis连接可用")
 
 	return &AIService{
-		difyClient:   dify.NewClient(difyAPIKey, difyAPIEndpoint),
-		cacheService: cacheService,
+		difyClient:     dify.NewClient(difyAPIKey, difyAPIEndpoint),
+		cacheService:   cacheService,
+		actionRegistry: actionRegistry,
+		timeline:       timeline,
+		profiles:       profiles,
+		macros:         options.Macros,
+		rateLimiter:    rateLimiter,
+		appID:          appCacheID(difyAPIKey, difyAPIEndpoint),
+		similar:        newSimilarCache(options.SimilarCache),
+		options:        options,
 	}, nil
 }
 
 // 对象池定义
-var completionResponsePool = sync.Pool{
-	New: func() interface{} {
-		return &types.CompletionResponse{
-			Data: &types.CompletionOptimizeData{
-				Functions: make([]types.CompletionFunctions, 0),
-			},
-		}
-	},
-}
-
 var difyRequestPool = sync.Pool{
 	New: func() interface{} {
 		return &dify.CompletionRequest{
@@ -61,73 +125,45 @@ var jsonDataPool = sync.Pool{
 }
 
 func (s *AIService) GetCompletion(req *types.CompletionRequest) (*types.CompletionResponse, error) {
-	// 从对象池获取响应对象
-	resp := completionResponsePool.Get().(*types.CompletionResponse)
-	// 确保函数结束时将对象放回池中
-	defer func() {
-		// 清理对象数据
-		resp.Code = 0
-		resp.Msg = ""
-		if resp.Data != nil {
-			resp.Data.Content = ""
-			resp.Data.Functions = resp.Data.Functions[:0] // 清空切片但保留容量
-		}
-		completionResponsePool.Put(resp)
-	}()
+	startedAt := time.Now()
 
-	// 检查限流
-	allowed, err := s.cacheService.CheckRateLimit(context.Background(), req.User, 100, time.Minute)
+	// 检查限流，Data为nil时JSON序列化为null
+	limit, err := s.checkRateLimit(context.Background(), req)
 	if err != nil {
-		resp.Code = http.StatusInternalServerError
-		resp.Msg = fmt.Sprintf("rate limit check failed: %v", err)
-		resp.Data = nil // 显式设置为nil保证JSON序列化为null
-		return resp, nil
+		return &types.CompletionResponse{Code: http.StatusInternalServerError, Msg: fmt.Sprintf("rate limit check failed: %v", err)}, nil
 	}
-	if !allowed {
-		resp.Code = http.StatusTooManyRequests
-		resp.Msg = "rate limit exceeded"
-		resp.Data = nil // 显式设置为nil保证JSON序列化为null
-		return resp, nil
+	if limit != nil && !limit.Allowed {
+		return &types.CompletionResponse{Code: http.StatusTooManyRequests, Msg: rateLimitMessage(limit)}, nil
 	}
+	// 选择设备型号
+	profile, err := s.profiles.Resolve(req.DeviceType, req.DeviceID)
+	if err != nil {
+		return &types.CompletionResponse{Code: http.StatusBadRequest, Msg: err.Error()}, nil
+	}
+	deviceType := profileType(profile)
 	// 检查缓存
-	cachedResult, err := s.cacheService.GetCachedCompletion(context.Background(), req.Query, req.User)
-	if err == nil && cachedResult != nil {
+	cacheKey, cachedResult, cacheInfo := s.lookupCache(context.Background(), req, deviceType)
+	if cachedResult != nil {
 		// 从缓存结果构建响应
-		if content, ok := cachedResult["content"].(string); ok {
-			resp.Code = http.StatusOK
-			resp.Msg = "success (cached)"
-			resp.Data = &types.CompletionOptimizeData{
-				Content:   content,
-				Functions: make([]types.CompletionFunctions, 0),
-			}
-			// 打印构建的响应数据
-			if functions, ok := cachedResult["functions"].([]interface{}); ok {
-				for _, f := range functions {
-					if funcMap, ok := f.(map[string]interface{}); ok {
-						function := types.CompletionFunctions{
-							Action: funcMap["action"].(string),
-							Delay:  int(funcMap["delay"].(float64)),
-						}
-						if params, ok := funcMap["params"].(string); ok {
-							function.Params = params
-						}
-						resp.Data.Functions = append(resp.Data.Functions, function)
-					}
-				}
-			}
-
-			// 创建响应对象的深拷贝
-			responseCopy := *resp
-			responseCopy.Data = &types.CompletionOptimizeData{
-				Content:   resp.Data.Content,
-				Functions: append([]types.CompletionFunctions{}, resp.Data.Functions...),
-			}
-
-			// 返回深拷贝的响应对象
-			return &responseCopy, nil
+		if cached := s.cachedResponse(cachedResult, cacheInfo, req, profile); cached != nil {
+			return cached, nil
 		}
 	}
 
+	// 可以缓存的请求合并相同的进行中请求，只有一个请求调用Dify，其余等待并复用它的回答
+	if cacheKey != "" {
+		resp, _, err := s.coalesce(context.Background(), req, profile, deviceType, cacheKey, startedAt, false)
+		return resp, err
+	}
+	resp, _, err := s.generateCompletion(req, profile, deviceType, "", startedAt)
+	return resp, err
+}
+
+// generateCompletion 请求Dify生成回答，校验后写入缓存，第二个返回值表示回答已写入缓存。
+// 返回的响应不来自对象池，可以在合并的请求之间共享
+func (s *AIService) generateCompletion(req *types.CompletionRequest, profile *DeviceProfile, deviceType, cacheKey string, startedAt time.Time) (*types.CompletionResponse, bool, error) {
+	resp := &types.CompletionResponse{}
+
 	// 确保inputs字段不为nil
 	if req.Inputs == nil {
 		req.Inputs = make(map[string]string)
@@ -148,6 +184,7 @@ func (s *AIService) GetCompletion(req *types.CompletionRequest) (*types.Completi
 		}
 		difyReq.User = ""
 		difyReq.ResponseMode = ""
+		difyReq.ConversationID = ""
 		difyRequestPool.Put(difyReq)
 	}()
 
@@ -158,16 +195,27 @@ func (s *AIService) GetCompletion(req *types.CompletionRequest) (*types.Completi
 	}
 	difyReq.User = req.User
 	difyReq.ResponseMode = req.ResponseMode
-
-	difyResp, err := s.difyClient.Completion(difyReq)
+	difyReq.ConversationID = req.ConversationID
+
+	// 请求登记到设备中心（没有device_id时登记在全体设备下），急停时取消并停止Dify任务
+	ctx := context.Background()
+	if s.options.DeviceHub != nil {
+		var release func()
+		ctx, release = s.options.DeviceHub.Track(ctx, req.DeviceID)
+		defer release()
+	}
+	difyResp, err := s.complete(ctx, s.difyClient, difyReq)
 
 	if err != nil {
+		if errors.Is(context.Cause(ctx), ErrEmergencyStopped) {
+			return emergencyStoppedResponse(), false, nil
+		}
 		// 检查是否是HTTP错误并直接传递
 		if httpErr, ok := err.(*api.HTTPError); ok {
 			resp.Code = httpErr.StatusCode
 			resp.Msg = httpErr.Message
 			resp.Data = nil // 显式设置为nil保证JSON序列化为null
-			return resp, nil
+			return resp, false, nil
 		}
 		resp.Code = http.StatusInternalServerError
 		resp.Msg = fmt.Sprintf("dify completion failed: %v", err)
@@ -188,7 +236,7 @@ func (s *AIService) GetCompletion(req *types.CompletionRequest) (*types.Completi
 		resp.Data = nil // 显式设置为nil保证JSON序列化为null
 
 		// 返回深拷贝的响应对象
-		return &responseCopy, nil
+		return &responseCopy, false, nil
 	}
 
 	// 验证响应数据的有效性
@@ -196,32 +244,151 @@ func (s *AIService) GetCompletion(req *types.CompletionRequest) (*types.Completi
 		resp.Code = http.StatusInternalServerError
 		resp.Msg = "invalid response: empty response from dify"
 		resp.Data = nil // 显式设置为nil保证JSON序列化为null
-		// 创建响应对象的深拷贝
+		// 创建响应对象的深拷贝，Data保持为nil
 		responseCopy := *resp
-		responseCopy.Data = &types.CompletionOptimizeData{
-			Content:   resp.Data.Content,
-			Functions: append([]types.CompletionFunctions{}, resp.Data.Functions...),
-		}
 
 		// 返回深拷贝的响应对象
-		return &responseCopy, nil
+		return &responseCopy, false, nil
 	}
 	// 验证必要字段
 	if difyResp.Answer == "" {
 		resp.Code = http.StatusInternalServerError
 		resp.Msg = "invalid response: empty answer from dify"
 		resp.Data = nil // 显式设置为nil保证JSON序列化为null
-		// 创建响应对象的深拷贝
+		// 创建响应对象的深拷贝，Data保持为nil
 		responseCopy := *resp
-		responseCopy.Data = &types.CompletionOptimizeData{
-			Content:   resp.Data.Content,
-			Functions: append([]types.CompletionFunctions{}, resp.Data.Functions...),
-		}
 
 		// 返回深拷贝的响应对象
-		return &responseCopy, nil
+		return &responseCopy, false, nil
+	}
+
+	// 解析并校验回答，不合格时按配置重新询问
+	data, parseErr := s.parseAnswer(difyResp.Answer, difyResp.AnswerRepairs, deviceType)
+	if s.needsRepair(data, parseErr) {
+		data, parseErr = s.repairAnswer(ctx, startedAt, req, deviceType, difyResp, data, parseErr)
+		if errors.Is(context.Cause(ctx), ErrEmergencyStopped) {
+			return emergencyStoppedResponse(), false, nil
+		}
 	}
 
+	if parseErr != nil {
+		fmt.Printf("Answer字段解析失败: %v\n", parseErr)
+		// 纯文本回答降级为语音播报，降级结果不缓存
+		if data, ok := s.plainTextAnswer(difyResp.Answer, deviceType); ok {
+			fmt.Printf("Answer按纯文本降级处理\n")
+			data.ConversationID = difyResp.ConversationId
+			s.finalize(data, req, profile)
+			return &types.CompletionResponse{
+				Code: http.StatusOK,
+				Msg:  "success (degraded format)",
+				Data: data,
+			}, false, nil
+		}
+		// 如果解析失败，返回错误
+		resp.Code = http.StatusInternalServerError
+		resp.Msg = fmt.Sprintf("invalid JSON format in answer: %v", parseErr)
+		resp.Data = nil // 显式设置为nil保证JSON序列化为null
+		return &types.CompletionResponse{Code: resp.Code, Msg: resp.Msg}, false, nil
+	}
+
+	// 构建响应数据
+	resp.Code = http.StatusOK
+	resp.Msg = "success"
+	resp.Data = data
+	for _, d := range resp.Data.Diagnostics {
+		fmt.Printf("function校验[%d] %s %s: %s\n", d.Index, d.Severity, d.Code, d.Message)
+	}
+
+	// 缓存校验后的结果，缓存失败仅记录日志，不影响正常响应
+	stored := s.storeCache(context.Background(), cacheKey, req, deviceType, resp.Data)
+
+	// 创建响应对象的深拷贝
+	responseCopy := *resp
+	responseCopy.Data = &types.CompletionOptimizeData{
+		Content:        resp.Data.Content,
+		Functions:      append([]types.CompletionFunctions{}, resp.Data.Functions...),
+		Diagnostics:    resp.Data.Diagnostics,
+		Timeline:       resp.Data.Timeline,
+		ConversationID: difyResp.ConversationId,
+	}
+	s.finalize(responseCopy.Data, req, profile)
+
+	// 返回深拷贝的响应对象
+	return &responseCopy, stored, nil
+}
+
+// complete 请求Dify生成完整的回答。启用设备中心时使用streaming模式：第一个事件就带有task_id，
+// 急停取消请求时可以通知Dify停止任务；blocking模式到生成结束才返回task_id，取消只能断开本地连接
+func (s *AIService) complete(ctx context.Context, client *dify.Client, req *dify.CompletionRequest) (*dify.CompletionOriginResponse, error) {
+	if s.options.DeviceHub == nil {
+		return client.CompletionWithContext(ctx, req)
+	}
+	return client.CompletionStream(ctx, req, func(*dify.StreamEvent) error { return nil })
+}
+
+// cacheEntry 缓存的内容：校验后的回答，以及便于管理和排查的请求信息
+func (s *AIService) cacheEntry(req *types.CompletionRequest, deviceType string, version int64, class string, data *types.CompletionOptimizeData) map[string]interface{} {
+	entry := map[string]interface{}{
+		"version":          version,
+		"class":            class,
+		"content":          data.Content,
+		"functions":        data.Functions,
+		"query":            req.Query,
+		"normalized_query": s.options.QueryNormalizer.Normalize(req.Query),
+		"first_requester":  req.User,
+		"created_at":       time.Now().Unix(),
+	}
+	if len(req.Inputs) > 0 {
+		entry["inputs"] = req.Inputs
+	}
+	if deviceType != "" {
+		entry["device_type"] = deviceType
+	}
+	return entry
+}
+
+// cachedResponse 由缓存内容构建响应，缓存内容无效时返回nil
+func (s *AIService) cachedResponse(cachedResult map[string]interface{}, info *types.CacheInfo, req *types.CompletionRequest, profile *DeviceProfile) *types.CompletionResponse {
+	content, ok := cachedResult["content"].(string)
+	if !ok {
+		return nil
+	}
+	data := s.completionFromCache(content, cachedResult)
+	data.Cache = info
+	s.finalize(data, req, profile)
+	return &types.CompletionResponse{Code: http.StatusOK, Msg: "success (cached)", Data: data}
+}
+
+// completionFromCache 从缓存结果重建响应数据；注册表可能已变更，缓存的结果同样需要校验
+func (s *AIService) completionFromCache(content string, cachedResult map[string]interface{}) *types.CompletionOptimizeData {
+	data := &types.CompletionOptimizeData{
+		Content:   content,
+		Functions: make([]types.CompletionFunctions, 0),
+	}
+	if functions, ok := cachedResult["functions"].([]interface{}); ok {
+		for _, f := range functions {
+			if funcMap, ok := f.(map[string]interface{}); ok {
+				function := types.CompletionFunctions{}
+				if action, ok := funcMap["action"].(string); ok {
+					function.Action = action
+				}
+				if delay, ok := funcMap["delay"].(float64); ok {
+					function.Delay = int(delay)
+				}
+				if params, ok := funcMap["params"]; ok {
+					function.Params = params
+				}
+				data.Functions = append(data.Functions, function)
+			}
+		}
+	}
+	data.Functions, data.Diagnostics = s.actionRegistry.Validate(data.Functions)
+	s.compileTimeline(data)
+	return data
+}
+
+// parseAnswer 解析Dify回答中的content和functions，展开编排宏并按动作注册表校验
+func (s *AIService) parseAnswer(answer string, repairs []string, deviceType string) (*types.CompletionOptimizeData, error) {
 	// 从对象池获取JSON数据对象
 	answerData := jsonDataPool.Get().(map[string]interface{})
 	defer func() {
@@ -233,105 +400,158 @@ func (s *AIService) GetCompletion(req *types.CompletionRequest) (*types.Completi
 	}()
 
 	// 尝试解析Answer字段为JSON对象
-	if err := json.Unmarshal([]byte(difyResp.Answer), &answerData); err != nil {
-		// 如果解析失败，返回错误
-		fmt.Printf("Answer字段解析失败: %v\n", err)
-		resp.Code = http.StatusInternalServerError
-		resp.Msg = fmt.Sprintf("invalid JSON format in answer: %v", err)
-		resp.Data = nil // 显式设置为nil保证JSON序列化为null
-		// 创建响应对象的深拷贝
-		responseCopy := *resp
-		responseCopy.Data = &types.CompletionOptimizeData{
-			Content:   resp.Data.Content,
-			Functions: append([]types.CompletionFunctions{}, resp.Data.Functions...),
-		}
-
-		// 返回深拷贝的响应对象
-		return &responseCopy, nil
+	if err := json.Unmarshal([]byte(answer), &answerData); err != nil {
+		return nil, err
 	}
 
-	// 构建响应数据
-	resp.Code = http.StatusOK
-	resp.Msg = "success"
-	resp.Data = &types.CompletionOptimizeData{
+	data := &types.CompletionOptimizeData{
 		Content:   "",
 		Functions: make([]types.CompletionFunctions, 0),
 	}
 
 	// 提取content
-	if answerData != nil {
-		fmt.Printf("解析到的完整answerData: %+v\n", answerData)
-		if content, ok := answerData["content"].(string); ok {
-			fmt.Printf("成功提取content，值为: %s\n", content)
-			resp.Data.Content = content
-		} else {
-			fmt.Printf("content字段类型断言失败，实际类型: %T，实际值: %v\n", answerData["content"], answerData["content"])
-		}
+	fmt.Printf("解析到的完整answerData: %+v\n", answerData)
+	if content, ok := answerData["content"].(string); ok {
+		fmt.Printf("成功提取content，值为: %s\n", content)
+		data.Content = content
+	} else {
+		fmt.Printf("content字段类型断言失败，实际类型: %T，实际值: %v\n", answerData["content"], answerData["content"])
+	}
+
+	// 提取functions
+	if functions, ok := answerData["functions"].([]interface{}); ok {
+		fmt.Printf("成功获取functions数组，长度: %d\n", len(functions))
+		for i, f := range functions {
+			fmt.Printf("处理第%d个function\n", i+1)
+			if funcMap, ok := f.(map[string]interface{}); ok {
+				fmt.Printf("function数据: %+v\n", funcMap)
+				function := types.CompletionFunctions{
+					Action: "",
+					Delay:  0,
+				}
+
+				if action, ok := funcMap["action"].(string); ok {
+					fmt.Printf("成功提取action: %s\n", action)
+					function.Action = action
+				} else {
+					fmt.Printf("action字段类型断言失败，实际类型: %T，实际值: %v\n", funcMap["action"], funcMap["action"])
+				}
 
-		// 提取functions
-		if functions, ok := answerData["functions"].([]interface{}); ok {
-			fmt.Printf("成功获取functions数组，长度: %d\n", len(functions))
-			for i, f := range functions {
-				fmt.Printf("处理第%d个function\n", i+1)
-				if funcMap, ok := f.(map[string]interface{}); ok {
-					fmt.Printf("function数据: %+v\n", funcMap)
-					function := types.CompletionFunctions{
-						Action: "",
-						Delay:  0,
-					}
-
-					if action, ok := funcMap["action"].(string); ok {
-						fmt.Printf("成功提取action: %s\n", action)
-						function.Action = action
-					} else {
-						fmt.Printf("action字段类型断言失败，实际类型: %T，实际值: %v\n", funcMap["action"], funcMap["action"])
-					}
-
-					if delay, ok := funcMap["delay"].(float64); ok {
-						fmt.Printf("成功提取delay: %f\n", delay)
-						function.Delay = int(delay)
-					} else {
-						fmt.Printf("delay字段类型断言失败，实际类型: %T，实际值: %v\n", funcMap["delay"], funcMap["delay"])
-					}
-
-					if params, ok := funcMap["params"].(string); ok {
-						fmt.Printf("成功提取params: %s\n", params)
-						function.Params = params
-					} else if params, ok := funcMap["params"].(map[string]interface{}); ok {
-						// 如果params是一个对象，将其转换为JSON字符串
-						if paramsJSON, err := json.Marshal(params); err == nil {
-							fmt.Printf("成功将params对象转换为JSON字符串: %s\n", string(paramsJSON))
-							function.Params = string(paramsJSON)
-						} else {
-							fmt.Printf("params对象转JSON失败: %v\n", err)
-						}
-					} else {
-						fmt.Printf("params字段类型断言失败，实际类型: %T，实际值: %v\n", funcMap["params"], funcMap["params"])
-					}
-
-					resp.Data.Functions = append(resp.Data.Functions, function)
+				if delay, ok := funcMap["delay"].(float64); ok {
+					fmt.Printf("成功提取delay: %f\n", delay)
+					function.Delay = int(delay)
 				} else {
-					fmt.Printf("function不是一个有效的map，实际类型: %T\n", f)
+					fmt.Printf("delay字段类型断言失败，实际类型: %T，实际值: %v\n", funcMap["delay"], funcMap["delay"])
+				}
+
+				if params, ok := funcMap["params"]; ok && params != nil {
+					fmt.Printf("成功提取params: %v\n", params)
+					function.Params = params
 				}
+
+				data.Functions = append(data.Functions, function)
+			} else {
+				fmt.Printf("function不是一个有效的map，实际类型: %T\n", f)
 			}
-		} else {
-			fmt.Printf("functions字段类型断言失败或不存在，实际类型: %T，实际值: %v\n", answerData["functions"], answerData["functions"])
 		}
+	} else {
+		fmt.Printf("functions字段类型断言失败或不存在，实际类型: %T，实际值: %v\n", answerData["functions"], answerData["functions"])
+	}
 
-		// 缓存结果
-		if err := s.cacheService.SetCachedCompletion(context.Background(), req.Query, req.User, answerData); err != nil {
-			// 缓存失败仅记录日志，不影响正常响应
-			fmt.Printf("failed to cache completion result: %v\n", err)
-		}
+	// 按动作注册表校验，未注册的动作绝不能下发到设备
+	data.Functions, data.Diagnostics = s.validateFunctions(data.Functions, deviceType)
+	if len(repairs) > 0 {
+		data.Diagnostics = append([]types.Diagnostic{{
+			Index:    -1,
+			Code:     "answer_repaired",
+			Severity: SeverityRepaired,
+			Message:  fmt.Sprintf("answer JSON repaired: %s", strings.Join(repairs, ", ")),
+		}}, data.Diagnostics...)
 	}
+	s.compileTimeline(data)
+	return data, nil
+}
 
-	// 创建响应对象的深拷贝
-	responseCopy := *resp
-	responseCopy.Data = &types.CompletionOptimizeData{
-		Content:   resp.Data.Content,
-		Functions: append([]types.CompletionFunctions{}, resp.Data.Functions...),
+// validateFunctions 先展开编排宏，再按动作注册表校验
+func (s *AIService) validateFunctions(functions []types.CompletionFunctions, deviceType string) ([]types.CompletionFunctions, []types.Diagnostic) {
+	var macroDiagnostics []types.Diagnostic
+	if s.macros != nil {
+		functions, macroDiagnostics = s.macros.Expand(context.Background(), functions, deviceType, s.timeline.delayMode)
 	}
+	valid, diagnostics := s.actionRegistry.Validate(functions)
+	return valid, append(macroDiagnostics, diagnostics...)
+}
 
-	// 返回深拷贝的响应对象
-	return &responseCopy, nil
+func profileType(profile *DeviceProfile) string {
+	if profile == nil {
+		return ""
+	}
+	return profile.Type
+}
+
+// compileTimeline 编译执行计划；执行器冲突只记录日志，由客户端决定如何编排
+func (s *AIService) compileTimeline(data *types.CompletionOptimizeData) {
+	data.Timeline = s.timeline.Compile(data.Functions)
+	for _, c := range data.Timeline.Conflicts {
+		fmt.Printf("动作冲突: %s 上 functions[%d] 与 functions[%d] 在 %d-%dms 重叠\n", c.Actuator, c.First, c.Second, c.Start, c.End)
+	}
+}
+
+// PlanFunctions 按回答相同的流程展开宏、校验、翻译给定的functions并编译时间线，不经过LLM和缓存，
+// 用于预览和下发预先编排好的表演
+func (s *AIService) PlanFunctions(req *types.CompletionRequest, content string, functions []types.CompletionFunctions) (*types.CompletionOptimizeData, error) {
+	profile, err := s.profiles.Resolve(req.DeviceType, req.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	valid, diagnostics := s.validateFunctions(functions, profileType(profile))
+	data := &types.CompletionOptimizeData{
+		Content:     content,
+		Functions:   valid,
+		Diagnostics: diagnostics,
+	}
+	s.compileTimeline(data)
+	s.finalize(data, req, profile)
+	return data, nil
+}
+
+// finalize 按设备型号把通用动作翻译为设备动作，经安全限位检查后重新编译时间线，最后按params_format编码参数。
+// 缓存中保存的是翻译前的通用结果，同一回答可以下发给不同型号的设备。
+func (s *AIService) finalize(data *types.CompletionOptimizeData, req *types.CompletionRequest, profile *DeviceProfile) {
+	if profile != nil {
+		translated, sources, diagnostics := profile.Translate(data.Functions)
+		translated, sources, safetyDiagnostics := profile.Safety.NewCheck().Apply(translated, sources)
+		data.Functions = translated
+		data.Diagnostics = append(data.Diagnostics, diagnostics...)
+		data.Diagnostics = append(data.Diagnostics, safetyDiagnostics...)
+		data.Timeline = s.timeline.CompileTranslated(translated, sources)
+		data.DeviceType = profile.Type
+	}
+	s.formatParams(data, req.ParamsFormat)
+}
+
+// formatParams 旧客户端只能处理字符串params，按params_format把结构化参数编码为JSON字符串
+func (s *AIService) formatParams(data *types.CompletionOptimizeData, format string) {
+	if format == "" {
+		format = s.options.ParamsFormat
+	}
+	if format != types.ParamsFormatString {
+		return
+	}
+	for i, function := range data.Functions {
+		if function.Params == nil {
+			continue
+		}
+		if _, ok := function.Params.(string); ok {
+			continue
+		}
+		if paramsJSON, err := json.Marshal(function.Params); err == nil {
+			data.Functions[i].Params = string(paramsJSON)
+		}
+	}
+}
+
+// emergencyStoppedResponse 请求在生成过程中被急停取消，不返回任何动作
+func emergencyStoppedResponse() *types.CompletionResponse {
+	return &types.CompletionResponse{Code: StatusEmergencyStopped, Msg: ErrEmergencyStopped.Error()}
 }
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ai-generation/internal/api"
+	"github.com/ai-generation/internal/types"
+	"github.com/ai-generation/pkg/dify"
+)
+
+// StreamCompletion 以流式方式生成回答：content增量和每个通过校验的function一完整就通过emit推送，
+// 机器人可以在LLM生成结束前开始执行动作。最后推送done事件，携带与GetCompletion相同的完整结果。
+// 限流、Dify失败等业务错误以error事件返回；只有emit失败或ctx取消时才返回error。
+// 已推送的function可能已被执行，因此流式模式不做回答自修复。
+func (s *AIService) StreamCompletion(ctx context.Context, req *types.CompletionRequest, emit func(event *types.StreamEvent) error) error {
+	// 检查限流
+	limit, err := s.checkRateLimit(ctx, req)
+	if err != nil {
+		return emitError(emit, http.StatusInternalServerError, fmt.Sprintf("rate limit check failed: %v", err))
+	}
+	if limit != nil && !limit.Allowed {
+		return emitError(emit, http.StatusTooManyRequests, rateLimitMessage(limit))
+	}
+	profile, err := s.profiles.Resolve(req.DeviceType, req.DeviceID)
+	if err != nil {
+		return emitError(emit, http.StatusBadRequest, err.Error())
+	}
+	deviceType := profileType(profile)
+
+	// 检查缓存，命中时一次性推送
+	cacheKey, cachedResult, cacheInfo := s.lookupCache(ctx, req, deviceType)
+	if cachedResult != nil {
+		if content, ok := cachedResult["content"].(string); ok {
+			data := s.completionFromCache(content, cachedResult)
+			data.Cache = cacheInfo
+			s.finalize(data, req, profile)
+			if err := s.emitData(emit, data); err != nil {
+				return err
+			}
+			return emit(&types.StreamEvent{Event: types.StreamEventDone, Code: http.StatusOK, Msg: "success (cached)", Data: data})
+		}
+	}
+
+	if req.Inputs == nil {
+		req.Inputs = make(map[string]string)
+	}
+	if req.User == "" {
+		req.User = "default_user"
+	}
+
+	var safety *SafetyCheck
+	if profile != nil {
+		safety = profile.Safety.NewCheck()
+	}
+	// 记录已推送的内容和function，结束时补发整体修复后才得到的部分
+	sent := &streamedData{functions: make(map[string]int)}
+	scanner := &dify.AnswerScanner{
+		OnContent: func(delta string) error {
+			sent.content = true
+			return emit(&types.StreamEvent{Event: types.StreamEventContent, Delta: delta})
+		},
+		OnFunction: func(index int, raw string) error {
+			return s.emitFunction(ctx, emit, index, raw, req, profile, safety, sent)
+		},
+	}
+
+	difyReq := &dify.CompletionRequest{
+		Query:          req.Query,
+		Inputs:         req.Inputs,
+		User:           req.User,
+		ConversationID: req.ConversationID,
+	}
+	// 急停时只取消生成，已推送的事件由客户端在收到error事件后停止执行
+	difyCtx := ctx
+	if s.options.DeviceHub != nil {
+		var release func()
+		difyCtx, release = s.options.DeviceHub.Track(ctx, req.DeviceID)
+		defer release()
+	}
+	difyResp, err := s.difyClient.CompletionStream(difyCtx, difyReq, func(event *dify.StreamEvent) error {
+		if event.Event == "message_replace" {
+			// 内容审查替换了回答，之前推送的内容作废，最终以done事件为准
+			return nil
+		}
+		return scanner.Write(event.Answer)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(context.Cause(difyCtx), ErrEmergencyStopped) {
+			return emitError(emit, StatusEmergencyStopped, ErrEmergencyStopped.Error())
+		}
+		if httpErr, ok := err.(*api.HTTPError); ok {
+			return emitError(emit, httpErr.StatusCode, httpErr.Message)
+		}
+		return emitError(emit, http.StatusInternalServerError, fmt.Sprintf("dify completion failed: %v", err))
+	}
+	if difyResp == nil || difyResp.Answer == "" {
+		return emitError(emit, http.StatusInternalServerError, "invalid response: empty answer from dify")
+	}
+
+	data, parseErr := s.parseAnswer(difyResp.Answer, difyResp.AnswerRepairs, deviceType)
+	if parseErr != nil {
+		fmt.Printf("Answer字段解析失败: %v\n", parseErr)
+		// 纯文本回答降级为语音播报，降级结果不缓存
+		degraded, ok := s.plainTextAnswer(difyResp.Answer, deviceType)
+		if !ok {
+			return emitError(emit, http.StatusInternalServerError, fmt.Sprintf("invalid JSON format in answer: %v", parseErr))
+		}
+		degraded.ConversationID = difyResp.ConversationId
+		s.finalize(degraded, req, profile)
+		if err := s.emitRemaining(emit, degraded, sent); err != nil {
+			return err
+		}
+		return emit(&types.StreamEvent{Event: types.StreamEventDone, Code: http.StatusOK, Msg: "success (degraded format)", Data: degraded})
+	}
+
+	for _, d := range data.Diagnostics {
+		fmt.Printf("function校验[%d] %s %s: %s\n", d.Index, d.Severity, d.Code, d.Message)
+	}
+	s.storeCache(ctx, cacheKey, req, deviceType, data)
+
+	data.ConversationID = difyResp.ConversationId
+	s.finalize(data, req, profile)
+	// 回答需要整体修复才能解析时扫描器推送不出全部内容，在done之前补发
+	if err := s.emitRemaining(emit, data, sent); err != nil {
+		return err
+	}
+	return emit(&types.StreamEvent{Event: types.StreamEventDone, Code: http.StatusOK, Msg: "success", Data: data})
+}
+
+// emitFunction 解析、展开宏并校验单个function，通过后立即推送；被丢弃的function只推送诊断
+func (s *AIService) emitFunction(ctx context.Context, emit func(event *types.StreamEvent) error, index int, raw string, req *types.CompletionRequest, profile *DeviceProfile, safety *SafetyCheck, sent *streamedData) error {
+	var funcMap map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &funcMap); err != nil {
+		repaired, repairErr := dify.RepairJSON(raw)
+		if repairErr != nil || json.Unmarshal([]byte(repaired), &funcMap) != nil {
+			// 留给结束时的整体解析处理
+			fmt.Printf("流式function[%d]解析失败: %v\n", index, err)
+			return nil
+		}
+	}
+
+	function := types.CompletionFunctions{}
+	if action, ok := funcMap["action"].(string); ok {
+		function.Action = action
+	}
+	if delay, ok := funcMap["delay"].(float64); ok {
+		function.Delay = int(delay)
+	}
+	if params, ok := funcMap["params"]; ok && params != nil {
+		function.Params = params
+	}
+
+	functions := []types.CompletionFunctions{function}
+	var diagnostics []types.Diagnostic
+	if s.macros != nil {
+		functions = s.macros.expand(ctx, index, function, profileType(profile), s.timeline.delayMode, nil, make(map[string]*types.Macro), &diagnostics)
+	}
+	if err := emitDiagnostics(emit, index, diagnostics); err != nil {
+		return err
+	}
+
+	for _, f := range functions {
+		normalized, diagnostics, ok := s.actionRegistry.validateFunction(index, f)
+		if ok && profile != nil {
+			var translateDiags []types.Diagnostic
+			normalized, _, translateDiags, ok = profile.translateFunction(index, normalized)
+			diagnostics = append(diagnostics, translateDiags...)
+		}
+		if ok && safety != nil {
+			var safetyDiags []types.Diagnostic
+			normalized, safetyDiags, ok = safety.Check(index, normalized)
+			diagnostics = append(diagnostics, safetyDiags...)
+		}
+		if err := emitDiagnostics(emit, index, diagnostics); err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		data := &types.CompletionOptimizeData{Functions: []types.CompletionFunctions{normalized}}
+		s.formatParams(data, req.ParamsFormat)
+		if err := emit(&types.StreamEvent{Event: types.StreamEventFunction, Index: index, Function: &data.Functions[0]}); err != nil {
+			return err
+		}
+		sent.functions[functionKey(data.Functions[0])]++
+	}
+	return nil
+}
+
+// streamedData 流式推送过的内容，以及按内容计数的function
+type streamedData struct {
+	content   bool
+	functions map[string]int
+}
+
+// functionKey 比较function是否已推送过
+func functionKey(function types.CompletionFunctions) string {
+	key, _ := json.Marshal(function)
+	return string(key)
+}
+
+// emitRemaining 补发没有推送过的内容和function，如只在整体修复后才能解析出的部分
+func (s *AIService) emitRemaining(emit func(event *types.StreamEvent) error, data *types.CompletionOptimizeData, sent *streamedData) error {
+	if !sent.content && data.Content != "" {
+		if err := emit(&types.StreamEvent{Event: types.StreamEventContent, Delta: data.Content}); err != nil {
+			return err
+		}
+	}
+	for i := range data.Functions {
+		key := functionKey(data.Functions[i])
+		if sent.functions[key] > 0 {
+			sent.functions[key]--
+			continue
+		}
+		if err := emit(&types.StreamEvent{Event: types.StreamEventFunction, Index: i, Function: &data.Functions[i]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func emitDiagnostics(emit func(event *types.StreamEvent) error, index int, diagnostics []types.Diagnostic) error {
+	for i := range diagnostics {
+		if err := emit(&types.StreamEvent{Event: types.StreamEventDiagnostic, Index: index, Diagnostic: &diagnostics[i]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emitData 把完整结果拆成content和function事件推送
+func (s *AIService) emitData(emit func(event *types.StreamEvent) error, data *types.CompletionOptimizeData) error {
+	if data.Content != "" {
+		if err := emit(&types.StreamEvent{Event: types.StreamEventContent, Delta: data.Content}); err != nil {
+			return err
+		}
+	}
+	for i := range data.Functions {
+		if err := emit(&types.StreamEvent{Event: types.StreamEventFunction, Index: i, Function: &data.Functions[i]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func emitError(emit func(event *types.StreamEvent) error, code int, msg string) error {
+	return emit(&types.StreamEvent{Event: types.StreamEventError, Code: code, Msg: msg})
+}
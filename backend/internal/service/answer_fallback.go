@@ -0,0 +1,51 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ai-generation/internal/types"
+)
+
+// AnswerFallbackOptions 纯文本回答的降级配置
+type AnswerFallbackOptions struct {
+	Enabled bool
+	// Gesture 降级时与语音同时执行的动作，为空时只播报语音
+	Gesture string
+}
+
+// markdownPattern 匹配代码块标记、加粗和行首的标题/引用符号，这些不应被念出来
+var markdownPattern = regexp.MustCompile("```[a-zA-Z]*|\\*\\*|__|(?m)^[ \t]*(#+|>)[ \t]*")
+
+// plainTextAnswer 把非JSON回答包装为content和voice动作，并标记为degraded_format。
+// 看起来像JSON的残缺输出不做降级，避免机器人把括号和字段名念出来。
+func (s *AIService) plainTextAnswer(answer string, deviceType string) (*types.CompletionOptimizeData, bool) {
+	if !s.options.AnswerFallback.Enabled {
+		return nil, false
+	}
+	text := strings.TrimSpace(markdownPattern.ReplaceAllString(answer, ""))
+	if text == "" || strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") {
+		return nil, false
+	}
+
+	functions := make([]types.CompletionFunctions, 0, 2)
+	if s.options.AnswerFallback.Gesture != "" {
+		functions = append(functions, types.CompletionFunctions{Action: s.options.AnswerFallback.Gesture})
+	}
+	functions = append(functions, types.CompletionFunctions{Action: "voice", Params: text})
+
+	data := &types.CompletionOptimizeData{
+		Content:        text,
+		DegradedFormat: true,
+	}
+	data.Functions, data.Diagnostics = s.validateFunctions(functions, deviceType)
+	data.Diagnostics = append([]types.Diagnostic{{
+		Index:    -1,
+		Code:     "degraded_format",
+		Severity: SeverityRepaired,
+		Message:  fmt.Sprintf("answer is not JSON, wrapped %d characters of plain text as voice", len([]rune(text))),
+	}}, data.Diagnostics...)
+	s.compileTimeline(data)
+	return data, true
+}
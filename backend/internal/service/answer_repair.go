@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ai-generation/internal/types"
+	"github.com/ai-generation/pkg/dify"
+)
+
+// DefaultAnswerRepairTimeout 回答修复的默认总时限
+const DefaultAnswerRepairTimeout = 30 * time.Second
+
+// AnswerRepairOptions 回答不合格时重新询问的配置
+type AnswerRepairOptions struct {
+	// MaxAttempts 最多重新询问的次数，0表示关闭
+	MaxAttempts int
+	// Timeout 从收到请求开始计算的总时限，超过后不再重新询问；0表示使用 DefaultAnswerRepairTimeout
+	Timeout time.Duration
+	// SameConversation 在访客的Dify会话中重新询问，LLM可以参考上下文，但修复提示会留在会话中；
+	// 默认在新会话中询问。使用专用修复应用时总是新会话
+	SameConversation bool
+	// Client 专用的修复应用，为nil时使用原应用
+	Client *dify.Client
+}
+
+// needsRepair 回答无法解析，或有function因校验失败被丢弃时需要修复
+func (s *AIService) needsRepair(data *types.CompletionOptimizeData, parseErr error) bool {
+	if s.options.AnswerRepair.MaxAttempts <= 0 {
+		return false
+	}
+	if parseErr != nil {
+		return true
+	}
+	return len(droppedDiagnostics(data.Diagnostics)) > 0
+}
+
+// repairAnswer 把校验错误和上一次的输出交给LLM重新生成，直到通过校验、次数用尽或超过时限。
+// 时限从收到请求开始计算，请求本身的deadline更早时以请求为准。
+// 全部失败时返回最后一次能解析的结果；都不能解析时返回解析错误，由上层降级处理。
+func (s *AIService) repairAnswer(parent context.Context, startedAt time.Time, req *types.CompletionRequest, deviceType string, difyResp *dify.CompletionOriginResponse, data *types.CompletionOptimizeData, parseErr error) (*types.CompletionOptimizeData, error) {
+	opts := s.options.AnswerRepair
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultAnswerRepairTimeout
+	}
+	ctx, cancel := context.WithDeadline(parent, startedAt.Add(timeout))
+	defer cancel()
+
+	// 专用修复应用使用新会话，不传原应用的inputs；原应用按配置在原会话或新会话中询问
+	client := opts.Client
+	conversationID := ""
+	inputs := map[string]string{}
+	if client == nil {
+		client = s.difyClient
+		inputs = req.Inputs
+		if opts.SameConversation {
+			conversationID = difyResp.ConversationId
+		}
+	}
+
+	best, bestErr := data, parseErr
+	answer := difyResp.Answer
+	for attempt := 1; attempt <= opts.MaxAttempts; attempt++ {
+		if ctx.Err() != nil {
+			fmt.Printf("回答修复超过时限，已尝试%d次\n", attempt-1)
+			break
+		}
+
+		repairReq := &dify.CompletionRequest{
+			Query:          s.repairPrompt(req.Query, answer, data, parseErr, conversationID != ""),
+			Inputs:         inputs,
+			User:           req.User,
+			ResponseMode:   "blocking",
+			ConversationID: conversationID,
+		}
+		repaired, err := s.complete(ctx, client, repairReq)
+		if err != nil {
+			fmt.Printf("第%d次回答修复请求失败: %v\n", attempt, err)
+			break
+		}
+		if repaired == nil || repaired.Answer == "" {
+			continue
+		}
+
+		answer = repaired.Answer
+		data, parseErr = s.parseAnswer(repaired.Answer, repaired.AnswerRepairs, deviceType)
+		if parseErr == nil {
+			data.Diagnostics = append(data.Diagnostics, types.Diagnostic{
+				Index:    -1,
+				Code:     "answer_reasked",
+				Severity: SeverityRepaired,
+				Message:  fmt.Sprintf("answer regenerated after %d repair attempt(s)", attempt),
+			})
+			best, bestErr = data, nil
+			if len(droppedDiagnostics(data.Diagnostics)) == 0 {
+				return data, nil
+			}
+		}
+	}
+	return best, bestErr
+}
+
+// repairPrompt 构造修复提示：列出错误、附上原输出，并重申输出格式和可用动作
+func (s *AIService) repairPrompt(query, answer string, data *types.CompletionOptimizeData, parseErr error, sameConversation bool) string {
+	var b strings.Builder
+	if sameConversation {
+		b.WriteString("你上一次的回答不符合要求，请修正后重新输出。\n")
+	} else {
+		b.WriteString("下面是机器人对用户问题的回答，但格式不符合要求，请修正后重新输出。\n")
+		fmt.Fprintf(&b, "用户问题：%s\n", query)
+	}
+
+	b.WriteString("错误：\n")
+	if parseErr != nil {
+		fmt.Fprintf(&b, "- 回答不是合法的JSON对象：%v\n", parseErr)
+	} else {
+		for _, d := range droppedDiagnostics(data.Diagnostics) {
+			fmt.Fprintf(&b, "- functions[%d] %s\n", d.Index, d.Message)
+		}
+	}
+	fmt.Fprintf(&b, "原输出：\n%s\n", answer)
+
+	b.WriteString(`要求：只输出一个JSON对象，不要输出任何其他文字或代码块标记，格式为 {"content": "回答文本", "functions": [{"action": "动作名", "delay": 毫秒数, "params": 参数}]}。`)
+	fmt.Fprintf(&b, "可用的action只有：%s。", strings.Join(s.actionRegistry.Actions(), ", "))
+	return b.String()
+}
+
+func droppedDiagnostics(diagnostics []types.Diagnostic) []types.Diagnostic {
+	var dropped []types.Diagnostic
+	for _, d := range diagnostics {
+		if d.Severity == SeverityDropped {
+			dropped = append(dropped, d)
+		}
+	}
+	return dropped
+}
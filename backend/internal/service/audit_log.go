@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ai-generation/internal/types"
+)
+
+const (
+	auditLogKey = "audit:log"
+	// auditLogMaxLen 只保留最新的审计记录
+	auditLogMaxLen = 10000
+)
+
+// AuditLog 审计日志，保存在Redis列表中，最新的记录在前
+type AuditLog struct {
+	cacheService *CacheService
+}
+
+// NewAuditLog 创建审计日志
+func NewAuditLog(cacheService *CacheService) *AuditLog {
+	return &AuditLog{cacheService: cacheService}
+}
+
+// Record 写入一条审计记录，写入失败时仍打印到日志，不影响操作本身
+func (a *AuditLog) Record(ctx context.Context, actor, action, target string, detail map[string]interface{}) *types.AuditEntry {
+	entry := &types.AuditEntry{
+		ID:     newID(),
+		Time:   time.Now().Unix(),
+		Actor:  actor,
+		Action: action,
+		Target: target,
+		Detail: detail,
+	}
+	fmt.Printf("审计: %s %s %s %v\n", actor, action, target, detail)
+	if err := a.cacheService.storage.LPush(ctx, auditLogKey, entry, auditLogMaxLen); err != nil {
+		fmt.Printf("审计记录写入失败: %v\n", err)
+	}
+	return entry
+}
+
+// List 按时间倒序读取审计记录
+func (a *AuditLog) List(ctx context.Context, offset, limit int) ([]*types.AuditEntry, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	raw, err := a.cacheService.storage.LRange(ctx, auditLogKey, int64(offset), int64(offset+limit-1))
+	if err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	entries := make([]*types.AuditEntry, 0, len(raw))
+	for _, item := range raw {
+		var entry types.AuditEntry
+		if err := json.Unmarshal([]byte(item), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
+
+// newID 生成随机的十六进制ID
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
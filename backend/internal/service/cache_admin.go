@@ -0,0 +1,339 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ai-generation/internal/api"
+	"github.com/ai-generation/internal/types"
+	"github.com/ai-generation/pkg/memory"
+)
+
+const (
+	// cacheSearchDefaultLimit 查找默认返回的条目数
+	cacheSearchDefaultLimit = 100
+	cacheSearchMaxLimit     = 1000
+)
+
+// CacheAdmin 管理缓存的回答：查找、查看、删除和清空命名空间，删除操作写入审计日志。
+// 遍历使用SCAN，不会像KEYS一样阻塞Redis
+type CacheAdmin struct {
+	cacheService *CacheService
+	audit        *AuditLog
+}
+
+// NewCacheAdmin 创建缓存管理
+func NewCacheAdmin(cacheService *CacheService, audit *AuditLog) *CacheAdmin {
+	return &CacheAdmin{cacheService: cacheService, audit: audit}
+}
+
+// cacheFilter 查找和删除共用的匹配条件
+type cacheFilter struct {
+	namespace      string
+	firstRequester string
+	query          string
+	stale          bool
+}
+
+func newCacheFilter(namespace, firstRequester, query string, stale bool) (*cacheFilter, error) {
+	if err := validateNamespace(namespace, false); err != nil {
+		return nil, err
+	}
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query != "" && !strings.ContainsAny(query, "*?") {
+		query = "*" + query + "*"
+	}
+	return &cacheFilter{namespace: namespace, firstRequester: strings.TrimSpace(firstRequester), query: query, stale: stale}, nil
+}
+
+// pattern 遍历的key模式，索引和锁的键在遍历后按格式排除
+func (f *cacheFilter) pattern() string {
+	if f.namespace == "" {
+		return "completion:*"
+	}
+	return "completion:" + f.namespace + ":*"
+}
+
+func (f *cacheFilter) match(entry *types.CacheEntry) bool {
+	if f.stale && !entry.Stale {
+		return false
+	}
+	if f.firstRequester != "" && entry.FirstRequester != f.firstRequester {
+		return false
+	}
+	if f.query != "" &&
+		!memory.Match(f.query, strings.ToLower(entry.Query)) &&
+		!memory.Match(f.query, strings.ToLower(entry.NormalizedQuery)) {
+		return false
+	}
+	return true
+}
+
+// validateNamespace 命名空间不能包含通配符和分隔符，避免删除范围超出预期
+func validateNamespace(namespace string, required bool) error {
+	if namespace == "" {
+		if required {
+			return badRequestError("namespace is required")
+		}
+		return nil
+	}
+	if strings.ContainsAny(namespace, "*?[]\\:") || namespace == "index" || namespace == "lock" {
+		return badRequestError(fmt.Sprintf("invalid namespace %q", namespace))
+	}
+	return nil
+}
+
+// each 遍历匹配的缓存条目，fn返回false时停止；遍历期间过期的条目跳过
+func (a *CacheAdmin) each(ctx context.Context, filter *cacheFilter, fn func(entry *types.CacheEntry) bool) (int, error) {
+	versions, err := a.cacheService.NamespaceVersions(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("read cache namespace versions: %w", err)
+	}
+	keys, err := a.cacheService.storage.Scan(ctx, filter.pattern(), 500)
+	if err != nil {
+		return 0, fmt.Errorf("scan cache: %w", err)
+	}
+	sort.Strings(keys)
+	scanned := 0
+	for _, key := range keys {
+		namespace, ok := completionNamespace(key)
+		if !ok {
+			continue
+		}
+		value, err := a.cacheService.GetCachedCompletion(ctx, key)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return scanned, fmt.Errorf("get cache entry %s: %w", key, err)
+		}
+		entry := &types.CacheEntry{Key: key, Namespace: namespace}
+		fillCacheEntry(entry, value, versions)
+		scanned++
+		if filter.match(entry) && !fn(entry) {
+			break
+		}
+	}
+	return scanned, nil
+}
+
+// fillCacheEntry 从缓存内容中取出便于查找的字段，按命名空间的当前版本判断是否已失效
+func fillCacheEntry(entry *types.CacheEntry, value map[string]interface{}, versions map[string]int64) {
+	entry.Query, _ = value["query"].(string)
+	entry.NormalizedQuery, _ = value["normalized_query"].(string)
+	// 早期的条目以user字段记录第一个请求的用户
+	if entry.FirstRequester, _ = value["first_requester"].(string); entry.FirstRequester == "" {
+		entry.FirstRequester, _ = value["user"].(string)
+	}
+	entry.DeviceType, _ = value["device_type"].(string)
+	entry.Inputs, _ = value["inputs"].(map[string]interface{})
+	entry.Class, _ = value["class"].(string)
+	if createdAt, ok := value["created_at"].(float64); ok {
+		entry.CreatedAt = int64(createdAt)
+	}
+	if version, ok := value["version"].(float64); ok {
+		entry.Version = int64(version)
+	}
+	if current, ok := versions[entry.Namespace]; ok {
+		entry.Stale = entry.Version != current
+	}
+}
+
+// SearchCache 按命名空间、第一个请求的用户和查询模式查找缓存的回答
+func (a *CacheAdmin) SearchCache(ctx context.Context, req *types.CacheSearchRequest) (*types.CacheSearchResult, error) {
+	filter, err := newCacheFilter(req.Namespace, req.FirstRequester, req.Query, req.Stale)
+	if err != nil {
+		return nil, err
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = cacheSearchDefaultLimit
+	}
+	if limit > cacheSearchMaxLimit {
+		limit = cacheSearchMaxLimit
+	}
+	result := &types.CacheSearchResult{Entries: make([]*types.CacheEntry, 0)}
+	result.Scanned, err = a.each(ctx, filter, func(entry *types.CacheEntry) bool {
+		if len(result.Entries) >= limit {
+			result.Truncated = true
+			return false
+		}
+		result.Entries = append(result.Entries, entry)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetCacheEntry 查看一条缓存的回答，包括原始内容
+func (a *CacheAdmin) GetCacheEntry(ctx context.Context, key string) (*types.CacheEntry, error) {
+	namespace, ok := completionNamespace(key)
+	if !ok {
+		return nil, badRequestError(fmt.Sprintf("invalid cache key %q", key))
+	}
+	value, err := a.cacheService.GetCachedCompletion(ctx, key)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, &api.HTTPError{StatusCode: http.StatusNotFound, Message: fmt.Sprintf("cache entry %s not found", key)}
+		}
+		return nil, fmt.Errorf("get cache entry %s: %w", key, err)
+	}
+	versions, err := a.cacheService.NamespaceVersions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read cache namespace versions: %w", err)
+	}
+	entry := &types.CacheEntry{Key: key, Namespace: namespace, Value: value}
+	fillCacheEntry(entry, value, versions)
+	return entry, nil
+}
+
+// PurgeCache 删除一条或按条件删除缓存的回答。相似问题索引中指向已删除回答的条目在下次查找时清理
+func (a *CacheAdmin) PurgeCache(ctx context.Context, req *types.CachePurgeRequest, actor string) (*types.CachePurgeResult, error) {
+	var keys []string
+	detail := map[string]interface{}{}
+	target := req.Key
+	if req.Key != "" {
+		if _, ok := completionNamespace(req.Key); !ok {
+			return nil, badRequestError(fmt.Sprintf("invalid cache key %q", req.Key))
+		}
+		exists, err := a.cacheService.storage.Exists(ctx, req.Key)
+		if err != nil {
+			return nil, fmt.Errorf("check cache entry %s: %w", req.Key, err)
+		}
+		if !exists {
+			return nil, &api.HTTPError{StatusCode: http.StatusNotFound, Message: fmt.Sprintf("cache entry %s not found", req.Key)}
+		}
+		keys = []string{req.Key}
+		detail["key"] = req.Key
+	} else {
+		if req.Query == "" && !req.Stale {
+			return nil, badRequestError("key, query or stale is required; use the namespace flush to remove a whole namespace")
+		}
+		filter, err := newCacheFilter(req.Namespace, "", req.Query, req.Stale)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := a.each(ctx, filter, func(entry *types.CacheEntry) bool {
+			keys = append(keys, entry.Key)
+			return true
+		}); err != nil {
+			return nil, err
+		}
+		for name, value := range map[string]string{"namespace": req.Namespace, "query": req.Query} {
+			if value != "" {
+				detail[name] = value
+			}
+		}
+		if req.Stale {
+			detail["stale"] = true
+		}
+		target = cachePurgeTarget(req)
+	}
+	deleted, err := a.cacheService.deleteKeys(ctx, keys)
+	detail["deleted"] = deleted
+	if err != nil {
+		detail["error"] = err.Error()
+	}
+	entry := a.audit.Record(ctx, actor, "cache_purge", target, detail)
+	if err != nil {
+		return nil, fmt.Errorf("delete cache entries: %w", err)
+	}
+	return &types.CachePurgeResult{Deleted: deleted, AuditID: entry.ID}, nil
+}
+
+// cachePurgeTarget 审计记录中的删除范围
+func cachePurgeTarget(req *types.CachePurgeRequest) string {
+	var parts []string
+	if req.Namespace != "" {
+		parts = append(parts, "namespace="+req.Namespace)
+	}
+	if req.Query != "" {
+		parts = append(parts, "query="+req.Query)
+	}
+	if req.Stale {
+		parts = append(parts, "stale")
+	}
+	return strings.Join(parts, " ")
+}
+
+// FlushNamespace 清空命名空间中的全部回答及其相似问题索引
+func (a *CacheAdmin) FlushNamespace(ctx context.Context, namespace, actor string) (*types.CachePurgeResult, error) {
+	if err := validateNamespace(namespace, true); err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, pattern := range []string{"completion:" + namespace + ":*", "completion:index:" + namespace + ":*"} {
+		matched, err := a.cacheService.storage.Scan(ctx, pattern, 500)
+		if err != nil {
+			return nil, fmt.Errorf("scan cache: %w", err)
+		}
+		keys = append(keys, matched...)
+	}
+	deleted, err := a.cacheService.deleteKeys(ctx, keys)
+	detail := map[string]interface{}{"deleted": deleted}
+	if err != nil {
+		detail["error"] = err.Error()
+	}
+	entry := a.audit.Record(ctx, actor, "cache_flush", namespace, detail)
+	if err != nil {
+		return nil, fmt.Errorf("flush cache namespace %s: %w", namespace, err)
+	}
+	return &types.CachePurgeResult{Deleted: deleted, AuditID: entry.ID}, nil
+}
+
+// ListNamespaces 列出已登记或有缓存回答的命名空间，及其当前版本和回答数量
+func (a *CacheAdmin) ListNamespaces(ctx context.Context) ([]*types.CacheNamespace, error) {
+	versions, err := a.cacheService.NamespaceVersions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read cache namespace versions: %w", err)
+	}
+	keys, err := a.cacheService.storage.Scan(ctx, "completion:*", 500)
+	if err != nil {
+		return nil, fmt.Errorf("scan cache: %w", err)
+	}
+	counts := make(map[string]int)
+	for namespace := range versions {
+		counts[namespace] = 0
+	}
+	for _, key := range keys {
+		if namespace, ok := completionNamespace(key); ok {
+			counts[namespace]++
+		}
+	}
+	namespaces := make([]*types.CacheNamespace, 0, len(counts))
+	for namespace, count := range counts {
+		namespaces = append(namespaces, &types.CacheNamespace{Namespace: namespace, Version: versions[namespace], Entries: count})
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Namespace < namespaces[j].Namespace })
+	return namespaces, nil
+}
+
+// BumpNamespace 递增命名空间的版本，其中的回答立即失效，提示词修改后使用；旧回答按各自的有效期过期，
+// 也可以通过按 stale 条件删除立即释放空间
+func (a *CacheAdmin) BumpNamespace(ctx context.Context, namespace, actor string) (*types.CacheNamespace, error) {
+	if err := validateNamespace(namespace, true); err != nil {
+		return nil, err
+	}
+	versions, err := a.cacheService.NamespaceVersions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read cache namespace versions: %w", err)
+	}
+	previous, ok := versions[namespace]
+	if !ok {
+		return nil, &api.HTTPError{StatusCode: http.StatusNotFound, Message: fmt.Sprintf("cache namespace %s not found", namespace)}
+	}
+	version, err := a.cacheService.BumpNamespace(ctx, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("bump cache namespace %s: %w", namespace, err)
+	}
+	entry := a.audit.Record(ctx, actor, "cache_bump", namespace, map[string]interface{}{
+		"previous_version": previous,
+		"version":          version,
+	})
+	return &types.CacheNamespace{Namespace: namespace, Version: version, AuditID: entry.ID}, nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ai-generation/internal/types"
+)
+
+// answerSchemaVersion 缓存回答的格式版本，提示词要求的回答结构或缓存内容变化时递增，旧缓存自然失效
+const answerSchemaVersion = 1
+
+// 请求中cache字段的取值
+const (
+	// CacheModeDefault 按缓存策略决定
+	CacheModeDefault = ""
+	// CacheModeBypass 不读也不写缓存
+	CacheModeBypass = "bypass"
+	// CacheModeForce 即使策略不允许（如多轮对话）也缓存，调用方确认回答与上下文无关
+	CacheModeForce = "force"
+)
+
+// CachePolicy 回答的可缓存策略
+type CachePolicy struct {
+	// CacheFollowUps 缓存带conversation_id的后续对话；默认只缓存首轮，后续回答依赖上下文
+	CacheFollowUps bool
+	// IntentInput 表示意图的inputs字段名，默认 intent
+	IntentInput string
+	// Intents 非空时只缓存这些意图的请求，如 faq、exhibit_intro
+	Intents []string
+	// TTL 本应用回答的有效期，默认24h
+	TTL time.Duration
+	// ClassTTLs 按可缓存类别覆盖有效期，见 cacheClass
+	ClassTTLs map[string]time.Duration
+}
+
+// 可缓存类别，用于按类别配置有效期；按意图配置时类别为 "intent:<意图>"
+const (
+	CacheClassDefault  = "default"
+	CacheClassFollowUp = "follow_up"
+	CacheClassForced   = "forced"
+)
+
+// DefaultCacheTTL 未配置时回答的有效期
+const DefaultCacheTTL = 24 * time.Hour
+
+// appCacheID 应用的缓存标识：同一Dify地址和密钥的回答共用缓存，密钥只取摘要
+func appCacheID(apiKey, endpoint string) string {
+	sum := sha256.Sum256([]byte(endpoint + "\n" + apiKey))
+	return hex.EncodeToString(sum[:6])
+}
+
+// CacheNamespace 本应用的缓存命名空间，即缓存键 completion:<namespace>:<hash> 中的应用标识
+func (s *AIService) CacheNamespace() string {
+	return s.appID
+}
+
+// cacheable 按请求和策略判断回答能否读写缓存
+func (s *AIService) cacheable(req *types.CompletionRequest) bool {
+	switch strings.ToLower(req.Cache) {
+	case CacheModeBypass:
+		return false
+	case CacheModeForce:
+		return true
+	}
+	policy := s.options.CachePolicy
+	if req.ConversationID != "" && !policy.CacheFollowUps {
+		return false
+	}
+	if len(policy.Intents) > 0 {
+		input := policy.IntentInput
+		if input == "" {
+			input = "intent"
+		}
+		return containsString(policy.Intents, req.Inputs[input])
+	}
+	return true
+}
+
+// cacheKeyParts 返回参与缓存键计算的内容，不可缓存时返回false。
+// 缓存键包含命名空间的当前版本，版本读取失败时不读写缓存，避免使用已失效的回答
+func (s *AIService) cacheKeyParts(ctx context.Context, req *types.CompletionRequest, deviceType string) (CompletionCacheKey, bool) {
+	if !s.cacheable(req) {
+		return CompletionCacheKey{}, false
+	}
+	version, err := s.cacheService.NamespaceVersion(ctx, s.appID)
+	if err != nil {
+		fmt.Printf("failed to read cache namespace version: %v\n", err)
+		return CompletionCacheKey{}, false
+	}
+	return CompletionCacheKey{
+		App:        s.appID,
+		Version:    version,
+		Schema:     answerSchemaVersion,
+		Query:      s.options.QueryNormalizer.Normalize(req.Query),
+		Inputs:     req.Inputs,
+		DeviceType: deviceType,
+	}, true
+}
+
+// cacheClass 请求的可缓存类别：配置了有效期的意图优先，其次是强制缓存和多轮对话的后续回答
+func (s *AIService) cacheClass(req *types.CompletionRequest) string {
+	policy := s.options.CachePolicy
+	input := policy.IntentInput
+	if input == "" {
+		input = "intent"
+	}
+	if intent := req.Inputs[input]; intent != "" {
+		if _, ok := policy.ClassTTLs["intent:"+intent]; ok {
+			return "intent:" + intent
+		}
+	}
+	if strings.ToLower(req.Cache) == CacheModeForce {
+		return CacheClassForced
+	}
+	if req.ConversationID != "" {
+		return CacheClassFollowUp
+	}
+	return CacheClassDefault
+}
+
+// cacheTTL 类别的有效期，类别未配置时使用应用的有效期
+func (s *AIService) cacheTTL(class string) time.Duration {
+	policy := s.options.CachePolicy
+	if ttl, ok := policy.ClassTTLs[class]; ok && ttl > 0 {
+		return ttl
+	}
+	if policy.TTL > 0 {
+		return policy.TTL
+	}
+	return DefaultCacheTTL
+}
+
+// maxCacheTTL 所有类别中最长的有效期，相似问题索引按此过期
+func (s *AIService) maxCacheTTL() time.Duration {
+	ttl := s.cacheTTL(CacheClassDefault)
+	for class := range s.options.CachePolicy.ClassTTLs {
+		if classTTL := s.cacheTTL(class); classTTL > ttl {
+			ttl = classTTL
+		}
+	}
+	return ttl
+}
+
+// lookupCache 查找缓存的回答：先按缓存键精确查找，未命中且启用了相似问题缓存时查找最相似的已缓存问题。
+// 返回本次请求的缓存键（不可缓存时为空）、缓存内容和命中信息
+func (s *AIService) lookupCache(ctx context.Context, req *types.CompletionRequest, deviceType string) (string, map[string]interface{}, *types.CacheInfo) {
+	parts, ok := s.cacheKeyParts(ctx, req, deviceType)
+	if !ok {
+		return "", nil, nil
+	}
+	cacheKey := s.cacheService.CacheKey(parts)
+	if cached, err := s.cacheService.GetCachedCompletion(ctx, cacheKey); err == nil && cached != nil {
+		return cacheKey, cached, &types.CacheInfo{Match: types.CacheMatchExact, Score: 1}
+	}
+	if s.similar == nil {
+		return cacheKey, nil, nil
+	}
+	cached, info := s.similar.lookup(ctx, s.cacheService, s.cacheService.CacheIndexKey(parts), cacheKey, parts.Query)
+	return cacheKey, cached, info
+}
+
+// storeCache 缓存回答，启用了相似问题缓存时同时加入索引；失败仅记录日志，返回是否已写入。
+// 生成期间命名空间的版本变了（如知识库更新）时不缓存，回答可能基于旧内容
+func (s *AIService) storeCache(ctx context.Context, cacheKey string, req *types.CompletionRequest, deviceType string, data *types.CompletionOptimizeData) bool {
+	if cacheKey == "" {
+		return false
+	}
+	parts, ok := s.cacheKeyParts(ctx, req, deviceType)
+	if !ok || s.cacheService.CacheKey(parts) != cacheKey {
+		fmt.Printf("cache namespace version changed while generating, answer not cached\n")
+		return false
+	}
+	class := s.cacheClass(req)
+	if err := s.cacheService.SetCachedCompletion(ctx, cacheKey, s.cacheEntry(req, deviceType, parts.Version, class, data), s.cacheTTL(class)); err != nil {
+		fmt.Printf("failed to cache completion result: %v\n", err)
+		return false
+	}
+	if s.similar != nil {
+		s.similar.index(ctx, s.cacheService, s.cacheService.CacheIndexKey(parts), cacheKey, parts.Query, s.maxCacheTTL())
+	}
+	return true
+}
@@ -2,71 +2,202 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
-
-	"github.com/ai-generation/pkg/redis"
 )
 
-// CacheService Redis缓存服务
+// cacheVersionsKey 各命名空间（应用）当前的版本号：命名空间 -> 版本
+const cacheVersionsKey = "cache:versions"
+
+// CacheService 缓存服务，存储可以是Redis、进程内LRU或两者组合
 type CacheService struct {
-	redisClient *redis.Client
+	storage Storage
+	// local 存储不支持Lua脚本或暂时不可用时在进程内限流
+	local *localRateLimiter
+	// localFallback 限流正在因存储不可用而使用进程内计数，只在状态变化时记录日志
+	localFallback atomic.Bool
 }
 
 // NewCacheService 创建缓存服务实例
-func NewCacheService(redisClient *redis.Client) *CacheService {
-	return &CacheService{redisClient: redisClient}
+func NewCacheService(storage Storage) *CacheService {
+	return &CacheService{storage: storage, local: newLocalRateLimiter()}
+}
+
+// Ping 检查存储是否可用
+func (s *CacheService) Ping(ctx context.Context) error {
+	return s.storage.Ping(ctx)
+}
+
+// CompletionCacheKey 参与缓存键计算的内容。用户不参与计算，回答的差异由inputs和设备型号体现；
+// Version 为命名空间的当前版本，版本递增后旧的缓存键不再被查到
+type CompletionCacheKey struct {
+	App        string            `json:"app"`
+	Version    int64             `json:"version,omitempty"`
+	Schema     int               `json:"schema"`
+	Query      string            `json:"query"`
+	Inputs     map[string]string `json:"inputs,omitempty"`
+	DeviceType string            `json:"device_type,omitempty"`
 }
 
-// CacheKey 生成缓存键
-func (s *CacheService) CacheKey(query string, user string) string {
-	return fmt.Sprintf("completion:%s:%s", user, query)
+// CacheKey 对规范化后的内容取摘要生成缓存键：completion:<app>:<sha256>。
+// 查询去掉首尾空白，inputs去掉空值，map按键排序编码，顺序不同的相同inputs得到相同的键
+func (s *CacheService) CacheKey(key CompletionCacheKey) string {
+	key.Query = strings.TrimSpace(key.Query)
+	inputs := make(map[string]string, len(key.Inputs))
+	for k, v := range key.Inputs {
+		if v = strings.TrimSpace(v); v != "" {
+			inputs[k] = v
+		}
+	}
+	key.Inputs = inputs
+	canonical, _ := json.Marshal(key)
+	sum := sha256.Sum256(canonical)
+	return fmt.Sprintf("completion:%s:%s", key.App, hex.EncodeToString(sum[:]))
 }
 
-// RateLimitKey 生成限流键
-func (s *CacheService) RateLimitKey(user string) string {
-	return fmt.Sprintf("rate_limit:%s", user)
+// CacheIndexKey 相似问题索引的键：与缓存键相同，但不包含查询，inputs、设备型号相同的缓存回答在同一个索引中
+func (s *CacheService) CacheIndexKey(key CompletionCacheKey) string {
+	key.Query = ""
+	return strings.Replace(s.CacheKey(key), "completion:", "completion:index:", 1)
+}
+
+// RateLimitKey 生成限流键，不同算法的状态结构不同，按算法区分
+func (s *CacheService) RateLimitKey(algorithm string, key string) string {
+	return fmt.Sprintf("rate_limit:%s:%s", algorithm, key)
 }
 
 // GetCachedCompletion 获取缓存的完成结果
-func (s *CacheService) GetCachedCompletion(ctx context.Context, query string, user string) (map[string]interface{}, error) {
+func (s *CacheService) GetCachedCompletion(ctx context.Context, key string) (map[string]interface{}, error) {
 	var result map[string]interface{}
-	err := s.redisClient.Get(ctx, s.CacheKey(query, user), &result)
+	err := s.storage.Get(ctx, key, &result)
 	return result, err
 }
 
 // SetCachedCompletion 设置完成结果缓存
-func (s *CacheService) SetCachedCompletion(ctx context.Context, query string, user string, result map[string]interface{}) error {
-	return s.redisClient.Set(ctx, s.CacheKey(query, user), result, 24*time.Hour)
+func (s *CacheService) SetCachedCompletion(ctx context.Context, key string, result map[string]interface{}, ttl time.Duration) error {
+	return s.storage.Set(ctx, key, result, ttl)
+}
+
+// IndexCompletion 把缓存回答的规范化查询加入相似问题索引，每次加入时刷新索引的有效期
+func (s *CacheService) IndexCompletion(ctx context.Context, indexKey, cacheKey, query string, ttl time.Duration) error {
+	return s.storage.HSet(ctx, indexKey, cacheKey, query, ttl)
+}
+
+// IndexedCompletions 返回索引中的全部条目：缓存键 -> 规范化查询
+func (s *CacheService) IndexedCompletions(ctx context.Context, indexKey string) (map[string]string, error) {
+	return s.storage.HGetAll(ctx, indexKey)
+}
+
+// IndexSize 返回索引中的条目数
+func (s *CacheService) IndexSize(ctx context.Context, indexKey string) (int64, error) {
+	return s.storage.HLen(ctx, indexKey)
+}
+
+// RemoveFromIndex 删除已过期回答的索引条目
+func (s *CacheService) RemoveFromIndex(ctx context.Context, indexKey string, cacheKeys ...string) error {
+	return s.storage.HDel(ctx, indexKey, cacheKeys...)
+}
+
+// CompletionLockKey 生成同一缓存键的生成锁
+func (s *CacheService) CompletionLockKey(cacheKey string) string {
+	return strings.Replace(cacheKey, "completion:", "completion:lock:", 1)
 }
 
-// CheckRateLimit 检查用户请求限流
-func (s *CacheService) CheckRateLimit(ctx context.Context, user string, limit int, window time.Duration) (bool, error) {
-	key := s.RateLimitKey(user)
-	exists, err := s.redisClient.Exists(ctx, key)
+// AcquireLock 尝试获取锁，token用于释放时确认持有者
+func (s *CacheService) AcquireLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	return s.storage.SetNX(ctx, key, token, ttl)
+}
+
+// ReleaseLock 释放自己持有的锁，锁已过期并被其他实例获取时不删除
+func (s *CacheService) ReleaseLock(ctx context.Context, key, token string) error {
+	_, err := s.storage.DelIfValue(ctx, key, token)
+	return err
+}
+
+// LockHeld 锁是否仍被持有
+func (s *CacheService) LockHeld(ctx context.Context, key string) (bool, error) {
+	return s.storage.Exists(ctx, key)
+}
+
+// NamespaceVersion 返回命名空间的当前版本。首次使用时登记为版本0，批量失效时据此找到全部命名空间
+func (s *CacheService) NamespaceVersion(ctx context.Context, namespace string) (int64, error) {
+	value, err := s.storage.HGet(ctx, cacheVersionsKey, namespace)
+	if isNotFound(err) {
+		return s.storage.HIncrBy(ctx, cacheVersionsKey, namespace, 0)
+	}
 	if err != nil {
-		return false, err
+		return 0, err
 	}
+	return strconv.ParseInt(value, 10, 64)
+}
 
-	if !exists {
-		// 首次请求，设置计数器为1
-		err = s.redisClient.Set(ctx, key, 1, window)
-		return true, err
+// NamespaceVersions 返回全部已登记的命名空间及其版本
+func (s *CacheService) NamespaceVersions(ctx context.Context) (map[string]int64, error) {
+	raw, err := s.storage.HGetAll(ctx, cacheVersionsKey)
+	if err != nil {
+		return nil, err
 	}
+	versions := make(map[string]int64, len(raw))
+	for namespace, value := range raw {
+		version, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version of cache namespace %s: %q", namespace, value)
+		}
+		versions[namespace] = version
+	}
+	return versions, nil
+}
 
-	// 获取当前计数
-	var count int
-	err = s.redisClient.Get(ctx, key, &count)
+// BumpNamespace 递增命名空间的版本，旧版本的回答立即失效，之后按各自的有效期过期
+func (s *CacheService) BumpNamespace(ctx context.Context, namespace string) (int64, error) {
+	return s.storage.HIncrBy(ctx, cacheVersionsKey, namespace, 1)
+}
+
+// BumpAllNamespaces 递增全部已登记命名空间的版本，返回递增的数量
+func (s *CacheService) BumpAllNamespaces(ctx context.Context) (int, error) {
+	versions, err := s.NamespaceVersions(ctx)
 	if err != nil {
-		return false, err
+		return 0, err
+	}
+	bumped := 0
+	for namespace := range versions {
+		if _, err := s.BumpNamespace(ctx, namespace); err != nil {
+			return bumped, err
+		}
+		bumped++
 	}
+	return bumped, nil
+}
 
-	if count >= limit {
-		return false, nil
+// deleteKeys 分批删除，返回已删除的数量
+func (s *CacheService) deleteKeys(ctx context.Context, keys []string) (int, error) {
+	for start := 0; start < len(keys); start += 500 {
+		end := start + 500
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err := s.storage.Del(ctx, keys[start:end]...); err != nil {
+			return start, err
+		}
 	}
+	return len(keys), nil
+}
 
-	// 增加计数
-	count++
-	err = s.redisClient.Set(ctx, key, count, window)
-	return true, err
+// completionNamespace 解析回答的缓存键 completion:<namespace>:<hash>，索引和锁等其他键返回false
+func completionNamespace(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, "completion:")
+	if !ok {
+		return "", false
+	}
+	parts := strings.Split(rest, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+	return parts[0], true
 }
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ai-generation/internal/types"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	warmupDefaultConcurrency = 4
+	warmupMaxConcurrency     = 32
+	// warmupMaxItems 一次预热的问题上限
+	warmupMaxItems = 5000
+	// warmupUser 问题未指定用户时使用的用户
+	warmupUser = "cache_warmup"
+)
+
+// CacheWarmer 展会开放前预先回答常见问题：按正常流程请求Dify、校验并写入缓存，
+// 报告失败和不合格的回答。预热不占用限流额度
+type CacheWarmer struct {
+	aiService *AIService
+	audit     *AuditLog
+}
+
+// NewCacheWarmer 创建缓存预热
+func NewCacheWarmer(aiService *AIService, audit *AuditLog) *CacheWarmer {
+	return &CacheWarmer{aiService: aiService, audit: audit}
+}
+
+// WarmCache 以有限的并发预热问题清单，全部完成后返回报告；ctx取消时未开始的问题记为失败
+func (w *CacheWarmer) WarmCache(ctx context.Context, req *types.WarmupRequest, actor string) (*types.WarmupResult, error) {
+	if len(req.Items) == 0 {
+		return nil, badRequestError("no queries to warm up")
+	}
+	if len(req.Items) > warmupMaxItems {
+		return nil, badRequestError(fmt.Sprintf("too many queries: %d, at most %d per warmup", len(req.Items), warmupMaxItems))
+	}
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = warmupDefaultConcurrency
+	}
+	if concurrency > warmupMaxConcurrency {
+		concurrency = warmupMaxConcurrency
+	}
+
+	startedAt := time.Now()
+	result := &types.WarmupResult{Total: len(req.Items), Issues: make([]*types.WarmupIssue, 0)}
+	var mu sync.Mutex
+	group := &errgroup.Group{}
+	group.SetLimit(concurrency)
+	for i := range req.Items {
+		item := req.Items[i]
+		if item.Line == 0 {
+			item.Line = i + 1
+		}
+		group.Go(func() error {
+			status, issue := w.warm(ctx, &item, req.Refresh)
+			mu.Lock()
+			defer mu.Unlock()
+			switch status {
+			case types.WarmupWarmed:
+				result.Warmed++
+			case types.WarmupSkipped:
+				result.Skipped++
+			case types.WarmupViolation:
+				result.Violations++
+			default:
+				result.Failed++
+			}
+			if issue != nil {
+				result.Issues = append(result.Issues, issue)
+			}
+			return nil
+		})
+	}
+	_ = group.Wait()
+	sort.Slice(result.Issues, func(i, j int) bool { return result.Issues[i].Line < result.Issues[j].Line })
+	result.Duration = time.Since(startedAt).Milliseconds()
+
+	entry := w.audit.Record(ctx, actor, "cache_warmup", fmt.Sprintf("%d queries", result.Total), map[string]interface{}{
+		"warmed":     result.Warmed,
+		"skipped":    result.Skipped,
+		"failed":     result.Failed,
+		"violations": result.Violations,
+		"refresh":    req.Refresh,
+	})
+	result.AuditID = entry.ID
+	return result, nil
+}
+
+// warm 预热一个问题。与 GetCompletion 相同地选择设备型号、计算缓存键并合并相同的进行中请求，
+// 只是不检查限流，也不使用相似问题的回答
+func (w *CacheWarmer) warm(ctx context.Context, item *types.WarmupItem, refresh bool) (string, *types.WarmupIssue) {
+	s := w.aiService
+	issue := &types.WarmupIssue{Line: item.Line, Query: item.Query, DeviceType: item.DeviceType, Status: types.WarmupFailed}
+	if err := ctx.Err(); err != nil {
+		issue.Message = err.Error()
+		return issue.Status, issue
+	}
+	if strings.TrimSpace(item.Query) == "" {
+		issue.Code = http.StatusBadRequest
+		issue.Message = "query is required"
+		return issue.Status, issue
+	}
+	user := item.User
+	if user == "" {
+		user = warmupUser
+	}
+	req := &types.CompletionRequest{
+		Query:      item.Query,
+		Inputs:     item.Inputs,
+		DeviceType: item.DeviceType,
+		DeviceID:   item.DeviceID,
+		User:       user,
+	}
+	profile, err := s.profiles.Resolve(req.DeviceType, req.DeviceID)
+	if err != nil {
+		issue.Code = http.StatusBadRequest
+		issue.Message = err.Error()
+		return issue.Status, issue
+	}
+	deviceType := profileType(profile)
+	issue.DeviceType = deviceType
+	parts, ok := s.cacheKeyParts(ctx, req, deviceType)
+	if !ok {
+		issue.Code = http.StatusBadRequest
+		issue.Message = "query is not cacheable under the current cache policy"
+		return issue.Status, issue
+	}
+	cacheKey := s.cacheService.CacheKey(parts)
+	if !refresh {
+		exists, err := s.cacheService.storage.Exists(ctx, cacheKey)
+		if err == nil && exists {
+			return types.WarmupSkipped, nil
+		}
+	}
+
+	resp, stored, err := s.coalesce(ctx, req, profile, deviceType, cacheKey, time.Now(), refresh)
+	if err != nil {
+		issue.Message = err.Error()
+		return issue.Status, issue
+	}
+	if resp.Data != nil {
+		issue.Diagnostics = warmupViolations(resp.Data.Diagnostics)
+	}
+	// refresh时不使用旧回答，只有本次生成并写入缓存的回答才算预热成功
+	issue.Cached = stored
+	issue.Code = resp.Code
+	issue.Message = resp.Msg
+	switch {
+	case resp.Code != http.StatusOK && !isSchemaViolation(resp):
+		return issue.Status, issue
+	case !issue.Cached:
+		// 降级为纯文本或无法解析的回答不会写入缓存
+		issue.Status = types.WarmupViolation
+		return issue.Status, issue
+	case len(issue.Diagnostics) > 0:
+		issue.Status = types.WarmupViolation
+		issue.Message = "cached with actions that failed validation"
+		return issue.Status, issue
+	}
+	return types.WarmupWarmed, nil
+}
+
+// isSchemaViolation 回答无法解析为约定的JSON格式
+func isSchemaViolation(resp *types.CompletionResponse) bool {
+	return strings.HasPrefix(resp.Msg, "invalid JSON format in answer")
+}
+
+// warmupViolations 需要人工检查的校验结果：被丢弃或被修正的动作
+func warmupViolations(diagnostics []types.Diagnostic) []types.Diagnostic {
+	var violations []types.Diagnostic
+	for _, d := range diagnostics {
+		if d.Severity == SeverityDropped || d.Severity == SeverityRepaired {
+			violations = append(violations, d)
+		}
+	}
+	return violations
+}
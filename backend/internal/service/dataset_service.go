@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ai-generation/internal/api"
+	"github.com/ai-generation/pkg/dify"
+)
+
+const (
+	// datasetIndexPollInterval 查询上传批次索引进度的间隔
+	datasetIndexPollInterval = 5 * time.Second
+	// datasetIndexTimeout 等待索引完成的最长时间，超时后同样递增版本
+	datasetIndexTimeout = 30 * time.Minute
+)
+
+// DatasetService 知识库管理服务，文档变更后及索引结束后失效本应用的缓存回答
+type DatasetService struct {
+	datasetClient *dify.DatasetClient
+	cacheService  *CacheService
+	// 与本应用关联的知识库，为空时不限制
+	datasetIDs map[string]bool
+	// namespace 本应用的缓存命名空间，知识库变更后递增其版本
+	namespace string
+}
+
+func NewDatasetService(datasetClient *dify.DatasetClient, cacheService *CacheService, datasetIDs []string, namespace string) *DatasetService {
+	managed := make(map[string]bool, len(datasetIDs))
+	for _, id := range datasetIDs {
+		managed[id] = true
+	}
+	return &DatasetService{
+		datasetClient: datasetClient,
+		cacheService:  cacheService,
+		datasetIDs:    managed,
+		namespace:     namespace,
+	}
+}
+
+func (s *DatasetService) CreateDocumentByText(datasetID string, req *dify.DocumentRequest) (*dify.DocumentResponse, error) {
+	if err := s.checkDataset(datasetID); err != nil {
+		return nil, err
+	}
+	resp, err := s.datasetClient.CreateDocumentByText(datasetID, req)
+	if err != nil {
+		return nil, wrapDifyError(err)
+	}
+	s.invalidate(datasetID)
+	s.invalidateWhenIndexed(datasetID, resp.Batch)
+	return resp, nil
+}
+
+func (s *DatasetService) CreateDocumentByFile(datasetID string, req *dify.DocumentRequest, filename string, file io.Reader) (*dify.DocumentResponse, error) {
+	if err := s.checkDataset(datasetID); err != nil {
+		return nil, err
+	}
+	resp, err := s.datasetClient.CreateDocumentByFile(datasetID, req, filename, file)
+	if err != nil {
+		return nil, wrapDifyError(err)
+	}
+	s.invalidate(datasetID)
+	s.invalidateWhenIndexed(datasetID, resp.Batch)
+	return resp, nil
+}
+
+func (s *DatasetService) UpdateDocumentByText(datasetID, documentID string, req *dify.DocumentRequest) (*dify.DocumentResponse, error) {
+	if err := s.checkDataset(datasetID); err != nil {
+		return nil, err
+	}
+	resp, err := s.datasetClient.UpdateDocumentByText(datasetID, documentID, req)
+	if err != nil {
+		return nil, wrapDifyError(err)
+	}
+	s.invalidate(datasetID)
+	s.invalidateWhenIndexed(datasetID, resp.Batch)
+	return resp, nil
+}
+
+func (s *DatasetService) UpdateDocumentByFile(datasetID, documentID string, req *dify.DocumentRequest, filename string, file io.Reader) (*dify.DocumentResponse, error) {
+	if err := s.checkDataset(datasetID); err != nil {
+		return nil, err
+	}
+	resp, err := s.datasetClient.UpdateDocumentByFile(datasetID, documentID, req, filename, file)
+	if err != nil {
+		return nil, wrapDifyError(err)
+	}
+	s.invalidate(datasetID)
+	s.invalidateWhenIndexed(datasetID, resp.Batch)
+	return resp, nil
+}
+
+func (s *DatasetService) DeleteDocument(datasetID, documentID string) error {
+	if err := s.checkDataset(datasetID); err != nil {
+		return err
+	}
+	if err := s.datasetClient.DeleteDocument(datasetID, documentID); err != nil {
+		return wrapDifyError(err)
+	}
+	s.invalidate(datasetID)
+	return nil
+}
+
+func (s *DatasetService) ListDocuments(datasetID, keyword string, page, limit int) (*dify.DocumentList, error) {
+	if err := s.checkDataset(datasetID); err != nil {
+		return nil, err
+	}
+	resp, err := s.datasetClient.ListDocuments(datasetID, keyword, page, limit)
+	return resp, wrapDifyError(err)
+}
+
+func (s *DatasetService) ListSegments(datasetID, documentID, keyword, status string) (*dify.SegmentList, error) {
+	if err := s.checkDataset(datasetID); err != nil {
+		return nil, err
+	}
+	resp, err := s.datasetClient.ListSegments(datasetID, documentID, keyword, status)
+	return resp, wrapDifyError(err)
+}
+
+func (s *DatasetService) IndexingStatus(datasetID, batch string) (*dify.IndexingStatusList, error) {
+	if err := s.checkDataset(datasetID); err != nil {
+		return nil, err
+	}
+	resp, err := s.datasetClient.IndexingStatus(datasetID, batch)
+	return resp, wrapDifyError(err)
+}
+
+// checkDataset 只允许操作与本应用关联的知识库
+func (s *DatasetService) checkDataset(datasetID string) error {
+	if len(s.datasetIDs) > 0 && !s.datasetIDs[datasetID] {
+		return &api.HTTPError{StatusCode: http.StatusNotFound, Message: fmt.Sprintf("dataset %s is not managed by this service", datasetID)}
+	}
+	return nil
+}
+
+// invalidate 文档变更后递增本应用缓存命名空间的版本，旧回答立即失效；失败只记录日志，文档操作本身已成功
+func (s *DatasetService) invalidate(datasetID string) {
+	version, err := s.cacheService.BumpNamespace(context.Background(), s.namespace)
+	if err != nil {
+		fmt.Printf("failed to invalidate cached completions after dataset %s changed: %v\n", datasetID, err)
+		return
+	}
+	fmt.Printf("dataset %s changed, cache namespace %s bumped to version %d\n", datasetID, s.namespace, version)
+}
+
+// invalidateWhenIndexed Dify异步索引文档，索引期间生成的回答仍基于旧内容并按新版本缓存；
+// 在后台等待该批次的文档全部索引结束（完成、出错或超时）后再递增一次版本
+func (s *DatasetService) invalidateWhenIndexed(datasetID, batch string) {
+	if batch == "" {
+		return
+	}
+	go func() {
+		deadline := time.Now().Add(datasetIndexTimeout)
+		for time.Now().Before(deadline) {
+			time.Sleep(datasetIndexPollInterval)
+			status, err := s.datasetClient.IndexingStatus(datasetID, batch)
+			if err != nil {
+				fmt.Printf("failed to check indexing status of dataset %s batch %s: %v\n", datasetID, batch, err)
+				continue
+			}
+			if indexingFinished(status) {
+				break
+			}
+		}
+		s.invalidate(datasetID)
+	}()
+}
+
+// indexingFinished 批次中的文档都不再处于索引中
+func indexingFinished(status *dify.IndexingStatusList) bool {
+	for _, document := range status.Data {
+		switch document.IndexingStatus {
+		case "completed", "error", "paused", "stopped":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// wrapDifyError 将Dify的错误状态码转换为HTTPError透传给调用方
+func wrapDifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr *dify.APIError
+	if errors.As(err, &apiErr) {
+		return &api.HTTPError{StatusCode: apiErr.StatusCode, Message: apiErr.Message}
+	}
+	return err
+}
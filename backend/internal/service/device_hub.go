@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ai-generation/internal/types"
+)
+
+const (
+	// emergencyStopChannel 急停广播频道，所有实例都订阅
+	emergencyStopChannel = "device:emergency_stop"
+	// deviceQueueSize 每台设备排队等待下发的指令数量上限
+	deviceQueueSize = 64
+	// StatusEmergencyStopped 请求被急停取消时返回的状态码，沿用客户端关闭请求的499
+	StatusEmergencyStopped = 499
+)
+
+// fleetTasks 没有指定设备的请求登记的位置，只有停止全部设备时才取消
+const fleetTasks = ""
+
+// ErrEmergencyStopped 请求因急停被取消
+var ErrEmergencyStopped = errors.New("cancelled by emergency stop")
+
+// ErrDeviceNotConnected 设备没有连接到本实例
+var ErrDeviceNotConnected = errors.New("device not connected")
+
+// DeviceHub 管理连接到本实例的机器人、它们的待下发指令，以及进行中的Dify请求
+type DeviceHub struct {
+	cacheService *CacheService
+	audit        *AuditLog
+	instanceID   string
+
+	mu sync.Mutex
+	// sessions 每台设备的指令通道，按连接先后排列；重连时旧通道在其连接结束前仍接收急停
+	sessions map[string][]*DeviceSession
+	// tasks 按设备ID登记的进行中请求，没有device_id的请求登记在 fleetTasks 下
+	tasks    map[string]map[uint64]context.CancelCauseFunc
+	nextTask uint64
+}
+
+// DeviceSession 一台机器人的指令通道；急停指令走独立通道，总是先于排队的动作送达
+type DeviceSession struct {
+	DeviceID string
+	stop     chan *types.DeviceCommand
+	queue    chan *types.DeviceCommand
+	closed   chan struct{}
+}
+
+// emergencyStopMessage 实例之间广播的急停消息
+type emergencyStopMessage struct {
+	Origin    string   `json:"origin"`
+	CommandID string   `json:"command_id"`
+	DeviceIDs []string `json:"device_ids"`
+	Reason    string   `json:"reason"`
+}
+
+// NewDeviceHub 创建设备中心
+func NewDeviceHub(cacheService *CacheService, audit *AuditLog) *DeviceHub {
+	return &DeviceHub{
+		cacheService: cacheService,
+		audit:        audit,
+		instanceID:   newID(),
+		sessions:     make(map[string][]*DeviceSession),
+		tasks:        make(map[string]map[uint64]context.CancelCauseFunc),
+	}
+}
+
+// Run 订阅其他实例发出的急停广播，直到ctx取消；连接断开后自动重试
+func (h *DeviceHub) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := h.cacheService.storage.Subscribe(ctx, emergencyStopChannel, func(payload []byte) {
+			var msg emergencyStopMessage
+			if err := json.Unmarshal(payload, &msg); err != nil {
+				fmt.Printf("invalid emergency stop message: %v\n", err)
+				return
+			}
+			if msg.Origin == h.instanceID {
+				return
+			}
+			result := h.stopLocal(msg.CommandID, msg.DeviceIDs, msg.Reason)
+			fmt.Printf("收到急停广播 %s: 下发%d台，取消%d个请求，清除%d个动作\n", msg.CommandID, len(result.Delivered), result.CancelledTasks, result.PurgedActions)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Printf("急停广播订阅中断，稍后重试: %v\n", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(3 * time.Second):
+		}
+	}
+}
+
+// Connect 机器人建立指令通道。同一设备重复连接时不关闭旧通道：动作只下发给最新的通道，
+// 急停下发给全部通道，直到旧连接自行结束
+func (h *DeviceHub) Connect(deviceID string) *DeviceSession {
+	session := &DeviceSession{
+		DeviceID: deviceID,
+		stop:     make(chan *types.DeviceCommand, 1),
+		queue:    make(chan *types.DeviceCommand, deviceQueueSize),
+		closed:   make(chan struct{}),
+	}
+	h.mu.Lock()
+	h.sessions[deviceID] = append(h.sessions[deviceID], session)
+	connections := len(h.sessions[deviceID])
+	h.mu.Unlock()
+	if connections > 1 {
+		fmt.Printf("设备 %s 已连接（共%d个连接，急停下发给全部连接）\n", deviceID, connections)
+	} else {
+		fmt.Printf("设备 %s 已连接\n", deviceID)
+	}
+	return session
+}
+
+// Disconnect 关闭并移除指令通道
+func (h *DeviceHub) Disconnect(session *DeviceSession) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sessions := h.sessions[session.DeviceID]
+	for i, current := range sessions {
+		if current != session {
+			continue
+		}
+		sessions = append(sessions[:i:i], sessions[i+1:]...)
+		if len(sessions) == 0 {
+			delete(h.sessions, session.DeviceID)
+		} else {
+			h.sessions[session.DeviceID] = sessions
+		}
+		close(session.closed)
+		fmt.Printf("设备 %s 已断开\n", session.DeviceID)
+		return
+	}
+}
+
+// Serve 为机器人建立指令通道并逐条调用send，直到ctx取消或send失败
+func (h *DeviceHub) Serve(ctx context.Context, deviceID string, send func(cmd *types.DeviceCommand) error) error {
+	session := h.Connect(deviceID)
+	defer h.Disconnect(session)
+	for {
+		cmd, err := session.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if err := send(cmd); err != nil {
+			return err
+		}
+	}
+}
+
+// ConnectedDevices 返回连接到本实例的设备
+func (h *DeviceHub) ConnectedDevices() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	devices := make([]string, 0, len(h.sessions))
+	for id := range h.sessions {
+		devices = append(devices, id)
+	}
+	sort.Strings(devices)
+	return devices
+}
+
+// Next 等待下一条指令，急停指令优先；通道关闭时返回ErrDeviceNotConnected
+func (s *DeviceSession) Next(ctx context.Context) (*types.DeviceCommand, error) {
+	select {
+	case cmd := <-s.stop:
+		return cmd, nil
+	default:
+	}
+	select {
+	case cmd := <-s.stop:
+		return cmd, nil
+	case cmd := <-s.queue:
+		return cmd, nil
+	case <-s.closed:
+		return nil, ErrDeviceNotConnected
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Push 把指令排入设备最新连接的下发队列
+func (h *DeviceHub) Push(cmd *types.DeviceCommand) error {
+	h.mu.Lock()
+	sessions := h.sessions[cmd.DeviceID]
+	h.mu.Unlock()
+	if len(sessions) == 0 {
+		return ErrDeviceNotConnected
+	}
+	session := sessions[len(sessions)-1]
+	select {
+	case session.queue <- cmd:
+		return nil
+	default:
+		return fmt.Errorf("device %s queue is full", cmd.DeviceID)
+	}
+}
+
+// Track 登记一个进行中的请求，急停时通过返回的ctx取消；请求结束后必须调用release。
+// deviceID为空的请求不属于某台设备，只在停止全部设备时取消
+func (h *DeviceHub) Track(parent context.Context, deviceID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	h.mu.Lock()
+	h.nextTask++
+	id := h.nextTask
+	if h.tasks[deviceID] == nil {
+		h.tasks[deviceID] = make(map[uint64]context.CancelCauseFunc)
+	}
+	h.tasks[deviceID][id] = cancel
+	h.mu.Unlock()
+
+	return ctx, func() {
+		h.mu.Lock()
+		delete(h.tasks[deviceID], id)
+		if len(h.tasks[deviceID]) == 0 {
+			delete(h.tasks, deviceID)
+		}
+		h.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// EmergencyStop 停止指定设备（为空时停止全部）：取消进行中的Dify请求、清空待下发的动作、
+// 向已连接的机器人推送高优先级stop指令，并广播给其他实例执行，最后写入审计记录
+func (h *DeviceHub) EmergencyStop(ctx context.Context, req *types.EmergencyStopRequest, actor string) *types.EmergencyStopResult {
+	commandID := newID()
+	result := h.stopLocal(commandID, req.DeviceIDs, req.Reason)
+
+	msg := emergencyStopMessage{Origin: h.instanceID, CommandID: commandID, DeviceIDs: req.DeviceIDs, Reason: req.Reason}
+	if err := h.cacheService.storage.Publish(ctx, emergencyStopChannel, msg); err != nil {
+		fmt.Printf("急停广播失败，仅停止本实例的设备: %v\n", err)
+	} else {
+		result.Broadcast = true
+	}
+
+	target := "all"
+	if len(req.DeviceIDs) > 0 {
+		target = fmt.Sprintf("%v", req.DeviceIDs)
+	}
+	entry := h.audit.Record(ctx, actor, "emergency_stop", target, map[string]interface{}{
+		"command_id":      commandID,
+		"reason":          req.Reason,
+		"delivered":       result.Delivered,
+		"cancelled_tasks": result.CancelledTasks,
+		"purged_actions":  result.PurgedActions,
+		"broadcast":       result.Broadcast,
+	})
+	result.AuditID = entry.ID
+	return result
+}
+
+// stopLocal 在本实例上执行急停
+func (h *DeviceHub) stopLocal(commandID string, deviceIDs []string, reason string) *types.EmergencyStopResult {
+	result := &types.EmergencyStopResult{CommandID: commandID, Delivered: []string{}}
+	targets := make(map[string]bool, len(deviceIDs))
+	for _, id := range deviceIDs {
+		targets[id] = true
+	}
+	all := len(targets) == 0
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for deviceID, tasks := range h.tasks {
+		if !all && (deviceID == fleetTasks || !targets[deviceID]) {
+			continue
+		}
+		for _, cancel := range tasks {
+			cancel(ErrEmergencyStopped)
+			result.CancelledTasks++
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	for deviceID, sessions := range h.sessions {
+		if !all && !targets[deviceID] {
+			continue
+		}
+		for _, session := range sessions {
+			// 清空排队的动作
+		drain:
+			for {
+				select {
+				case <-session.queue:
+					result.PurgedActions++
+				default:
+					break drain
+				}
+			}
+			// stop通道容量为1，已有未读取的stop时替换为最新的
+			select {
+			case <-session.stop:
+			default:
+			}
+			session.stop <- &types.DeviceCommand{
+				ID:        commandID,
+				DeviceID:  deviceID,
+				Type:      types.DeviceCommandStop,
+				Priority:  types.PriorityEmergency,
+				Reason:    reason,
+				CreatedAt: now,
+			}
+		}
+		result.Delivered = append(result.Delivered, deviceID)
+	}
+	sort.Strings(result.Delivered)
+	return result
+}
@@ -0,0 +1,363 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ai-generation/internal/api"
+	"github.com/ai-generation/internal/types"
+)
+
+// 内置设备型号
+const (
+	DeviceTypeGeneric    = "generic"
+	DeviceTypeYan        = "yan"
+	DeviceTypeCruzr      = "cruzr"
+	DeviceTypeUnitreeROS = "unitree_ros"
+)
+
+// FieldTransform 对象参数中单个字段的变换：先重命名，再按 value*Scale+Offset 换算数值
+type FieldTransform struct {
+	Rename string   `json:"rename,omitempty"`
+	Scale  *float64 `json:"scale,omitempty"`
+	Offset float64  `json:"offset,omitempty"`
+}
+
+// ActionMapping 通用动作到设备动作的翻译规则
+type ActionMapping struct {
+	// Action 设备上的动作名，为空时沿用通用动作名
+	Action string `json:"action,omitempty"`
+	// Params 固定参数，设置后忽略LLM给出的参数，如把举手翻译成一组舵机角度
+	Params interface{} `json:"params,omitempty"`
+	// Fields 对象参数的字段变换
+	Fields map[string]FieldTransform `json:"fields,omitempty"`
+	// Defaults 对象参数中缺省时补充的字段
+	Defaults map[string]interface{} `json:"defaults,omitempty"`
+	// TextField 不为空时把文本参数包装成 {TextField: 文本}
+	TextField string `json:"text_field,omitempty"`
+}
+
+// DeviceProfile 一种机器人型号的能力声明和动作翻译规则
+type DeviceProfile struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+	// Capabilities 设备支持的通用动作，为空表示全部支持
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Actions 通用动作名到设备动作的翻译，未列出的动作原样下发
+	Actions map[string]ActionMapping `json:"actions,omitempty"`
+	// Substitutions 不支持的动作改用的通用动作，值为空表示直接丢弃
+	Substitutions map[string]string `json:"substitutions,omitempty"`
+	// Safety 安全限位，检查翻译后的设备动作
+	Safety *SafetyLimits `json:"safety,omitempty"`
+}
+
+// DeviceProfiles 设备型号表，以及设备ID到型号的绑定
+type DeviceProfiles struct {
+	profiles map[string]*DeviceProfile
+	devices  map[string]string
+}
+
+// deviceProfilesFile 设备配置文件格式
+type deviceProfilesFile struct {
+	Profiles []DeviceProfile   `json:"profiles"`
+	Devices  map[string]string `json:"devices"`
+}
+
+// DefaultDeviceProfiles 内置的设备型号，舵机编号和角度以Yan的 ServoName/ServoAngle 标定为准
+func DefaultDeviceProfiles() []DeviceProfile {
+	return []DeviceProfile{
+		{
+			Type: DeviceTypeGeneric,
+			Name: "通用动作，不做翻译",
+		},
+		{
+			Type:         DeviceTypeYan,
+			Name:         "UBTech Yan",
+			Capabilities: []string{"handsup", "handsdown", "headturn", "servo_move", "voice", "led"},
+			Actions: map[string]ActionMapping{
+				"handsup": {
+					Action: "servo_move",
+					Params: []interface{}{
+						map[string]interface{}{"servo": 2, "angle": 180, "duration": 1000},
+						map[string]interface{}{"servo": 5, "angle": 0, "duration": 1000},
+					},
+				},
+				"handsdown": {
+					Action: "servo_move",
+					Params: []interface{}{
+						map[string]interface{}{"servo": 2, "angle": 90, "duration": 1000},
+						map[string]interface{}{"servo": 5, "angle": 90, "duration": 1000},
+					},
+				},
+				// 颈部水平舵机为17号，90度为正前方
+				"headturn": {
+					Action:   "servo_move",
+					Fields:   map[string]FieldTransform{"angle": {Offset: 90}},
+					Defaults: map[string]interface{}{"servo": 17, "duration": 800},
+				},
+			},
+			Safety: defaultYanSafety(),
+		},
+		{
+			Type:         DeviceTypeCruzr,
+			Name:         "UBTech Cruzr",
+			Capabilities: []string{"handsup", "handsdown", "headturn", "voice", "led"},
+			Actions: map[string]ActionMapping{
+				"handsup":   {Action: "arm", Params: map[string]interface{}{"pose": "raise", "arm": "both"}},
+				"handsdown": {Action: "arm", Params: map[string]interface{}{"pose": "reset", "arm": "both"}},
+				"headturn":  {Action: "head", Fields: map[string]FieldTransform{"angle": {Rename: "yaw"}}},
+				"voice":     {Action: "tts", TextField: "text"},
+				"led":       {Action: "light"},
+			},
+			Substitutions: map[string]string{
+				"servo_move": "handsup",
+			},
+			Safety: &SafetyLimits{
+				Angles: map[string]AngleLimit{"head.yaw": {Min: -60, Max: 60}},
+			},
+		},
+		{
+			Type:         DeviceTypeUnitreeROS,
+			Name:         "Unitree (ROS)",
+			Capabilities: []string{"handsup", "handsdown", "headturn", "voice"},
+			Actions: map[string]ActionMapping{
+				"handsup":   {Action: "pose", Params: map[string]interface{}{"name": "hello"}},
+				"handsdown": {Action: "pose", Params: map[string]interface{}{"name": "stand"}},
+				// 四足没有独立的头部，以机身偏航代替，角度换算为弧度
+				"headturn": {Action: "body_yaw", Fields: map[string]FieldTransform{"angle": {Rename: "yaw", Scale: float(math.Pi / 180)}}},
+				"voice":    {Action: "tts", TextField: "text"},
+			},
+			Substitutions: map[string]string{
+				"servo_move": "",
+				"led":        "",
+			},
+			Safety: &SafetyLimits{
+				Angles: map[string]AngleLimit{"body_yaw.yaw": {Min: -0.6, Max: 0.6}},
+			},
+		},
+	}
+}
+
+// NewDeviceProfiles 创建设备型号表，devices为设备ID到型号的绑定
+func NewDeviceProfiles(profiles []DeviceProfile, devices map[string]string) (*DeviceProfiles, error) {
+	p := &DeviceProfiles{
+		profiles: make(map[string]*DeviceProfile),
+		devices:  make(map[string]string),
+	}
+	for i := range profiles {
+		profile := profiles[i]
+		profile.Type = strings.ToLower(strings.TrimSpace(profile.Type))
+		if profile.Type == "" {
+			return nil, fmt.Errorf("device profile #%d has empty type", i)
+		}
+		if profile.Safety != nil {
+			if err := profile.Safety.validate(); err != nil {
+				return nil, fmt.Errorf("device profile %s: %w", profile.Type, err)
+			}
+		}
+		p.profiles[profile.Type] = &profile
+	}
+	for id, deviceType := range devices {
+		deviceType = strings.ToLower(strings.TrimSpace(deviceType))
+		if _, ok := p.profiles[deviceType]; !ok {
+			return nil, fmt.Errorf("device %s bound to unknown type %q", id, deviceType)
+		}
+		p.devices[id] = deviceType
+	}
+	return p, nil
+}
+
+// LoadDeviceProfiles 加载内置型号，path不为空时用文件中的型号按type覆盖或追加，并读取设备绑定
+func LoadDeviceProfiles(path string) (*DeviceProfiles, error) {
+	profiles := DefaultDeviceProfiles()
+	var devices map[string]string
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read device profiles: %w", err)
+		}
+		var file deviceProfilesFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("parse device profiles: %w", err)
+		}
+		index := make(map[string]int, len(profiles))
+		for i, profile := range profiles {
+			index[profile.Type] = i
+		}
+		for _, profile := range file.Profiles {
+			if i, ok := index[strings.ToLower(profile.Type)]; ok {
+				profiles[i] = profile
+			} else {
+				profiles = append(profiles, profile)
+			}
+		}
+		devices = file.Devices
+	}
+	return NewDeviceProfiles(profiles, devices)
+}
+
+// Resolve 按请求中的device_type或device_id选择型号，都为空或device_id没有绑定型号时返回nil表示不翻译。
+// 两者同时给出时以device_type为准。
+func (p *DeviceProfiles) Resolve(deviceType, deviceID string) (*DeviceProfile, error) {
+	deviceType = strings.ToLower(strings.TrimSpace(deviceType))
+	if deviceType == "" && deviceID != "" {
+		deviceType = p.devices[deviceID]
+	}
+	if deviceType == "" {
+		return nil, nil
+	}
+	profile, ok := p.profiles[deviceType]
+	if !ok {
+		return nil, &api.HTTPError{StatusCode: http.StatusBadRequest, Message: fmt.Sprintf("unknown device_type %q, available: %s", deviceType, strings.Join(p.Types(), ", "))}
+	}
+	return profile, nil
+}
+
+// Types 返回所有型号
+func (p *DeviceProfiles) Types() []string {
+	names := make([]string, 0, len(p.profiles))
+	for name := range p.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Supports 设备是否支持该通用动作
+func (p *DeviceProfile) Supports(action string) bool {
+	if len(p.Capabilities) == 0 {
+		return true
+	}
+	for _, capability := range p.Capabilities {
+		if capability == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Translate 把已校验的通用动作翻译为设备动作。sources与返回的functions一一对应，
+// 记录翻译前的通用动作，供时间线按通用动作的定义估算时长。
+func (p *DeviceProfile) Translate(functions []types.CompletionFunctions) (translated, sources []types.CompletionFunctions, diagnostics []types.Diagnostic) {
+	translated = make([]types.CompletionFunctions, 0, len(functions))
+	sources = make([]types.CompletionFunctions, 0, len(functions))
+	for i, function := range functions {
+		out, source, diags, ok := p.translateFunction(i, function)
+		diagnostics = append(diagnostics, diags...)
+		if ok {
+			translated = append(translated, out)
+			sources = append(sources, source)
+		}
+	}
+	return translated, sources, diagnostics
+}
+
+func (p *DeviceProfile) translateFunction(index int, function types.CompletionFunctions) (types.CompletionFunctions, types.CompletionFunctions, []types.Diagnostic, bool) {
+	var diagnostics []types.Diagnostic
+	report := func(code, severity, format string, args ...interface{}) {
+		diagnostics = append(diagnostics, types.Diagnostic{
+			Index:    index,
+			Action:   function.Action,
+			Code:     code,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	source := function
+	if !p.Supports(source.Action) {
+		substitute, ok := p.Substitutions[source.Action]
+		if !ok || substitute == "" || !p.Supports(substitute) {
+			report("action_unsupported", SeverityDropped, "action %s is not supported by %s", source.Action, p.Type)
+			return function, source, diagnostics, false
+		}
+		report("action_substituted", SeverityRepaired, "action %s substituted with %s on %s", source.Action, substitute, p.Type)
+		// 替代动作的参数含义不同，不沿用原参数
+		source = types.CompletionFunctions{Action: substitute, Delay: function.Delay}
+	}
+
+	mapping, ok := p.Actions[source.Action]
+	if !ok {
+		return source, source, diagnostics, true
+	}
+
+	out := types.CompletionFunctions{Action: source.Action, Delay: source.Delay, Params: source.Params}
+	if mapping.Action != "" {
+		out.Action = mapping.Action
+	}
+	switch {
+	case mapping.Params != nil:
+		out.Params = copyJSONValue(mapping.Params)
+	case mapping.TextField != "":
+		if text, ok := source.Params.(string); ok {
+			out.Params = map[string]interface{}{mapping.TextField: text}
+		}
+	case len(mapping.Fields) > 0 || len(mapping.Defaults) > 0:
+		out.Params = transformParams(source.Params, mapping)
+	}
+	return out, source, diagnostics, true
+}
+
+// transformParams 对对象或对象数组形式的参数逐个做字段变换，不修改原参数
+func transformParams(params interface{}, mapping ActionMapping) interface{} {
+	switch v := params.(type) {
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = transformParams(item, mapping)
+		}
+		return result
+	case map[string]interface{}:
+		return transformObject(v, mapping)
+	case nil:
+		if len(mapping.Defaults) > 0 {
+			return transformObject(map[string]interface{}{}, mapping)
+		}
+	}
+	return params
+}
+
+func transformObject(obj map[string]interface{}, mapping ActionMapping) map[string]interface{} {
+	result := make(map[string]interface{}, len(obj)+len(mapping.Defaults))
+	for key, value := range obj {
+		transform, ok := mapping.Fields[key]
+		if !ok {
+			result[key] = value
+			continue
+		}
+		if number, ok := value.(float64); ok {
+			if transform.Scale != nil {
+				number *= *transform.Scale
+			}
+			value = number + transform.Offset
+		}
+		if transform.Rename != "" {
+			key = transform.Rename
+		}
+		result[key] = value
+	}
+	for key, value := range mapping.Defaults {
+		if _, ok := result[key]; !ok {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// copyJSONValue 深拷贝固定参数，并统一成JSON解码后的类型(数值为float64)，与LLM给出的参数一致
+func copyJSONValue(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var copied interface{}
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return value
+	}
+	return copied
+}
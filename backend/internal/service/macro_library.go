@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ai-generation/internal/api"
+	"github.com/ai-generation/internal/types"
+)
+
+const (
+	macroKeyPrefix = "macro:"
+	// maxMacroDepth 宏嵌套的最大层数，防止配置错误导致展开爆炸
+	maxMacroDepth = 8
+)
+
+// macroPlaceholder 匹配步骤参数中的 ${name}
+var macroPlaceholder = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
+
+// MacroLibrary 编排宏库，宏定义保存在Redis中，多个实例共享
+type MacroLibrary struct {
+	cacheService *CacheService
+	registry     *ActionRegistry
+}
+
+// NewMacroLibrary 创建宏库
+func NewMacroLibrary(cacheService *CacheService, registry *ActionRegistry) *MacroLibrary {
+	return &MacroLibrary{cacheService: cacheService, registry: registry}
+}
+
+func macroKey(name string) string {
+	return macroKeyPrefix + name
+}
+
+// ListMacros 返回全部宏，按名称排序
+func (l *MacroLibrary) ListMacros(ctx context.Context) ([]*types.Macro, error) {
+	keys, err := l.cacheService.storage.Scan(ctx, macroKeyPrefix+"*", 100)
+	if err != nil {
+		return nil, fmt.Errorf("scan macros: %w", err)
+	}
+	macros := make([]*types.Macro, 0, len(keys))
+	for _, key := range keys {
+		var macro types.Macro
+		if err := l.cacheService.storage.Get(ctx, key, &macro); err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("get macro %s: %w", key, err)
+		}
+		macros = append(macros, &macro)
+	}
+	sort.Slice(macros, func(i, j int) bool { return macros[i].Name < macros[j].Name })
+	return macros, nil
+}
+
+// GetMacro 按名称获取宏，不存在时返回404
+func (l *MacroLibrary) GetMacro(ctx context.Context, name string) (*types.Macro, error) {
+	macro, err := l.lookup(ctx, normalizeActionName(name))
+	if err != nil {
+		return nil, err
+	}
+	if macro == nil {
+		return nil, &api.HTTPError{StatusCode: http.StatusNotFound, Message: fmt.Sprintf("macro %s not found", name)}
+	}
+	return macro, nil
+}
+
+// lookup 获取宏，不存在时返回nil
+func (l *MacroLibrary) lookup(ctx context.Context, name string) (*types.Macro, error) {
+	var macro types.Macro
+	if err := l.cacheService.storage.Get(ctx, macroKey(name), &macro); err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get macro %s: %w", name, err)
+	}
+	return &macro, nil
+}
+
+// SaveMacro 创建或覆盖宏。宏不能与已注册的动作重名，步骤只能引用已注册的动作或其他宏，且不能形成环
+func (l *MacroLibrary) SaveMacro(ctx context.Context, macro *types.Macro, actor string) (*types.Macro, error) {
+	macro.Name = normalizeActionName(macro.Name)
+	if macro.Name == "" {
+		return nil, badRequestError("macro name is required")
+	}
+	if _, ok := l.registry.Lookup(macro.Name); ok {
+		return nil, badRequestError(fmt.Sprintf("macro name %s conflicts with a registered action", macro.Name))
+	}
+	if len(macro.Steps) == 0 {
+		return nil, badRequestError("macro must have at least one step")
+	}
+	variants := make(map[string][]types.CompletionFunctions, len(macro.Variants))
+	for deviceType, steps := range macro.Variants {
+		if len(steps) == 0 {
+			return nil, badRequestError(fmt.Sprintf("variant %s has no steps", deviceType))
+		}
+		variants[strings.ToLower(strings.TrimSpace(deviceType))] = steps
+	}
+	macro.Variants = variants
+
+	existing, err := l.ListMacros(ctx)
+	if err != nil {
+		return nil, err
+	}
+	graph := make(map[string]*types.Macro, len(existing)+1)
+	for _, m := range existing {
+		graph[m.Name] = m
+	}
+	graph[macro.Name] = macro
+	for _, step := range macroSteps(macro) {
+		name := normalizeActionName(step.Action)
+		if _, ok := l.registry.Lookup(name); ok {
+			continue
+		}
+		if _, ok := graph[name]; !ok {
+			return nil, badRequestError(fmt.Sprintf("step action %s is neither a registered action nor a macro", step.Action))
+		}
+	}
+	if cycle := findMacroCycle(graph, macro.Name, nil); cycle != nil {
+		return nil, badRequestError(fmt.Sprintf("macro cycle: %s", strings.Join(cycle, " -> ")))
+	}
+
+	macro.UpdatedAt = time.Now().Unix()
+	macro.UpdatedBy = actor
+	if err := l.cacheService.storage.Set(ctx, macroKey(macro.Name), macro, 0); err != nil {
+		return nil, fmt.Errorf("save macro: %w", err)
+	}
+	l.invalidate(ctx)
+	return macro, nil
+}
+
+// DeleteMacro 删除宏，仍被其他宏引用时拒绝
+func (l *MacroLibrary) DeleteMacro(ctx context.Context, name string) error {
+	name = normalizeActionName(name)
+	macros, err := l.ListMacros(ctx)
+	if err != nil {
+		return err
+	}
+	found := false
+	var referencedBy []string
+	for _, m := range macros {
+		if m.Name == name {
+			found = true
+			continue
+		}
+		for _, step := range macroSteps(m) {
+			if normalizeActionName(step.Action) == name {
+				referencedBy = append(referencedBy, m.Name)
+				break
+			}
+		}
+	}
+	if !found {
+		return &api.HTTPError{StatusCode: http.StatusNotFound, Message: fmt.Sprintf("macro %s not found", name)}
+	}
+	if len(referencedBy) > 0 {
+		return &api.HTTPError{StatusCode: http.StatusConflict, Message: fmt.Sprintf("macro %s is used by %s", name, strings.Join(referencedBy, ", "))}
+	}
+	if err := l.cacheService.storage.Del(ctx, macroKey(name)); err != nil {
+		return fmt.Errorf("delete macro: %w", err)
+	}
+	l.invalidate(ctx)
+	return nil
+}
+
+// invalidate 缓存的回答中保存的是展开后的动作，宏变更后递增全部命名空间的版本，旧回答立即失效
+func (l *MacroLibrary) invalidate(ctx context.Context) {
+	count, err := l.cacheService.BumpAllNamespaces(ctx)
+	if err != nil {
+		fmt.Printf("宏变更后清除缓存失败: %v\n", err)
+		return
+	}
+	fmt.Printf("宏变更，已递增%d个缓存命名空间的版本\n", count)
+}
+
+// Expand 把functions中的宏展开为基础动作。步骤delay与 TIMELINE_DELAY_MODE 同义：
+// absolute模式下每个步骤相对宏的开始时间，relative/sequential模式下只有第一个步骤叠加宏的delay。
+// 未知的动作原样保留，由动作注册表校验时丢弃；宏相关诊断的index指向展开前的位置。
+func (l *MacroLibrary) Expand(ctx context.Context, functions []types.CompletionFunctions, deviceType, delayMode string) ([]types.CompletionFunctions, []types.Diagnostic) {
+	expanded := make([]types.CompletionFunctions, 0, len(functions))
+	var diagnostics []types.Diagnostic
+	loaded := make(map[string]*types.Macro)
+	for i, function := range functions {
+		expanded = append(expanded, l.expand(ctx, i, function, deviceType, delayMode, nil, loaded, &diagnostics)...)
+	}
+	return expanded, diagnostics
+}
+
+func (l *MacroLibrary) expand(ctx context.Context, index int, function types.CompletionFunctions, deviceType, delayMode string, path []string, loaded map[string]*types.Macro, diagnostics *[]types.Diagnostic) []types.CompletionFunctions {
+	report := func(code, severity, format string, args ...interface{}) {
+		*diagnostics = append(*diagnostics, types.Diagnostic{
+			Index:    index,
+			Action:   function.Action,
+			Code:     code,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if _, ok := l.registry.Lookup(function.Action); ok {
+		return []types.CompletionFunctions{function}
+	}
+	name := normalizeActionName(function.Action)
+	macro, ok := loaded[name]
+	if !ok {
+		var err error
+		if macro, err = l.lookup(ctx, name); err != nil {
+			fmt.Printf("宏查询失败: %v\n", err)
+		}
+		loaded[name] = macro
+	}
+	if macro == nil {
+		return []types.CompletionFunctions{function}
+	}
+
+	for _, p := range path {
+		if p == name {
+			report("macro_cycle", SeverityDropped, "macro cycle: %s -> %s", strings.Join(path, " -> "), name)
+			return nil
+		}
+	}
+	if len(path) >= maxMacroDepth {
+		report("macro_too_deep", SeverityDropped, "macro nesting exceeds %d levels", maxMacroDepth)
+		return nil
+	}
+
+	steps := macro.Steps
+	if variant, ok := macro.Variants[deviceType]; ok && deviceType != "" {
+		steps = variant
+	}
+	args := make(map[string]interface{}, len(macro.Params))
+	for k, v := range macro.Params {
+		args[k] = v
+	}
+	if callArgs, ok := decodeJSONString(function.Params).(map[string]interface{}); ok {
+		for k, v := range callArgs {
+			args[k] = v
+		}
+	}
+
+	var result []types.CompletionFunctions
+	for i, step := range steps {
+		step.Params = substituteMacroArgs(step.Params, args)
+		if delayMode == DelayModeAbsolute || i == 0 {
+			step.Delay += function.Delay
+		}
+		result = append(result, l.expand(ctx, index, step, deviceType, delayMode, append(path, name), loaded, diagnostics)...)
+	}
+	if len(path) == 0 {
+		report("macro_expanded", SeverityInfo, "macro %s expanded into %d functions", name, len(result))
+	}
+	return result
+}
+
+// substituteMacroArgs 替换参数中的 ${name}；整个字符串就是占位符时保留参数原本的类型
+func substituteMacroArgs(value interface{}, args map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if m := macroPlaceholder.FindStringSubmatch(v); m != nil && m[0] == v {
+			if arg, ok := args[m[1]]; ok {
+				return arg
+			}
+			return v
+		}
+		return macroPlaceholder.ReplaceAllStringFunc(v, func(placeholder string) string {
+			if arg, ok := args[placeholder[2:len(placeholder)-1]]; ok {
+				return fmt.Sprint(arg)
+			}
+			return placeholder
+		})
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			result[k] = substituteMacroArgs(item, args)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = substituteMacroArgs(item, args)
+		}
+		return result
+	}
+	return value
+}
+
+// macroSteps 宏的默认步骤和所有型号变体的步骤
+func macroSteps(macro *types.Macro) []types.CompletionFunctions {
+	steps := append([]types.CompletionFunctions{}, macro.Steps...)
+	for _, variant := range macro.Variants {
+		steps = append(steps, variant...)
+	}
+	return steps
+}
+
+// findMacroCycle 深度优先查找从name出发的引用环，返回环上的宏名
+func findMacroCycle(graph map[string]*types.Macro, name string, path []string) []string {
+	for i, p := range path {
+		if p == name {
+			return append(append([]string{}, path[i:]...), name)
+		}
+	}
+	macro, ok := graph[name]
+	if !ok {
+		return nil
+	}
+	path = append(path, name)
+	for _, step := range macroSteps(macro) {
+		if cycle := findMacroCycle(graph, normalizeActionName(step.Action), path); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+func badRequestError(msg string) error {
+	return &api.HTTPError{StatusCode: http.StatusBadRequest, Message: msg}
+}
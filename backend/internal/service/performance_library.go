@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ai-generation/internal/api"
+	"github.com/ai-generation/internal/types"
+)
+
+const (
+	performanceKeyPrefix = "performance:"
+	// performanceExportVersion 导出格式的版本，导入时拒绝更高的版本
+	performanceExportVersion = 1
+)
+
+// PerformanceLibrary 表演库，表演保存在Redis中，多个实例共享
+type PerformanceLibrary struct {
+	cacheService *CacheService
+	aiService    *AIService
+	hub          *DeviceHub
+	audit        *AuditLog
+}
+
+// NewPerformanceLibrary 创建表演库，hub为nil时不支持下发
+func NewPerformanceLibrary(cacheService *CacheService, aiService *AIService, hub *DeviceHub, audit *AuditLog) *PerformanceLibrary {
+	return &PerformanceLibrary{cacheService: cacheService, aiService: aiService, hub: hub, audit: audit}
+}
+
+func performanceKey(name string) string {
+	return performanceKeyPrefix + name
+}
+
+// ListPerformances 返回全部表演，按名称排序
+func (l *PerformanceLibrary) ListPerformances(ctx context.Context) ([]*types.Performance, error) {
+	keys, err := l.cacheService.storage.Scan(ctx, performanceKeyPrefix+"*", 100)
+	if err != nil {
+		return nil, fmt.Errorf("scan performances: %w", err)
+	}
+	performances := make([]*types.Performance, 0, len(keys))
+	for _, key := range keys {
+		var performance types.Performance
+		if err := l.cacheService.storage.Get(ctx, key, &performance); err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("get performance %s: %w", key, err)
+		}
+		performances = append(performances, &performance)
+	}
+	sort.Slice(performances, func(i, j int) bool { return performances[i].Name < performances[j].Name })
+	return performances, nil
+}
+
+// GetPerformance 按名称获取表演，不存在时返回404
+func (l *PerformanceLibrary) GetPerformance(ctx context.Context, name string) (*types.Performance, error) {
+	performance, err := l.lookup(ctx, normalizeActionName(name))
+	if err != nil {
+		return nil, err
+	}
+	if performance == nil {
+		return nil, &api.HTTPError{StatusCode: http.StatusNotFound, Message: fmt.Sprintf("performance %s not found", name)}
+	}
+	return performance, nil
+}
+
+// lookup 获取表演，不存在时返回nil
+func (l *PerformanceLibrary) lookup(ctx context.Context, name string) (*types.Performance, error) {
+	var performance types.Performance
+	if err := l.cacheService.storage.Get(ctx, performanceKey(name), &performance); err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get performance %s: %w", name, err)
+	}
+	return &performance, nil
+}
+
+// SavePerformance 创建或覆盖表演。functions必须全部通过动作校验，引用的宏在重放时展开
+func (l *PerformanceLibrary) SavePerformance(ctx context.Context, performance *types.Performance, actor string) (*types.Performance, error) {
+	performance.Name = normalizeActionName(performance.Name)
+	if performance.Name == "" {
+		return nil, badRequestError("performance name is required")
+	}
+	if performance.Content == "" && len(performance.Functions) == 0 {
+		return nil, badRequestError("performance must have content or functions")
+	}
+	_, diagnostics := l.aiService.validateFunctions(performance.Functions, "")
+	for _, d := range diagnostics {
+		if d.Severity == SeverityDropped {
+			return nil, badRequestError(fmt.Sprintf("function #%d %s: %s", d.Index, d.Action, d.Message))
+		}
+	}
+
+	existing, err := l.lookup(ctx, performance.Name)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	performance.CreatedAt = now
+	if existing != nil && existing.CreatedAt != 0 {
+		performance.CreatedAt = existing.CreatedAt
+	}
+	performance.UpdatedAt = now
+	performance.UpdatedBy = actor
+	if err := l.cacheService.storage.Set(ctx, performanceKey(performance.Name), performance, 0); err != nil {
+		return nil, fmt.Errorf("save performance: %w", err)
+	}
+	return performance, nil
+}
+
+// DeletePerformance 删除表演
+func (l *PerformanceLibrary) DeletePerformance(ctx context.Context, name string) error {
+	name = normalizeActionName(name)
+	exists, err := l.cacheService.storage.Exists(ctx, performanceKey(name))
+	if err != nil {
+		return fmt.Errorf("check performance: %w", err)
+	}
+	if !exists {
+		return &api.HTTPError{StatusCode: http.StatusNotFound, Message: fmt.Sprintf("performance %s not found", name)}
+	}
+	if err := l.cacheService.storage.Del(ctx, performanceKey(name)); err != nil {
+		return fmt.Errorf("delete performance: %w", err)
+	}
+	return nil
+}
+
+// RecordPerformance 向LLM提问并把回答保存为表演，保存的是校验后、翻译前的通用动作
+func (l *PerformanceLibrary) RecordPerformance(ctx context.Context, name string, req *types.RecordPerformanceRequest, actor string) (*types.Performance, error) {
+	resp, err := l.aiService.GetCompletion(&types.CompletionRequest{
+		Query:        req.Query,
+		Inputs:       req.Inputs,
+		User:         req.User,
+		ParamsFormat: types.ParamsFormatStructured,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Code != http.StatusOK || resp.Data == nil {
+		code := resp.Code
+		if code == 0 {
+			code = http.StatusInternalServerError
+		}
+		return nil, &api.HTTPError{StatusCode: code, Message: fmt.Sprintf("completion failed: %s", resp.Msg)}
+	}
+	return l.SavePerformance(ctx, &types.Performance{
+		Name:        name,
+		Description: req.Description,
+		Content:     resp.Data.Content,
+		Functions:   resp.Data.Functions,
+		SourceQuery: req.Query,
+	}, actor)
+}
+
+// ExportPerformances 导出全部表演
+func (l *PerformanceLibrary) ExportPerformances(ctx context.Context) (*types.PerformanceExport, error) {
+	performances, err := l.ListPerformances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &types.PerformanceExport{
+		Version:      performanceExportVersion,
+		ExportedAt:   time.Now().Unix(),
+		Performances: performances,
+	}, nil
+}
+
+// ImportPerformances 导入表演，overwrite为false时跳过已存在的表演；单个表演校验失败不影响其他表演
+func (l *PerformanceLibrary) ImportPerformances(ctx context.Context, export *types.PerformanceExport, overwrite bool, actor string) (*types.PerformanceImportResult, error) {
+	if export.Version > performanceExportVersion {
+		return nil, badRequestError(fmt.Sprintf("unsupported export version %d", export.Version))
+	}
+	result := &types.PerformanceImportResult{Imported: []string{}, Skipped: []string{}}
+	for i, performance := range export.Performances {
+		if performance == nil {
+			continue
+		}
+		name := normalizeActionName(performance.Name)
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		if !overwrite {
+			exists, err := l.cacheService.storage.Exists(ctx, performanceKey(name))
+			if err != nil {
+				return nil, fmt.Errorf("check performance: %w", err)
+			}
+			if exists {
+				result.Skipped = append(result.Skipped, name)
+				continue
+			}
+		}
+		if _, err := l.SavePerformance(ctx, performance, actor); err != nil {
+			var httpErr *api.HTTPError
+			if !errors.As(err, &httpErr) {
+				return nil, err
+			}
+			if result.Failed == nil {
+				result.Failed = make(map[string]string)
+			}
+			result.Failed[name] = httpErr.Message
+			continue
+		}
+		result.Imported = append(result.Imported, name)
+	}
+	return result, nil
+}
+
+// PlayPerformance 按目标设备展开宏、翻译并编译时间线，返回与生成接口相同的响应；
+// Push为true时把结果作为perform指令下发给连接在本实例上的机器人
+func (l *PerformanceLibrary) PlayPerformance(ctx context.Context, name string, req *types.PlayPerformanceRequest, actor string) (*types.CompletionResponse, error) {
+	performance, err := l.GetPerformance(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if req.Push && req.DeviceID == "" {
+		return nil, badRequestError("device_id is required to push a performance")
+	}
+	data, err := l.aiService.PlanFunctions(&types.CompletionRequest{
+		DeviceType:   req.DeviceType,
+		DeviceID:     req.DeviceID,
+		ParamsFormat: req.ParamsFormat,
+	}, performance.Content, performance.Functions)
+	if err != nil {
+		return nil, err
+	}
+	if !req.Push {
+		return &types.CompletionResponse{Code: http.StatusOK, Msg: "success", Data: data}, nil
+	}
+
+	if l.hub == nil {
+		return nil, &api.HTTPError{StatusCode: http.StatusServiceUnavailable, Message: "device push is not configured"}
+	}
+	cmd := &types.DeviceCommand{
+		ID:        newID(),
+		DeviceID:  req.DeviceID,
+		Type:      types.DeviceCommandPerform,
+		Priority:  types.PriorityNormal,
+		CreatedAt: time.Now().UnixMilli(),
+		Data:      data,
+	}
+	if err := l.hub.Push(cmd); err != nil {
+		if errors.Is(err, ErrDeviceNotConnected) {
+			return nil, &api.HTTPError{StatusCode: http.StatusConflict, Message: fmt.Sprintf("device %s is not connected to this instance", req.DeviceID)}
+		}
+		return nil, &api.HTTPError{StatusCode: http.StatusServiceUnavailable, Message: err.Error()}
+	}
+	if l.audit != nil {
+		l.audit.Record(ctx, actor, "performance_push", req.DeviceID, map[string]interface{}{
+			"performance": performance.Name,
+			"command_id":  cmd.ID,
+		})
+	}
+	return &types.CompletionResponse{Code: http.StatusOK, Msg: "success (pushed)", Data: data}, nil
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// localRateLimitSweep 清理已恢复满额的限流状态的间隔
+const localRateLimitSweep = time.Minute
+
+// localRateLimiter 进程内限流，算法与Redis脚本一致，用于不依赖Redis的单机部署
+type localRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*localBucket
+	windows   map[string]*localWindow
+	lastSweep time.Time
+}
+
+type localBucket struct {
+	tokens float64
+	ts     time.Time
+	// idle 桶装满的时间，之后状态可以丢弃
+	idle time.Time
+}
+
+type localWindow struct {
+	window time.Duration
+	// hits 窗口内请求的时间，从早到晚
+	hits []time.Time
+}
+
+func newLocalRateLimiter() *localRateLimiter {
+	return &localRateLimiter{
+		buckets:   make(map[string]*localBucket),
+		windows:   make(map[string]*localWindow),
+		lastSweep: time.Now(),
+	}
+}
+
+// check 检查并消耗一次配额，limit 已经过 validate
+func (l *localRateLimiter) check(key string, limit RateLimit) *RateLimitResult {
+	return l.checkAt(key, limit, time.Now())
+}
+
+// checkAt 以now为当前时间检查并消耗一次配额
+func (l *localRateLimiter) checkAt(key string, limit RateLimit, now time.Time) *RateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	if limit.Algorithm == RateLimitSlidingWindow {
+		return l.slidingWindow(key, limit, now)
+	}
+	return l.tokenBucket(key, limit, now)
+}
+
+func (l *localRateLimiter) tokenBucket(key string, limit RateLimit, now time.Time) *RateLimitResult {
+	capacity := limit.Limit
+	if limit.Burst > 0 {
+		capacity = limit.Burst
+	}
+	interval := float64(limit.Window) / float64(limit.Limit)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &localBucket{tokens: float64(capacity), ts: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(capacity), b.tokens+float64(now.Sub(b.ts))/interval)
+	b.ts = now
+
+	result := &RateLimitResult{Limit: capacity}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1 - b.tokens) * interval))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration(math.Ceil((float64(capacity) - b.tokens) * interval))
+	b.idle = now.Add(result.Reset)
+	return result
+}
+
+func (l *localRateLimiter) slidingWindow(key string, limit RateLimit, now time.Time) *RateLimitResult {
+	w, ok := l.windows[key]
+	if !ok {
+		w = &localWindow{}
+		l.windows[key] = w
+	}
+	w.window = limit.Window
+	w.expire(now)
+
+	result := &RateLimitResult{Limit: limit.Limit}
+	if len(w.hits) < limit.Limit {
+		w.hits = append(w.hits, now)
+		result.Allowed = true
+	}
+	result.Remaining = limit.Limit - len(w.hits)
+	result.Reset = w.hits[0].Add(limit.Window).Sub(now)
+	if !result.Allowed {
+		result.RetryAfter = result.Reset
+	}
+	return result
+}
+
+// SimulateRateLimit 在新的进程内限流器上按时间顺序模拟同一个key的请求，offsets为各请求相对第一个请求的时间。
+// 进程内限流与Redis脚本的算法一致，用于回归令牌桶和滑动窗口的边界
+func SimulateRateLimit(limit RateLimit, offsets []time.Duration) ([]*RateLimitResult, error) {
+	if err := limit.validate(); err != nil {
+		return nil, err
+	}
+	l := newLocalRateLimiter()
+	start := l.lastSweep
+	results := make([]*RateLimitResult, 0, len(offsets))
+	for _, offset := range offsets {
+		results = append(results, l.checkAt("simulate", limit, start.Add(offset)))
+	}
+	return results, nil
+}
+
+// expire 丢弃窗口外的请求
+func (w *localWindow) expire(now time.Time) {
+	i := 0
+	for i < len(w.hits) && !w.hits[i].After(now.Add(-w.window)) {
+		i++
+	}
+	w.hits = w.hits[i:]
+}
+
+// sweep 定期丢弃已恢复满额的状态，避免大量一次性的key占用内存，调用方必须持有锁
+func (l *localRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < localRateLimitSweep {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if !now.Before(b.idle) {
+			delete(l.buckets, key)
+		}
+	}
+	for key, w := range l.windows {
+		if w.expire(now); len(w.hits) == 0 {
+			delete(l.windows, key)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ai-generation/internal/types"
+)
+
+// 限流维度
+const (
+	RateLimitByUser   = "user"
+	RateLimitByDevice = "device"
+	RateLimitByTenant = "tenant"
+	RateLimitByAPIKey = "api_key"
+	RateLimitByIP     = "ip"
+)
+
+// RateLimitPolicy 一条限流策略：按Key维度的取值分别计数
+type RateLimitPolicy struct {
+	Name string
+	// Key 计数维度，见 RateLimitByUser 等；请求中该维度为空时不适用
+	Key string
+	// Values 只对这些取值生效（如某个租户的专属额度），同一维度上优先于不带Values的策略
+	Values []string
+	// AnonymousOnly 只对没有user的请求生效，如按IP限制匿名请求，避免同一出口（展馆NAT）后的登录用户共用额度
+	AnonymousOnly bool
+	Limit         RateLimit
+}
+
+// rateLimitPolicyFile 策略文件中的一条策略，window使用 "1m"、"10s" 这样的时长字符串
+type rateLimitPolicyFile struct {
+	Name          string   `json:"name"`
+	Key           string   `json:"key"`
+	Values        []string `json:"values,omitempty"`
+	AnonymousOnly bool     `json:"anonymous_only,omitempty"`
+	Algorithm     string   `json:"algorithm"`
+	Limit         int      `json:"limit"`
+	Window        string   `json:"window"`
+	Burst         int      `json:"burst,omitempty"`
+}
+
+// DefaultRateLimitPolicies 默认策略：登录用户按user计数，匿名请求没有user，按客户端IP计数
+func DefaultRateLimitPolicies(limit RateLimit) []RateLimitPolicy {
+	return []RateLimitPolicy{
+		{Name: "user", Key: RateLimitByUser, Limit: limit},
+		{Name: "ip", Key: RateLimitByIP, AnonymousOnly: true, Limit: limit},
+	}
+}
+
+// LoadRateLimitPolicies 从JSON数组文件加载策略，path为空时使用以fallback为额度的默认策略
+func LoadRateLimitPolicies(path string, fallback RateLimit) ([]RateLimitPolicy, error) {
+	if path == "" {
+		return DefaultRateLimitPolicies(fallback), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rate limit policies: %w", err)
+	}
+	return ParseRateLimitPolicies(data)
+}
+
+// ParseRateLimitPolicies 解析策略文件的内容
+func ParseRateLimitPolicies(data []byte) ([]RateLimitPolicy, error) {
+	var file []rateLimitPolicyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse rate limit policies: %w", err)
+	}
+	policies := make([]RateLimitPolicy, 0, len(file))
+	for i, p := range file {
+		window, err := time.ParseDuration(p.Window)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit policy #%d: invalid window %q", i, p.Window)
+		}
+		policies = append(policies, RateLimitPolicy{
+			Name:          p.Name,
+			Key:           p.Key,
+			Values:        p.Values,
+			AnonymousOnly: p.AnonymousOnly,
+			Limit:         RateLimit{Algorithm: p.Algorithm, Limit: p.Limit, Window: window, Burst: p.Burst},
+		})
+	}
+	return policies, nil
+}
+
+// RateLimiter 按策略对请求的各个维度限流，计数保存在Redis中，多个实例共享
+type RateLimiter struct {
+	cacheService *CacheService
+	policies     []RateLimitPolicy
+}
+
+// NewRateLimiter 校验策略并创建限流器，policies为空时不限流
+func NewRateLimiter(cacheService *CacheService, policies []RateLimitPolicy) (*RateLimiter, error) {
+	names := make(map[string]bool, len(policies))
+	checked := make([]RateLimitPolicy, 0, len(policies))
+	for i, policy := range policies {
+		switch policy.Key {
+		case RateLimitByUser, RateLimitByDevice, RateLimitByTenant, RateLimitByAPIKey, RateLimitByIP:
+		default:
+			return nil, fmt.Errorf("rate limit policy #%d: unknown key %q", i, policy.Key)
+		}
+		if policy.Name == "" {
+			policy.Name = fmt.Sprintf("%s_%d", policy.Key, i)
+		}
+		if names[policy.Name] {
+			return nil, fmt.Errorf("rate limit policy #%d: duplicate name %q", i, policy.Name)
+		}
+		names[policy.Name] = true
+		if err := policy.Limit.validate(); err != nil {
+			return nil, fmt.Errorf("rate limit policy %s: %w", policy.Name, err)
+		}
+		checked = append(checked, policy)
+	}
+	return &RateLimiter{cacheService: cacheService, policies: checked}, nil
+}
+
+// Check 依次检查适用于请求的策略，遇到拒绝立即返回；全部通过时返回剩余额度最少的策略。
+// 拒绝前已通过的策略已消耗配额。没有适用的策略时返回nil
+func (l *RateLimiter) Check(ctx context.Context, req *types.CompletionRequest) (*types.RateLimitStatus, error) {
+	var tightest *types.RateLimitStatus
+	for _, policy := range l.applicable(req) {
+		value := rateLimitValue(req, policy.Key)
+		result, err := l.cacheService.CheckRateLimit(ctx, policy.Name+":"+rateLimitSubject(policy.Key, value), policy.Limit)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", policy.Name, err)
+		}
+		status := &types.RateLimitStatus{
+			Policy:     policy.Name,
+			Allowed:    result.Allowed,
+			Limit:      result.Limit,
+			Remaining:  result.Remaining,
+			Reset:      result.Reset,
+			RetryAfter: result.RetryAfter,
+		}
+		if !status.Allowed {
+			return status, nil
+		}
+		if tightest == nil || status.Remaining < tightest.Remaining {
+			tightest = status
+		}
+	}
+	return tightest, nil
+}
+
+// applicable 返回适用于请求的策略：每个维度上指定了取值的策略优先，否则使用该维度的通用策略；
+// 请求带有user时跳过只针对匿名请求的策略
+func (l *RateLimiter) applicable(req *types.CompletionRequest) []RateLimitPolicy {
+	anonymous := rateLimitValue(req, RateLimitByUser) == ""
+	specific := make(map[string]bool)
+	for _, policy := range l.policies {
+		if policy.AnonymousOnly && !anonymous {
+			continue
+		}
+		if value := rateLimitValue(req, policy.Key); value != "" && containsString(policy.Values, value) {
+			specific[policy.Key] = true
+		}
+	}
+	var policies []RateLimitPolicy
+	for _, policy := range l.policies {
+		value := rateLimitValue(req, policy.Key)
+		if value == "" || (policy.AnonymousOnly && !anonymous) {
+			continue
+		}
+		if specific[policy.Key] {
+			if containsString(policy.Values, value) {
+				policies = append(policies, policy)
+			}
+		} else if len(policy.Values) == 0 {
+			policies = append(policies, policy)
+		}
+	}
+	return policies
+}
+
+// checkRateLimit 按策略限流，并把结果记录到请求中供传输层设置响应头
+func (s *AIService) checkRateLimit(ctx context.Context, req *types.CompletionRequest) (*types.RateLimitStatus, error) {
+	status, err := s.rateLimiter.Check(ctx, req)
+	req.RateLimit = status
+	return status, err
+}
+
+func rateLimitValue(req *types.CompletionRequest, key string) string {
+	switch key {
+	case RateLimitByUser:
+		return strings.TrimSpace(req.User)
+	case RateLimitByDevice:
+		return req.DeviceID
+	case RateLimitByTenant:
+		return req.Tenant
+	case RateLimitByAPIKey:
+		return req.APIKey
+	case RateLimitByIP:
+		return req.ClientIP
+	}
+	return ""
+}
+
+// rateLimitSubject API密钥只保存摘要，不把密钥明文写入Redis键名
+func rateLimitSubject(key, value string) string {
+	if key == RateLimitByAPIKey {
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:8])
+	}
+	return value
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
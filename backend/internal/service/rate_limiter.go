@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ai-generation/internal/types"
+	"github.com/ai-generation/pkg/redis"
+)
+
+// 限流算法
+const (
+	// RateLimitTokenBucket 令牌桶：以 Limit/Window 的速度补充令牌，桶容量为Burst，允许短时突发
+	RateLimitTokenBucket = "token_bucket"
+	// RateLimitSlidingWindow 滑动窗口：任意Window时长内最多Limit次，精确但不允许突发
+	RateLimitSlidingWindow = "sliding_window"
+)
+
+// RateLimit 一条限流规则
+type RateLimit struct {
+	Algorithm string        `json:"algorithm"`
+	Limit     int           `json:"limit"`
+	Window    time.Duration `json:"window"`
+	// Burst 令牌桶容量，0表示与Limit相同；滑动窗口不使用
+	Burst int `json:"burst,omitempty"`
+}
+
+// RateLimitResult 限流检查结果
+type RateLimitResult struct {
+	Allowed bool
+	// Limit 桶容量或窗口内的最大次数
+	Limit     int
+	Remaining int
+	// Reset 多久后完全恢复（令牌桶装满或窗口内最早的请求过期）
+	Reset time.Duration
+	// RetryAfter 被拒绝时多久后可以重试
+	RetryAfter time.Duration
+}
+
+// validate 校验并补全限流规则
+func (l *RateLimit) validate() error {
+	switch strings.ToLower(l.Algorithm) {
+	case "":
+		l.Algorithm = RateLimitTokenBucket
+	case RateLimitTokenBucket, RateLimitSlidingWindow:
+		l.Algorithm = strings.ToLower(l.Algorithm)
+	default:
+		return fmt.Errorf("unknown rate limit algorithm %q", l.Algorithm)
+	}
+	if l.Limit <= 0 {
+		return fmt.Errorf("rate limit must be positive, got %d", l.Limit)
+	}
+	if l.Window <= 0 {
+		return fmt.Errorf("rate limit window must be positive, got %s", l.Window)
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("rate limit burst must not be negative, got %d", l.Burst)
+	}
+	return nil
+}
+
+// 两个脚本都使用Redis服务器时间，多个实例之间的时钟偏差不影响结果；返回 {allowed, remaining, reset_ms, retry_ms}
+
+// tokenBucketScript KEYS[1]=桶；ARGV: 容量, 每个令牌的补充毫秒数
+var tokenBucketScript = redis.NewScript(`
+redis.replicate_commands()
+local capacity = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+  tokens = capacity
+  ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) / interval)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = math.ceil((1 - tokens) * interval)
+end
+local reset = math.ceil((capacity - tokens) * interval)
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], reset + 1000)
+return {allowed, math.floor(tokens), reset, retry}
+`)
+
+// slidingWindowScript KEYS[1]=请求时间的有序集合；ARGV: 次数上限, 窗口毫秒数, 本次请求的唯一ID
+var slidingWindowScript = redis.NewScript(`
+redis.replicate_commands()
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+  redis.call('ZADD', KEYS[1], now, ARGV[3])
+  count = count + 1
+  allowed = 1
+end
+
+local reset = 0
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+  reset = tonumber(oldest[2]) + window - now
+end
+local retry = 0
+if allowed == 0 then
+  retry = reset
+end
+redis.call('PEXPIRE', KEYS[1], window)
+return {allowed, limit - count, reset, retry}
+`)
+
+// CheckRateLimit 按规则原子地检查并消耗一次配额。存储支持Lua脚本时多个实例共享同一个计数，
+// 否则在进程内计数；存储暂时不可用时也改为进程内计数，请求不会因此失败
+func (s *CacheService) CheckRateLimit(ctx context.Context, key string, limit RateLimit) (*RateLimitResult, error) {
+	if err := limit.validate(); err != nil {
+		return nil, err
+	}
+	runner, ok := s.storage.(scriptRunner)
+	if !ok {
+		return s.local.check(s.RateLimitKey(limit.Algorithm, key), limit), nil
+	}
+	var (
+		values []int64
+		err    error
+		size   = limit.Limit
+	)
+	switch limit.Algorithm {
+	case RateLimitSlidingWindow:
+		values, err = runner.RunScript(ctx, slidingWindowScript, []string{s.RateLimitKey(limit.Algorithm, key)},
+			limit.Limit, limit.Window.Milliseconds(), newID())
+	default:
+		if limit.Burst > 0 {
+			size = limit.Burst
+		}
+		interval := float64(limit.Window.Milliseconds()) / float64(limit.Limit)
+		values, err = runner.RunScript(ctx, tokenBucketScript, []string{s.RateLimitKey(limit.Algorithm, key)},
+			size, interval)
+	}
+	if err != nil {
+		if s.localFallback.CompareAndSwap(false, true) {
+			fmt.Printf("rate limit storage unavailable, counting in process: %v\n", err)
+		}
+		return s.local.check(s.RateLimitKey(limit.Algorithm, key), limit), nil
+	}
+	if s.localFallback.CompareAndSwap(true, false) {
+		fmt.Printf("rate limit storage recovered\n")
+	}
+	if len(values) != 4 {
+		return nil, fmt.Errorf("unexpected rate limit script result %v", values)
+	}
+	return &RateLimitResult{
+		Allowed:    values[0] == 1,
+		Limit:      size,
+		Remaining:  int(values[1]),
+		Reset:      time.Duration(values[2]) * time.Millisecond,
+		RetryAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+// rateLimitMessage 被限流时的提示，带上触发的策略和可重试的时间
+func rateLimitMessage(result *types.RateLimitStatus) string {
+	seconds := int(math.Ceil(result.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return fmt.Sprintf("rate limit exceeded (%s), retry after %ds", result.Policy, seconds)
+}
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ai-generation/internal/types"
+)
+
+// 超限处理方式
+const (
+	SafetyModeClamp  = "clamp"  // 夹到安全范围内
+	SafetyModeReject = "reject" // 丢弃整个动作
+)
+
+// ServoLimit 单个舵机的限位
+type ServoLimit struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	// MaxSpeed 最大角速度(度/秒)，0表示不限制
+	MaxSpeed float64 `json:"max_speed,omitempty"`
+}
+
+// AngleLimit 设备动作中单个角度字段的范围
+type AngleLimit struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// ServoCondition 舵机角度落在 [Min, Max] 内时条件成立，未设置的一侧不限制
+type ServoCondition struct {
+	Servo int      `json:"servo"`
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+}
+
+// ForbiddenCombination 所有条件同时成立的姿态禁止出现，如双臂交叉相撞
+type ForbiddenCombination struct {
+	Name       string           `json:"name"`
+	Conditions []ServoCondition `json:"conditions"`
+}
+
+// SafetyLimits 设备的安全限位表，作用于翻译后的设备动作
+type SafetyLimits struct {
+	// Mode 超出角度范围或速度时的处理方式，默认clamp；禁止姿态总是丢弃
+	Mode string `json:"mode,omitempty"`
+	// Servos servo_move中按舵机编号的限位，设置后未列出的舵机一律丢弃
+	Servos map[string]ServoLimit `json:"servos,omitempty"`
+	// MinDuration/MaxDuration servo_move运行时间范围(毫秒)
+	MinDuration int `json:"min_duration,omitempty"`
+	MaxDuration int `json:"max_duration,omitempty"`
+	// Angles 其他动作的角度字段范围，键为 "动作.字段"，如 "head.yaw"
+	Angles    map[string]AngleLimit  `json:"angles,omitempty"`
+	Forbidden []ForbiddenCombination `json:"forbidden,omitempty"`
+}
+
+// defaultYanSafety Yan的舵机限位，与设备端 YanServoService.ServoAngle 一致；
+// 舵机运行时间为200-4000ms，最大角速度为保守值
+func defaultYanSafety() *SafetyLimits {
+	ranges := [][2]float64{
+		{0, 180}, {0, 180}, {0, 180}, {0, 180}, {0, 180}, {0, 180}, {0, 120}, {10, 180}, {0, 180},
+		{0, 180}, {65, 180}, {60, 180}, {0, 170}, {0, 180}, {0, 180}, {0, 115}, {15, 165},
+	}
+	servos := make(map[string]ServoLimit, len(ranges))
+	for i, r := range ranges {
+		servos[strconv.Itoa(i+1)] = ServoLimit{Min: r[0], Max: r[1], MaxSpeed: 180}
+	}
+	return &SafetyLimits{
+		Mode:        SafetyModeClamp,
+		Servos:      servos,
+		MinDuration: 200,
+		MaxDuration: 4000,
+		Forbidden: []ForbiddenCombination{
+			{
+				// 双臂同时向内水平收拢会在胸前相撞
+				Name: "arms_crossed",
+				Conditions: []ServoCondition{
+					{Servo: 1, Max: float(30)},
+					{Servo: 4, Min: float(150)},
+				},
+			},
+			{
+				// 双髋同时大幅外展会失去平衡
+				Name: "legs_split",
+				Conditions: []ServoCondition{
+					{Servo: 7, Max: float(60)},
+					{Servo: 12, Min: float(150)},
+				},
+			},
+		},
+	}
+}
+
+// SafetyCheck 一次响应内的安全检查，按functions顺序记录每个舵机最后的目标角度，用于速度和禁止姿态判断
+type SafetyCheck struct {
+	limits *SafetyLimits
+	angles map[int]float64
+}
+
+// NewCheck 开始一次安全检查，limits为nil时不做任何检查
+func (l *SafetyLimits) NewCheck() *SafetyCheck {
+	return &SafetyCheck{limits: l, angles: make(map[int]float64)}
+}
+
+// Apply 检查全部functions，sources与functions一一对应并同步过滤
+func (c *SafetyCheck) Apply(functions, sources []types.CompletionFunctions) ([]types.CompletionFunctions, []types.CompletionFunctions, []types.Diagnostic) {
+	if c.limits == nil {
+		return functions, sources, nil
+	}
+	keptFunctions := make([]types.CompletionFunctions, 0, len(functions))
+	keptSources := make([]types.CompletionFunctions, 0, len(sources))
+	var diagnostics []types.Diagnostic
+	for i, function := range functions {
+		checked, diags, ok := c.Check(i, function)
+		diagnostics = append(diagnostics, diags...)
+		if ok {
+			source := sources[i]
+			if source.Action == checked.Action {
+				// 未翻译的动作按修正后的参数估算时长
+				source = checked
+			}
+			keptFunctions = append(keptFunctions, checked)
+			keptSources = append(keptSources, source)
+		}
+	}
+	return keptFunctions, keptSources, diagnostics
+}
+
+// Check 检查单个设备动作，返回修正后的动作；ok为false表示必须丢弃
+func (c *SafetyCheck) Check(index int, function types.CompletionFunctions) (types.CompletionFunctions, []types.Diagnostic, bool) {
+	if c.limits == nil {
+		return function, nil, true
+	}
+	var diagnostics []types.Diagnostic
+	report := func(code, severity, format string, args ...interface{}) {
+		d := types.Diagnostic{
+			Index:    index,
+			Action:   function.Action,
+			Code:     code,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		}
+		fmt.Printf("安全限位[%d] %s %s: %s\n", index, d.Severity, d.Code, d.Message)
+		diagnostics = append(diagnostics, d)
+	}
+
+	if function.Action == "servo_move" && len(c.limits.Servos) > 0 {
+		params, ok := c.checkServoMove(function.Params, report)
+		if !ok {
+			return function, diagnostics, false
+		}
+		function.Params = params
+		return function, diagnostics, true
+	}
+
+	params, ok := function.Params.(map[string]interface{})
+	if !ok {
+		return function, diagnostics, true
+	}
+	var checked map[string]interface{}
+	for field, value := range params {
+		limit, ok := c.limits.Angles[function.Action+"."+field]
+		if !ok {
+			continue
+		}
+		angle, ok := value.(float64)
+		if !ok || (angle >= limit.Min && angle <= limit.Max) {
+			continue
+		}
+		if c.limits.Mode == SafetyModeReject {
+			report("angle_out_of_range", SeverityDropped, "%s %.4g outside [%.4g, %.4g]", field, angle, limit.Min, limit.Max)
+			return function, diagnostics, false
+		}
+		if checked == nil {
+			checked = copyJSONValue(params).(map[string]interface{})
+		}
+		checked[field] = math.Min(math.Max(angle, limit.Min), limit.Max)
+		report("angle_clamped", SeverityRepaired, "%s %.4g clamped to %.4g", field, angle, checked[field])
+	}
+	if checked != nil {
+		function.Params = checked
+	}
+	return function, diagnostics, true
+}
+
+// checkServoMove 逐个检查舵机目标，任何一个需要丢弃时整个动作丢弃，避免只执行半个姿态
+func (c *SafetyCheck) checkServoMove(params interface{}, report func(code, severity, format string, args ...interface{})) (interface{}, bool) {
+	objects := paramObjects(params)
+	if len(objects) == 0 {
+		return params, true
+	}
+
+	next := make(map[int]float64, len(c.angles))
+	for servo, angle := range c.angles {
+		next[servo] = angle
+	}
+	checked := make([]interface{}, 0, len(objects))
+	for _, obj := range objects {
+		move := copyJSONValue(obj).(map[string]interface{})
+		servoValue, _ := move["servo"].(float64)
+		servo := int(servoValue)
+		limit, ok := c.limits.Servos[strconv.Itoa(servo)]
+		if !ok {
+			report("unknown_servo", SeverityDropped, "servo %d has no safety limits", servo)
+			return params, false
+		}
+
+		angle, _ := move["angle"].(float64)
+		if angle < limit.Min || angle > limit.Max {
+			if c.limits.Mode == SafetyModeReject {
+				report("servo_out_of_range", SeverityDropped, "servo %d angle %.4g outside [%.4g, %.4g]", servo, angle, limit.Min, limit.Max)
+				return params, false
+			}
+			clamped := math.Min(math.Max(angle, limit.Min), limit.Max)
+			report("servo_angle_clamped", SeverityRepaired, "servo %d angle %.4g clamped to %.4g", servo, angle, clamped)
+			angle = clamped
+			move["angle"] = angle
+		}
+
+		duration, hasDuration := move["duration"].(float64)
+		if c.limits.MinDuration > 0 && (!hasDuration || duration < float64(c.limits.MinDuration)) {
+			if hasDuration {
+				report("servo_duration_clamped", SeverityRepaired, "servo %d duration %.0fms raised to %dms", servo, duration, c.limits.MinDuration)
+			}
+			duration = float64(c.limits.MinDuration)
+			move["duration"] = duration
+		}
+		if c.limits.MaxDuration > 0 && duration > float64(c.limits.MaxDuration) {
+			report("servo_duration_clamped", SeverityRepaired, "servo %d duration %.0fms lowered to %dms", servo, duration, c.limits.MaxDuration)
+			duration = float64(c.limits.MaxDuration)
+			move["duration"] = duration
+		}
+
+		// 起始角度未知时无法计算速度，只检查之后的移动
+		if previous, known := next[servo]; known && limit.MaxSpeed > 0 {
+			required := math.Ceil(math.Abs(angle-previous) / limit.MaxSpeed * 1000)
+			if duration < required {
+				if c.limits.Mode == SafetyModeReject || (c.limits.MaxDuration > 0 && required > float64(c.limits.MaxDuration)) {
+					report("servo_too_fast", SeverityDropped, "servo %d moving %.4g degrees in %.0fms exceeds %.4g deg/s", servo, math.Abs(angle-previous), duration, limit.MaxSpeed)
+					return params, false
+				}
+				report("servo_speed_limited", SeverityRepaired, "servo %d duration %.0fms extended to %.0fms to stay under %.4g deg/s", servo, duration, required, limit.MaxSpeed)
+				move["duration"] = required
+			}
+		}
+
+		next[servo] = angle
+		checked = append(checked, move)
+	}
+
+	for _, combination := range c.limits.Forbidden {
+		if combination.matches(next) {
+			report("forbidden_pose", SeverityDropped, "pose %s is forbidden", combination.Name)
+			return params, false
+		}
+	}
+
+	c.angles = next
+	if _, single := params.(map[string]interface{}); single {
+		return checked[0], true
+	}
+	return checked, true
+}
+
+func (f ForbiddenCombination) matches(angles map[int]float64) bool {
+	if len(f.Conditions) == 0 {
+		return false
+	}
+	for _, condition := range f.Conditions {
+		angle, ok := angles[condition.Servo]
+		if !ok {
+			return false
+		}
+		if condition.Min != nil && angle < *condition.Min {
+			return false
+		}
+		if condition.Max != nil && angle > *condition.Max {
+			return false
+		}
+	}
+	return true
+}
+
+// validate 校验并规范化配置中的处理方式
+func (l *SafetyLimits) validate() error {
+	switch strings.ToLower(l.Mode) {
+	case "":
+		l.Mode = SafetyModeClamp
+	case SafetyModeClamp, SafetyModeReject:
+		l.Mode = strings.ToLower(l.Mode)
+	default:
+		return fmt.Errorf("unknown safety mode %q", l.Mode)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ai-generation/internal/similarity"
+	"github.com/ai-generation/internal/types"
+)
+
+const (
+	// similarVectorCacheSize 进程内缓存的查询向量数量，超过后清空重建
+	similarVectorCacheSize = 10000
+	// DefaultSimilarThreshold 默认的相似度阈值。短的中文问题只差一两个字时n-gram相似度仍在0.85左右
+	// （“一楼洗手间在哪里”和“二楼洗手间在哪里”为0.867），阈值过低会复用意思不同的问题的回答
+	DefaultSimilarThreshold = 0.92
+)
+
+const (
+	// numeralRunes 数字和中文数字，两个问题中的数字不同时不视为相似。“一”另外判断，见 numerals
+	numeralRunes = "零〇二两三四五六七八九十百千万亿"
+	// measureRunes 常见的量词和单位，“一”后面跟着它们时才作为数字
+	measureRunes = "楼层号个点次位张件天周月年元块分秒岁人只本米排门期路站厅馆区座"
+)
+
+// SimilarCacheOptions 相似问题缓存：精确缓存未命中时，复用足够相似的已缓存问题的回答
+type SimilarCacheOptions struct {
+	Enabled bool
+	// Threshold 相似度阈值(0-1)，默认 DefaultSimilarThreshold
+	Threshold float64
+	// MaxEntries 每个索引最多的问题数，超过后新问题不再加入索引，默认2000
+	MaxEntries int
+	// Embedder 文本向量化方式，为nil时使用本地的字符n-gram向量
+	Embedder similarity.Embedder
+}
+
+// similarCache 索引保存在Redis中（缓存键 -> 规范化查询），多个实例共享；向量在各实例本地计算并缓存
+type similarCache struct {
+	options SimilarCacheOptions
+
+	mu      sync.Mutex
+	vectors map[string][]float32
+}
+
+// newSimilarCache 未启用时返回nil
+func newSimilarCache(options SimilarCacheOptions) *similarCache {
+	if !options.Enabled {
+		return nil
+	}
+	if options.Threshold <= 0 || options.Threshold > 1 {
+		options.Threshold = DefaultSimilarThreshold
+	}
+	if options.MaxEntries <= 0 {
+		options.MaxEntries = 2000
+	}
+	if options.Embedder == nil {
+		options.Embedder = similarity.NGramEmbedder{}
+	}
+	return &similarCache{options: options, vectors: make(map[string][]float32)}
+}
+
+// vector 返回查询的向量，同一查询只计算一次
+func (c *similarCache) vector(query string) ([]float32, error) {
+	c.mu.Lock()
+	v, ok := c.vectors[query]
+	c.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+	v, err := c.options.Embedder.Embed(query)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if len(c.vectors) >= similarVectorCacheSize {
+		c.vectors = make(map[string][]float32)
+	}
+	c.vectors[query] = v
+	c.mu.Unlock()
+	return v, nil
+}
+
+// lookup 在索引中查找与query最相似的问题，相似度达到阈值且回答仍在缓存中时返回该回答；
+// 数字不同的问题（楼层、时间、展厅编号等）即使只差一个字也不复用
+func (c *similarCache) lookup(ctx context.Context, cacheService *CacheService, indexKey, cacheKey, query string) (map[string]interface{}, *types.CacheInfo) {
+	entries, err := cacheService.IndexedCompletions(ctx, indexKey)
+	if err != nil || len(entries) == 0 {
+		return nil, nil
+	}
+	target, err := c.vector(query)
+	if err != nil {
+		fmt.Printf("similar cache embed failed: %v\n", err)
+		return nil, nil
+	}
+	targetNumerals := numerals(query)
+	var bestKey string
+	var bestScore float64
+	for key, indexed := range entries {
+		if key == cacheKey || numerals(indexed) != targetNumerals {
+			continue
+		}
+		v, err := c.vector(indexed)
+		if err != nil {
+			continue
+		}
+		if score := similarity.Cosine(target, v); score > bestScore {
+			bestKey, bestScore = key, score
+		}
+	}
+	if bestKey == "" || bestScore < c.options.Threshold {
+		return nil, nil
+	}
+	cached, err := cacheService.GetCachedCompletion(ctx, bestKey)
+	if err != nil || cached == nil {
+		// 回答已过期或被删除，清理索引，下次请求再找次相似的问题
+		if isNotFound(err) {
+			_ = cacheService.RemoveFromIndex(ctx, indexKey, bestKey)
+		}
+		return nil, nil
+	}
+	info := &types.CacheInfo{Match: types.CacheMatchSimilar, Score: bestScore}
+	if original, ok := cached["query"].(string); ok {
+		info.Query = original
+	}
+	return cached, info
+}
+
+// numerals 按顺序取出查询中的数字和中文数字。“一”常见于“跳一下”“一起”等说法，
+// 只有与其他数字相邻、前面是“第”或后面是量词时才作为数字
+func numerals(query string) string {
+	runes := []rune(query)
+	var b strings.Builder
+	for i, r := range runes {
+		if isNumeral(r) || (r == '一' && numeralOne(runes, i)) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isNumeral(r rune) bool {
+	return unicode.IsDigit(r) || strings.ContainsRune(numeralRunes, r)
+}
+
+// numeralOne runes[i]为“一”时判断它是否表示数字
+func numeralOne(runes []rune, i int) bool {
+	if i > 0 && (isNumeral(runes[i-1]) || runes[i-1] == '一' || runes[i-1] == '第') {
+		return true
+	}
+	if i+1 < len(runes) {
+		next := runes[i+1]
+		return isNumeral(next) || next == '一' || strings.ContainsRune(measureRunes, next)
+	}
+	return false
+}
+
+// index 把新缓存的问题加入索引，索引已满时跳过
+func (c *similarCache) index(ctx context.Context, cacheService *CacheService, indexKey, cacheKey, query string, ttl time.Duration) {
+	size, err := cacheService.IndexSize(ctx, indexKey)
+	if err == nil && size >= int64(c.options.MaxEntries) {
+		return
+	}
+	if err := cacheService.IndexCompletion(ctx, indexKey, cacheKey, query, ttl); err != nil {
+		fmt.Printf("failed to index cached completion: %v\n", err)
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ai-generation/internal/types"
+)
+
+// StampedeOptions 相同问题同时到达时的合并配置
+type StampedeOptions struct {
+	// LockTTL 跨实例生成锁的有效期，应覆盖一次Dify调用（含回答修复）的耗时，默认60s
+	LockTTL time.Duration
+	// WaitTimeout 等待其他实例写入缓存的最长时间，超时后自行请求Dify，默认30s
+	WaitTimeout time.Duration
+	// PollInterval 等待期间检查缓存的间隔，默认200ms
+	PollInterval time.Duration
+}
+
+func (o StampedeOptions) withDefaults() StampedeOptions {
+	if o.LockTTL <= 0 {
+		o.LockTTL = 60 * time.Second
+	}
+	if o.WaitTimeout <= 0 {
+		o.WaitTimeout = 30 * time.Second
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = 200 * time.Millisecond
+	}
+	return o
+}
+
+// flightResult 领头请求的结果
+type flightResult struct {
+	resp *types.CompletionResponse
+	// stored 回答在缓存中；fresh 回答由本次请求Dify生成，而不是读取的缓存
+	stored bool
+	fresh  bool
+}
+
+// coalesce 合并相同缓存键的请求：实例内用singleflight，只有领头请求继续；
+// 跨实例由领头请求争用Redis锁。其余请求复用写入缓存的回答，并按各自的params_format等生成响应；
+// 回答没有写入缓存时不共享领头请求的回答，它带有领头请求的Dify会话和参数格式。
+// refresh 时不使用已有的缓存，总是请求Dify生成新的回答（预热刷新）。
+// 第二个返回值表示返回的回答在缓存中，refresh 时只有本次生成并写入的回答才算
+func (s *AIService) coalesce(ctx context.Context, req *types.CompletionRequest, profile *DeviceProfile, deviceType, cacheKey string, startedAt time.Time, refresh bool) (*types.CompletionResponse, bool, error) {
+	leader := false
+	v, err, _ := s.flight.Do(cacheKey, func() (interface{}, error) {
+		leader = true
+		return s.generateLocked(ctx, req, profile, deviceType, cacheKey, startedAt, refresh)
+	})
+	if leader {
+		if err != nil {
+			return nil, false, err
+		}
+		result := v.(*flightResult)
+		return result.resp, result.stored, nil
+	}
+
+	if refresh {
+		// 只复用领头请求本次生成并写入的回答；领头请求读取的是已有缓存或没有写入时自行刷新
+		if err != nil {
+			return nil, false, err
+		}
+		if leaderResult := v.(*flightResult); leaderResult.stored && leaderResult.fresh {
+			if cached := s.exactCached(ctx, cacheKey, req, profile); cached != nil {
+				return cached, true, nil
+			}
+		}
+		result, err := s.generateLocked(ctx, req, profile, deviceType, cacheKey, startedAt, true)
+		if err != nil {
+			return nil, false, err
+		}
+		return result.resp, result.stored, nil
+	}
+
+	if cached := s.exactCached(ctx, cacheKey, req, profile); cached != nil {
+		return cached, true, nil
+	}
+	// 回答没有写入缓存：领头请求失败时共享错误，避免Dify故障时重复请求；
+	// 生成了回答（如降级为纯文本）或被急停（只针对领头请求的设备）时自行生成
+	if err != nil {
+		return nil, false, err
+	}
+	leaderResp := v.(*flightResult).resp
+	if leaderResp.Data != nil || leaderResp.Code == StatusEmergencyStopped {
+		return s.generateCompletion(req, profile, deviceType, cacheKey, startedAt)
+	}
+	shared := *leaderResp
+	return &shared, false, nil
+}
+
+// exactCached 读取缓存键对应的回答，未命中或缓存的内容无效时返回nil
+func (s *AIService) exactCached(ctx context.Context, cacheKey string, req *types.CompletionRequest, profile *DeviceProfile) *types.CompletionResponse {
+	cachedResult, err := s.cacheService.GetCachedCompletion(ctx, cacheKey)
+	if err != nil || cachedResult == nil {
+		return nil
+	}
+	return s.cachedResponse(cachedResult, &types.CacheInfo{Match: types.CacheMatchExact, Score: 1}, req, profile)
+}
+
+// generateLocked 获取跨实例生成锁后请求Dify；锁被其他实例持有时等待其写入缓存，
+// 锁释放后仍未命中缓存或等待超时时自行请求。Redis异常时不加锁直接请求。
+// refresh 时只用锁避免多个实例同时刷新，不读取缓存
+func (s *AIService) generateLocked(ctx context.Context, req *types.CompletionRequest, profile *DeviceProfile, deviceType, cacheKey string, startedAt time.Time, refresh bool) (*flightResult, error) {
+	options := s.options.Stampede
+	lockKey := s.cacheService.CompletionLockKey(cacheKey)
+	token := newID()
+	deadline := time.Now().Add(options.WaitTimeout)
+	for {
+		acquired, err := s.cacheService.AcquireLock(ctx, lockKey, token, options.LockTTL)
+		if err != nil {
+			fmt.Printf("completion lock failed: %v\n", err)
+			break
+		}
+		if acquired {
+			defer func() {
+				if err := s.cacheService.ReleaseLock(context.Background(), lockKey, token); err != nil {
+					fmt.Printf("completion unlock failed: %v\n", err)
+				}
+			}()
+			// 其他实例可能在上次检查缓存之后写入回答并释放了锁
+			if !refresh {
+				if cached := s.exactCached(ctx, cacheKey, req, profile); cached != nil {
+					return &flightResult{resp: cached, stored: true}, nil
+				}
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(options.PollInterval)
+		if !refresh {
+			if cached := s.exactCached(ctx, cacheKey, req, profile); cached != nil {
+				return &flightResult{resp: cached, stored: true}, nil
+			}
+		}
+	}
+	resp, stored, err := s.generateCompletion(req, profile, deviceType, cacheKey, startedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &flightResult{resp: resp, stored: stored, fresh: true}, nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ai-generation/pkg/memory"
+	"github.com/ai-generation/pkg/redis"
+)
+
+// Storage 缓存、限流、宏、审计日志等共用的键值存储，值统一编码为JSON。
+// *redis.Client 用于多实例部署，*memory.Store 用于不依赖外部服务的单机部署
+type Storage interface {
+	Ping(ctx context.Context) error
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	SetNX(ctx context.Context, key, value string, expiration time.Duration) (bool, error)
+	Get(ctx context.Context, key string, value interface{}) error
+	Del(ctx context.Context, keys ...string) error
+	DelIfValue(ctx context.Context, key, value string) (bool, error)
+	Scan(ctx context.Context, pattern string, count int64) ([]string, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	LPush(ctx context.Context, key string, value interface{}, maxLen int64) error
+	LRange(ctx context.Context, key string, start, stop int64) ([]string, error)
+	HSet(ctx context.Context, key, field, value string, expiration time.Duration) error
+	HGet(ctx context.Context, key, field string) (string, error)
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	HIncrBy(ctx context.Context, key, field string, incr int64) (int64, error)
+	HLen(ctx context.Context, key string) (int64, error)
+	HDel(ctx context.Context, key string, fields ...string) error
+	Publish(ctx context.Context, channel string, value interface{}) error
+	Subscribe(ctx context.Context, channel string, handler func(payload []byte)) error
+	Close() error
+}
+
+// scriptRunner 支持Lua脚本的存储，限流在存储端原子执行，多实例共享计数
+type scriptRunner interface {
+	RunScript(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) ([]int64, error)
+}
+
+// isNotFound 判断Get的错误是否为key不存在，与存储实现无关
+func isNotFound(err error) bool {
+	return redis.IsNotFound(err) || memory.IsNotFound(err)
+}
+
+// 存储类型
+const (
+	StorageRedis  = "redis"
+	StorageMemory = "memory"
+	// StorageTiered 进程内LRU作为一级缓存，Redis作为二级缓存
+	StorageTiered = "tiered"
+)
+
+// TieredStorage 在Redis前加一层进程内LRU：指定前缀的key读取时先查本地，
+// 未命中再查Redis并回填。本地副本的有效期很短，其他实例的更新最多延迟这么久可见；
+// 其余key和全部哈希、列表、锁、脚本操作直接使用Redis
+type TieredStorage struct {
+	*redis.Client
+	local    *memory.Store
+	ttl      time.Duration
+	prefixes []string
+}
+
+// NewTieredStorage 创建两级存储，prefixes为空时只在本地缓存回答
+func NewTieredStorage(local *memory.Store, remote *redis.Client, ttl time.Duration, prefixes ...string) *TieredStorage {
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	if len(prefixes) == 0 {
+		prefixes = []string{"completion:"}
+	}
+	return &TieredStorage{Client: remote, local: local, ttl: ttl, prefixes: prefixes}
+}
+
+func (t *TieredStorage) cached(key string) bool {
+	for _, prefix := range t.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// localTTL 本地副本不超过Redis中的剩余有效期
+func (t *TieredStorage) localTTL(expiration time.Duration) time.Duration {
+	if expiration > 0 && expiration < t.ttl {
+		return expiration
+	}
+	return t.ttl
+}
+
+// Set 写入Redis，并更新本地副本
+func (t *TieredStorage) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	if err := t.Client.Set(ctx, key, value, expiration); err != nil {
+		return err
+	}
+	if t.cached(key) {
+		_ = t.local.Set(ctx, key, value, t.localTTL(expiration))
+	}
+	return nil
+}
+
+// Get 先查本地副本，未命中时读取Redis并回填
+func (t *TieredStorage) Get(ctx context.Context, key string, value interface{}) error {
+	if !t.cached(key) {
+		return t.Client.Get(ctx, key, value)
+	}
+	if err := t.local.Get(ctx, key, value); err == nil {
+		return nil
+	}
+	if err := t.Client.Get(ctx, key, value); err != nil {
+		return err
+	}
+	_ = t.local.Set(ctx, key, value, t.ttl)
+	return nil
+}
+
+// Del 同时删除Redis和本地副本
+func (t *TieredStorage) Del(ctx context.Context, keys ...string) error {
+	_ = t.local.Del(ctx, keys...)
+	return t.Client.Del(ctx, keys...)
+}
+
+// NewStorage 按类型创建存储；memory 不需要Redis，redisClient可以为nil
+func NewStorage(kind string, redisClient *redis.Client, memorySize int, memoryTTL time.Duration) (Storage, error) {
+	switch strings.ToLower(kind) {
+	case "", StorageRedis:
+		return redisClient, nil
+	case StorageMemory:
+		return memory.NewStore(memorySize), nil
+	case StorageTiered:
+		return NewTieredStorage(memory.NewStore(memorySize), redisClient, memoryTTL), nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q", kind)
+	}
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/ai-generation/internal/types"
+)
+
+// delay 的解释方式
+const (
+	DelayModeAbsolute   = "absolute"   // 相对于表演开始
+	DelayModeRelative   = "relative"   // 相对于上一个动作开始
+	DelayModeSequential = "sequential" // 相对于上一个动作结束
+)
+
+// TimelineCompiler 把functions编译成带预估时长的绝对时间表，并检测执行器冲突
+type TimelineCompiler struct {
+	registry  *ActionRegistry
+	delayMode string
+}
+
+// NewTimelineCompiler 创建时间线编译器，delayMode为空时按absolute处理
+func NewTimelineCompiler(registry *ActionRegistry, delayMode string) (*TimelineCompiler, error) {
+	switch delayMode {
+	case "":
+		delayMode = DelayModeAbsolute
+	case DelayModeAbsolute, DelayModeRelative, DelayModeSequential:
+	default:
+		return nil, fmt.Errorf("unknown delay mode %q", delayMode)
+	}
+	return &TimelineCompiler{registry: registry, delayMode: delayMode}, nil
+}
+
+// Compile 编译已通过校验的functions
+func (c *TimelineCompiler) Compile(functions []types.CompletionFunctions) *types.Timeline {
+	return c.CompileTranslated(functions, functions)
+}
+
+// CompileTranslated 编译翻译成设备动作后的functions，时长和执行器按sources中对应的通用动作估算
+func (c *TimelineCompiler) CompileTranslated(functions, sources []types.CompletionFunctions) *types.Timeline {
+	timeline := &types.Timeline{
+		DelayMode: c.delayMode,
+		Entries:   make([]types.TimelineEntry, 0, len(functions)),
+	}
+
+	previousStart, previousEnd := 0, 0
+	for i, function := range functions {
+		start := function.Delay
+		switch c.delayMode {
+		case DelayModeRelative:
+			start += previousStart
+		case DelayModeSequential:
+			start += previousEnd
+		}
+
+		entry := types.TimelineEntry{
+			Index:  i,
+			Action: function.Action,
+			Start:  start,
+		}
+		source := sources[i]
+		if spec, ok := c.registry.Lookup(source.Action); ok {
+			entry.Duration = estimateDuration(spec, source.Params)
+			entry.Actuators = actuators(spec, source.Params)
+		}
+		entry.End = entry.Start + entry.Duration
+
+		timeline.Entries = append(timeline.Entries, entry)
+		if entry.End > timeline.Duration {
+			timeline.Duration = entry.End
+		}
+		previousStart, previousEnd = entry.Start, entry.End
+	}
+
+	timeline.Conflicts = detectConflicts(timeline.Entries)
+	return timeline
+}
+
+// estimateDuration 预估动作时长：固定时长、params中的时长字段或按文本字数估算
+func estimateDuration(spec *ActionSpec, params interface{}) int {
+	duration := spec.Duration
+	if spec.DurationPerChar > 0 {
+		if text, ok := params.(string); ok {
+			duration += utf8.RuneCountInString(text) * spec.DurationPerChar
+		}
+	}
+	if spec.DurationParam != "" {
+		// 多个对象时按最长的一个计算
+		longest := -1
+		for _, item := range paramObjects(params) {
+			if v, ok := item[spec.DurationParam].(float64); ok && int(v) > longest {
+				longest = int(v)
+			}
+		}
+		if longest >= 0 {
+			duration = longest
+		}
+	}
+	return duration
+}
+
+// actuators 动作占用的执行器，ActuatorParam 按params中的值展开
+func actuators(spec *ActionSpec, params interface{}) []string {
+	result := append([]string{}, spec.Actuators...)
+	if spec.ActuatorParam == "" {
+		return result
+	}
+	seen := make(map[string]bool)
+	for _, item := range paramObjects(params) {
+		value, ok := item[spec.ActuatorParam]
+		if !ok {
+			continue
+		}
+		name := fmt.Sprintf("%s:%v", spec.ActuatorParam, value)
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// paramObjects 把对象或对象数组形式的params统一成对象列表
+func paramObjects(params interface{}) []map[string]interface{} {
+	switch v := params.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}
+	case []interface{}:
+		objects := make([]map[string]interface{}, 0, len(v))
+		for _, item := range v {
+			if obj, ok := item.(map[string]interface{}); ok {
+				objects = append(objects, obj)
+			}
+		}
+		return objects
+	}
+	return nil
+}
+
+// detectConflicts 同一执行器上时间区间重叠的动作两两报告，时长为0的瞬时动作不参与
+func detectConflicts(entries []types.TimelineEntry) []types.TimelineConflict {
+	byActuator := make(map[string][]types.TimelineEntry)
+	var names []string
+	for _, entry := range entries {
+		if entry.Duration <= 0 {
+			continue
+		}
+		for _, actuator := range entry.Actuators {
+			if _, ok := byActuator[actuator]; !ok {
+				names = append(names, actuator)
+			}
+			byActuator[actuator] = append(byActuator[actuator], entry)
+		}
+	}
+	sort.Strings(names)
+
+	var conflicts []types.TimelineConflict
+	for _, actuator := range names {
+		list := byActuator[actuator]
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Start < list[j].Start })
+		for i := 0; i < len(list); i++ {
+			for j := i + 1; j < len(list) && list[j].Start < list[i].End; j++ {
+				end := list[i].End
+				if list[j].End < end {
+					end = list[j].End
+				}
+				conflicts = append(conflicts, types.TimelineConflict{
+					Actuator: actuator,
+					First:    list[i].Index,
+					Second:   list[j].Index,
+					Start:    list[j].Start,
+					End:      end,
+				})
+			}
+		}
+	}
+	return conflicts
+}
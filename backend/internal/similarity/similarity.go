@@ -0,0 +1,84 @@
+// Package similarity 计算查询之间的相似度，供相似问题复用缓存的回答。
+// 默认的字符n-gram向量完全在本地计算，不依赖外部向量服务；也可以接入任意Embedder。
+package similarity
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// Embedder 把文本转换为向量，相似度为两个向量的余弦相似度
+type Embedder interface {
+	Embed(text string) ([]float32, error)
+}
+
+// EmbedderFunc 把函数适配为Embedder，便于接入外部向量服务
+type EmbedderFunc func(text string) ([]float32, error)
+
+// Embed 调用函数本身
+func (f EmbedderFunc) Embed(text string) ([]float32, error) {
+	return f(text)
+}
+
+// NGramEmbedder 把文本的字符n-gram按哈希映射到固定维度，得到归一化的词频向量。
+// 中文提问短，同时使用单字和双字可以兼顾短问题和语序
+type NGramEmbedder struct {
+	// Sizes 使用的n-gram长度，默认 1 和 2
+	Sizes []int
+	// Dims 向量维度，默认 512
+	Dims int
+}
+
+// Embed 计算文本的n-gram向量，空文本返回零向量
+func (e NGramEmbedder) Embed(text string) ([]float32, error) {
+	sizes := e.Sizes
+	if len(sizes) == 0 {
+		sizes = []int{1, 2}
+	}
+	dims := e.Dims
+	if dims <= 0 {
+		dims = 512
+	}
+	vector := make([]float32, dims)
+	runes := []rune(text)
+	for _, n := range sizes {
+		for i := 0; i+n <= len(runes); i++ {
+			h := fnv.New32a()
+			h.Write([]byte(string(runes[i : i+n])))
+			vector[h.Sum32()%uint32(dims)]++
+		}
+	}
+	normalize(vector)
+	return vector, nil
+}
+
+// Cosine 两个向量的余弦相似度，维度不同或有零向量时返回0
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+func normalize(vector []float32) {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+}
@@ -0,0 +1,40 @@
+// Package simulator 在没有真机的情况下按编译好的时间线模拟机器人执行器的状态，
+// 输出确定性的状态轨迹，并标出物理上无法完成的动作序列。
+package simulator
+
+// ServoSpec 单个舵机的物理参数，角度单位为度
+type ServoSpec struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	// MaxSpeed 最大角速度(度/秒)，0表示不限制
+	MaxSpeed float64 `json:"max_speed,omitempty"`
+	// Initial 上电后的初始角度
+	Initial float64 `json:"initial"`
+}
+
+// Robot 被模拟的机器人
+type Robot struct {
+	// HeadMin/HeadMax 头部转动范围，0为正前方
+	HeadMin float64 `json:"head_min"`
+	HeadMax float64 `json:"head_max"`
+	// HeadSpeed 头部最大角速度(度/秒)，0表示不限制
+	HeadSpeed float64           `json:"head_speed,omitempty"`
+	Servos    map[int]ServoSpec `json:"servos"`
+	// DefaultServoDuration servo_move未指定duration时的运行时间(毫秒)
+	DefaultServoDuration int `json:"default_servo_duration"`
+}
+
+// DefaultRobot 与内置动作注册表一致的通用机器人：头部±90度，17个0-180度的舵机，初始位置居中
+func DefaultRobot() *Robot {
+	servos := make(map[int]ServoSpec, 17)
+	for i := 1; i <= 17; i++ {
+		servos[i] = ServoSpec{Min: 0, Max: 180, MaxSpeed: 360, Initial: 90}
+	}
+	return &Robot{
+		HeadMin:              -90,
+		HeadMax:              90,
+		HeadSpeed:            180,
+		Servos:               servos,
+		DefaultServoDuration: 500,
+	}
+}
@@ -0,0 +1,448 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ai-generation/internal/types"
+)
+
+// 问题严重程度
+const (
+	SeverityError   = "error"   // 真机上无法按计划完成
+	SeverityWarning = "warning" // 可以执行，但多半不是想要的效果
+)
+
+// 问题代码
+const (
+	IssueActuatorBusy     = "actuator_busy"      // 执行器仍在执行上一个动作
+	IssueOutOfRange       = "out_of_range"       // 目标角度超出活动范围或舵机不存在
+	IssueTooFast          = "too_fast"           // 在给定时长内转不到目标角度
+	IssueRedundantPose    = "redundant_pose"     // 动作前后姿态不变，如连续两次举手
+	IssueUnsupported      = "unsupported_action" // 模拟器不认识的动作，状态不变
+	IssueTimelineMismatch = "timeline_mismatch"  // 时间线与functions对不上
+)
+
+// 帧事件
+const (
+	FrameInitial = "initial"
+	FrameStart   = "start"
+	FrameEnd     = "end"
+	FrameSample  = "sample"
+)
+
+// LEDState 灯光状态
+type LEDState struct {
+	Color string `json:"color"`
+	Mode  string `json:"mode"`
+}
+
+// State 某一时刻的执行器状态，运动中的角度按线性插值计算
+type State struct {
+	// Arms 双臂位置，0为放下，1为举起，中间值表示正在运动
+	Arms float64 `json:"arms"`
+	Head float64 `json:"head"`
+	// Servos 动过的舵机角度，键为舵机编号
+	Servos map[int]float64 `json:"servos,omitempty"`
+	LED    LEDState        `json:"led"`
+	Speech string          `json:"speech,omitempty"`
+	// Active 正在执行的动作下标
+	Active []int `json:"active,omitempty"`
+}
+
+// Frame 状态轨迹中的一帧，start/end帧记录的是处理该事件之后的状态
+type Frame struct {
+	Time   int    `json:"time"`
+	Event  string `json:"event"`
+	Index  int    `json:"index"`
+	Action string `json:"action,omitempty"`
+	State  State  `json:"state"`
+}
+
+// Issue 模拟中发现的问题，Index 为functions中的下标
+type Issue struct {
+	Time     int    `json:"time"`
+	Index    int    `json:"index"`
+	Action   string `json:"action"`
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// Trace 一次模拟的结果，相同输入总是得到相同的轨迹
+type Trace struct {
+	Duration int     `json:"duration"`
+	Frames   []Frame `json:"frames"`
+	Final    State   `json:"final"`
+	Issues   []Issue `json:"issues,omitempty"`
+}
+
+// HasErrors 是否存在真机上无法完成的动作
+func (t *Trace) HasErrors() bool {
+	for _, issue := range t.Issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Simulator 机器人模拟器
+type Simulator struct {
+	robot *Robot
+	// sampleInterval 大于0时每隔该毫秒数额外输出一帧，用于绘制连续的预览
+	sampleInterval int
+}
+
+// New 创建模拟器，robot为nil时使用 DefaultRobot
+func New(robot *Robot, sampleInterval int) *Simulator {
+	if robot == nil {
+		robot = DefaultRobot()
+	}
+	if sampleInterval < 0 {
+		sampleInterval = 0
+	}
+	return &Simulator{robot: robot, sampleInterval: sampleInterval}
+}
+
+// motion 执行器从from到to的一段匀速运动
+type motion struct {
+	index    int
+	from, to float64
+	start    int
+	end      int
+}
+
+func (m motion) at(t int) float64 {
+	if t >= m.end || m.end <= m.start {
+		return m.to
+	}
+	if t <= m.start {
+		return m.from
+	}
+	return m.from + (m.to-m.from)*float64(t-m.start)/float64(m.end-m.start)
+}
+
+// occupant 正在占用执行器的动作
+type occupant struct {
+	index int
+	end   int
+}
+
+type event struct {
+	time  int
+	start bool
+	entry types.TimelineEntry
+}
+
+// run 一次模拟的运行状态
+type run struct {
+	sim       *Simulator
+	functions []types.CompletionFunctions
+	trace     *Trace
+
+	values  map[string]float64
+	motions map[string]motion
+	servos  map[int]bool
+	busy    map[string]occupant
+	active  map[int]bool
+	led     LEDState
+	speech  string
+	speaker int
+}
+
+// Simulate 按时间线执行functions。functions应是通过校验的通用动作，timeline由同一组functions编译得到，
+// 动作的起止时间和占用的执行器以timeline为准。
+func (s *Simulator) Simulate(functions []types.CompletionFunctions, timeline *types.Timeline) *Trace {
+	r := &run{
+		sim:       s,
+		functions: functions,
+		trace:     &Trace{Frames: []Frame{}},
+		values:    make(map[string]float64),
+		motions:   make(map[string]motion),
+		servos:    make(map[int]bool),
+		busy:      make(map[string]occupant),
+		active:    make(map[int]bool),
+		led:       LEDState{Color: "off", Mode: "off"},
+		speaker:   -1,
+	}
+	if timeline == nil {
+		r.report(0, -1, "", IssueTimelineMismatch, SeverityError, "timeline is missing")
+		r.trace.Final = r.snapshot(0)
+		return r.trace
+	}
+	if len(timeline.Entries) != len(functions) {
+		r.report(0, -1, "", IssueTimelineMismatch, SeverityError, "timeline has %d entries for %d functions", len(timeline.Entries), len(functions))
+	}
+
+	events := make([]event, 0, 2*len(timeline.Entries))
+	for _, entry := range timeline.Entries {
+		if entry.Index < 0 || entry.Index >= len(functions) {
+			r.report(entry.Start, entry.Index, entry.Action, IssueTimelineMismatch, SeverityError, "timeline entry refers to function #%d", entry.Index)
+			continue
+		}
+		events = append(events, event{time: entry.Start, start: true, entry: entry}, event{time: entry.End, entry: entry})
+		if entry.End > r.trace.Duration {
+			r.trace.Duration = entry.End
+		}
+	}
+	// 同一时刻先结束再开始，首尾相接的两个动作不算冲突
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].time != events[j].time {
+			return events[i].time < events[j].time
+		}
+		if events[i].start != events[j].start {
+			return !events[i].start
+		}
+		return events[i].entry.Index < events[j].entry.Index
+	})
+
+	r.frame(0, FrameInitial, -1, "")
+	nextSample := s.sampleInterval
+	for _, e := range events {
+		for s.sampleInterval > 0 && nextSample < e.time {
+			r.frame(nextSample, FrameSample, -1, "")
+			nextSample += s.sampleInterval
+		}
+		if e.start {
+			r.start(e.entry)
+			r.frame(e.time, FrameStart, e.entry.Index, e.entry.Action)
+		} else {
+			r.end(e.entry)
+			r.frame(e.time, FrameEnd, e.entry.Index, e.entry.Action)
+		}
+	}
+	for s.sampleInterval > 0 && nextSample <= r.trace.Duration {
+		r.frame(nextSample, FrameSample, -1, "")
+		nextSample += s.sampleInterval
+	}
+
+	r.trace.Final = r.snapshot(r.trace.Duration)
+	return r.trace
+}
+
+func (r *run) report(time, index int, action, code, severity, format string, args ...interface{}) {
+	r.trace.Issues = append(r.trace.Issues, Issue{
+		Time:     time,
+		Index:    index,
+		Action:   action,
+		Code:     code,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// start 动作开始：检查执行器占用，按动作类型开始运动或立即改变状态
+func (r *run) start(entry types.TimelineEntry) {
+	t := entry.Start
+	report := func(code, severity, format string, args ...interface{}) {
+		r.report(t, entry.Index, entry.Action, code, severity, format, args...)
+	}
+
+	// 按占用方汇总，双臂动作被同一个动作挡住时只报告一次
+	var blockers []occupant
+	blocked := make(map[occupant][]string)
+	for _, actuator := range entry.Actuators {
+		if current, ok := r.busy[actuator]; ok && current.end > t {
+			if _, seen := blocked[current]; !seen {
+				blockers = append(blockers, current)
+			}
+			blocked[current] = append(blocked[current], actuator)
+		}
+		r.busy[actuator] = occupant{index: entry.Index, end: entry.End}
+	}
+	for _, current := range blockers {
+		report(IssueActuatorBusy, SeverityError, "%s still executing #%d until %dms", strings.Join(blocked[current], ", "), current.index, current.end)
+	}
+	r.active[entry.Index] = true
+
+	function := r.functions[entry.Index]
+	robot := r.sim.robot
+	switch function.Action {
+	case "handsup", "handsdown":
+		target := 0.0
+		if function.Action == "handsup" {
+			target = 1
+		}
+		current := r.value("arms", t)
+		if _, moving := r.motions["arms"]; !moving && current == target {
+			report(IssueRedundantPose, SeverityWarning, "arms are already %s", strings.TrimPrefix(function.Action, "hands"))
+		}
+		r.move("arms", entry.Index, current, target, t, entry.End)
+
+	case "headturn":
+		params, _ := function.Params.(map[string]interface{})
+		angle, ok := params["angle"].(float64)
+		if !ok {
+			report(IssueUnsupported, SeverityWarning, "headturn without numeric angle")
+			return
+		}
+		if angle < robot.HeadMin || angle > robot.HeadMax {
+			report(IssueOutOfRange, SeverityError, "head angle %.4g outside [%.4g, %.4g]", angle, robot.HeadMin, robot.HeadMax)
+			angle = math.Min(math.Max(angle, robot.HeadMin), robot.HeadMax)
+		}
+		current := r.value("head", t)
+		if speed := requiredSpeed(current, angle, entry.Duration); robot.HeadSpeed > 0 && speed > robot.HeadSpeed {
+			report(IssueTooFast, SeverityError, "head turning %.4g degrees in %dms needs %.4g deg/s, limit %.4g", math.Abs(angle-current), entry.Duration, speed, robot.HeadSpeed)
+		}
+		r.move("head", entry.Index, current, angle, t, entry.End)
+
+	case "servo_move":
+		for _, obj := range paramObjects(function.Params) {
+			servoValue, _ := obj["servo"].(float64)
+			servo := int(servoValue)
+			spec, ok := robot.Servos[servo]
+			if !ok {
+				report(IssueOutOfRange, SeverityError, "servo %d does not exist", servo)
+				continue
+			}
+			angle, _ := obj["angle"].(float64)
+			if angle < spec.Min || angle > spec.Max {
+				report(IssueOutOfRange, SeverityError, "servo %d angle %.4g outside [%.4g, %.4g]", servo, angle, spec.Min, spec.Max)
+				angle = math.Min(math.Max(angle, spec.Min), spec.Max)
+			}
+			duration := robot.DefaultServoDuration
+			if d, ok := obj["duration"].(float64); ok {
+				duration = int(d)
+			}
+			key := servoKey(servo)
+			current := r.value(key, t)
+			if speed := requiredSpeed(current, angle, duration); spec.MaxSpeed > 0 && speed > spec.MaxSpeed {
+				report(IssueTooFast, SeverityError, "servo %d moving %.4g degrees in %dms needs %.4g deg/s, limit %.4g", servo, math.Abs(angle-current), duration, speed, spec.MaxSpeed)
+			}
+			r.servos[servo] = true
+			r.move(key, entry.Index, current, angle, t, t+duration)
+		}
+
+	case "voice":
+		text, _ := function.Params.(string)
+		r.speech = text
+		r.speaker = entry.Index
+
+	case "led":
+		params, _ := function.Params.(map[string]interface{})
+		color, _ := params["color"].(string)
+		mode, _ := params["mode"].(string)
+		if mode == "" {
+			mode = "on"
+		}
+		if color == "off" {
+			mode = "off"
+		}
+		r.led = LEDState{Color: color, Mode: mode}
+
+	default:
+		report(IssueUnsupported, SeverityWarning, "action %s is not simulated", function.Action)
+	}
+}
+
+// end 动作结束：到达目标位置，释放执行器
+func (r *run) end(entry types.TimelineEntry) {
+	for key, m := range r.motions {
+		if m.index == entry.Index {
+			r.values[key] = m.to
+			delete(r.motions, key)
+		}
+	}
+	for _, actuator := range entry.Actuators {
+		if current, ok := r.busy[actuator]; ok && current.index == entry.Index {
+			delete(r.busy, actuator)
+		}
+	}
+	if r.speaker == entry.Index {
+		r.speech = ""
+		r.speaker = -1
+	}
+	delete(r.active, entry.Index)
+}
+
+// move 开始一段运动，打断同一执行器上未完成的运动
+func (r *run) move(key string, index int, from, to float64, start, end int) {
+	r.motions[key] = motion{index: index, from: from, to: to, start: start, end: end}
+}
+
+// value 执行器在t时刻的位置
+func (r *run) value(key string, t int) float64 {
+	if m, ok := r.motions[key]; ok {
+		return m.at(t)
+	}
+	if v, ok := r.values[key]; ok {
+		return v
+	}
+	if servo, ok := parseServoKey(key); ok {
+		return r.sim.robot.Servos[servo].Initial
+	}
+	return 0
+}
+
+func (r *run) frame(t int, kind string, index int, action string) {
+	r.trace.Frames = append(r.trace.Frames, Frame{Time: t, Event: kind, Index: index, Action: action, State: r.snapshot(t)})
+}
+
+func (r *run) snapshot(t int) State {
+	state := State{
+		Arms:   round(r.value("arms", t)),
+		Head:   round(r.value("head", t)),
+		LED:    r.led,
+		Speech: r.speech,
+	}
+	if len(r.servos) > 0 {
+		state.Servos = make(map[int]float64, len(r.servos))
+		for servo := range r.servos {
+			state.Servos[servo] = round(r.value(servoKey(servo), t))
+		}
+	}
+	for index := range r.active {
+		state.Active = append(state.Active, index)
+	}
+	sort.Ints(state.Active)
+	return state
+}
+
+// requiredSpeed 在duration毫秒内转过的角速度(度/秒)，瞬时转动视为无穷大
+func requiredSpeed(from, to float64, duration int) float64 {
+	delta := math.Abs(to - from)
+	if delta == 0 {
+		return 0
+	}
+	if duration <= 0 {
+		return math.Inf(1)
+	}
+	return delta / float64(duration) * 1000
+}
+
+func servoKey(servo int) string {
+	return "servo:" + strconv.Itoa(servo)
+}
+
+func parseServoKey(key string) (int, bool) {
+	if !strings.HasPrefix(key, "servo:") {
+		return 0, false
+	}
+	servo, err := strconv.Atoi(strings.TrimPrefix(key, "servo:"))
+	return servo, err == nil
+}
+
+// paramObjects 把对象或对象数组形式的params统一成对象列表
+func paramObjects(params interface{}) []map[string]interface{} {
+	switch v := params.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}
+	case []interface{}:
+		objects := make([]map[string]interface{}, 0, len(v))
+		for _, item := range v {
+			if obj, ok := item.(map[string]interface{}); ok {
+				objects = append(objects, obj)
+			}
+		}
+		return objects
+	}
+	return nil
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
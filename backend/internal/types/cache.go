@@ -0,0 +1,67 @@
+package types
+
+// CacheEntry 一条缓存的回答
+type CacheEntry struct {
+	Key string `json:"key"`
+	// Namespace 缓存键中的应用标识，清空命名空间即清除该应用的全部回答
+	Namespace       string `json:"namespace"`
+	Query           string `json:"query,omitempty"`
+	NormalizedQuery string `json:"normalized_query,omitempty"`
+	// FirstRequester 第一个得到该回答的请求的用户。缓存键不含用户，回答由所有用户共享，这不是回答的归属
+	FirstRequester string                 `json:"first_requester,omitempty"`
+	DeviceType     string                 `json:"device_type,omitempty"`
+	Inputs         map[string]interface{} `json:"inputs,omitempty"`
+	CreatedAt      int64                  `json:"created_at,omitempty"`
+	// Version 写入时命名空间的版本，Stale 表示命名空间已递增到更新的版本，该回答不会再被使用
+	Version int64  `json:"version"`
+	Stale   bool   `json:"stale"`
+	Class   string `json:"class,omitempty"`
+	// Value 原始缓存内容，只在查看单条时返回
+	Value map[string]interface{} `json:"value,omitempty"`
+}
+
+// CacheSearchRequest 按条件查找缓存的回答，条件之间为与关系
+type CacheSearchRequest struct {
+	Namespace string `json:"namespace" form:"namespace"`
+	// FirstRequester 第一个得到回答的用户，精确匹配；回答由所有用户共享，不能据此找出某个用户得到的回答
+	FirstRequester string `json:"first_requester" form:"first_requester"`
+	// Query 匹配原始查询或规范化查询，不区分大小写，支持 * 和 ?，不含通配符时按包含匹配
+	Query string `json:"query" form:"query"`
+	// Stale 只匹配已失效（命名空间版本已递增）的回答
+	Stale bool `json:"stale" form:"stale"`
+	Limit int  `json:"limit" form:"limit"`
+}
+
+// CacheSearchResult 查找结果
+type CacheSearchResult struct {
+	Entries []*CacheEntry `json:"entries"`
+	// Scanned 检查过的缓存条目数
+	Scanned int `json:"scanned"`
+	// Truncated 达到limit后停止，可能还有更多匹配
+	Truncated bool `json:"truncated"`
+}
+
+// CachePurgeRequest 删除缓存的回答：指定key时只删除该条，否则按命名空间、查询模式或是否已失效删除。
+// 回答由所有用户共享，不按用户删除
+type CachePurgeRequest struct {
+	Key       string `json:"key"`
+	Namespace string `json:"namespace"`
+	Query     string `json:"query"`
+	Stale     bool   `json:"stale"`
+}
+
+// CachePurgeResult 删除结果
+type CachePurgeResult struct {
+	Deleted int `json:"deleted"`
+	// AuditID 对应的审计记录
+	AuditID string `json:"audit_id"`
+}
+
+// CacheNamespace 一个缓存命名空间：当前版本及其中的回答数量（包括已失效但未过期的）
+type CacheNamespace struct {
+	Namespace string `json:"namespace"`
+	Version   int64  `json:"version"`
+	Entries   int    `json:"entries"`
+	// AuditID 递增版本时对应的审计记录
+	AuditID string `json:"audit_id,omitempty"`
+}
@@ -1,13 +1,46 @@
 package types
 
+import "time"
+
 // CompletionRequest 定义了完成请求的数据结构
 type CompletionRequest struct {
 	Query        string            `json:"query" binding:"required"`
 	Inputs       map[string]string `json:"inputs"`
 	User         string            `json:"user,omitempty"`
 	ResponseMode string            `json:"response_mode,omitempty"`
+	// ParamsFormat 为 "string" 时把非字符串params编码为JSON字符串，兼容旧客户端
+	ParamsFormat string `json:"params_format,omitempty"`
+	// DeviceType 目标机器人型号，如 yan、cruzr、unitree_ros；为空时按DeviceID查找绑定的型号
+	DeviceType string `json:"device_type,omitempty"`
+	DeviceID   string `json:"device_id,omitempty"`
+	// ConversationID 继续已有的Dify会话；后续对话的回答依赖上下文，默认不读写缓存
+	ConversationID string `json:"conversation_id,omitempty"`
+	// Cache 缓存控制：为空时按策略，bypass 不读写缓存，force 强制缓存
+	Cache string `json:"cache,omitempty"`
+	// Tenant、APIKey、ClientIP 由传输层从请求头和连接中填写，用于限流
+	Tenant   string `json:"-"`
+	APIKey   string `json:"-"`
+	ClientIP string `json:"-"`
+	// RateLimit 由服务填写本次请求的限流状态，传输层据此设置响应头或gRPC trailer
+	RateLimit *RateLimitStatus `json:"-"`
+}
+
+// RateLimitStatus 限流检查结果，Policy 为最接近耗尽的规则；没有适用的规则时为nil
+type RateLimitStatus struct {
+	Policy     string
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
 }
 
+// params_format 取值
+const (
+	ParamsFormatStructured = "structured"
+	ParamsFormatString     = "string"
+)
+
 //// CompletionData 定义了完成响应中的数据结构
 //type CompletionData struct {
 //	Event          string                 `json:"event"`
@@ -42,12 +75,47 @@ type CompletionRequest struct {
 type CompletionFunctions struct {
 	Action string `json:"action"`
 	Delay  int    `json:"delay"`
-	Params string `json:"params,omitempty"`
+	// Params 保留LLM输出的JSON结构：字符串、对象、数组或数值
+	Params interface{} `json:"params,omitempty"`
+}
+
+// Diagnostic 记录对LLM输出的修正或丢弃，便于排查提示词问题
+type Diagnostic struct {
+	Index    int    `json:"index"`
+	Action   string `json:"action,omitempty"`
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
 }
 
 type CompletionOptimizeData struct {
-	Content   string                `json:"content"`
-	Functions []CompletionFunctions `json:"functions"`
+	Content     string                `json:"content"`
+	Functions   []CompletionFunctions `json:"functions"`
+	Diagnostics []Diagnostic          `json:"diagnostics,omitempty"`
+	// DegradedFormat 回答不是JSON，按纯文本降级生成
+	DegradedFormat bool `json:"degraded_format,omitempty"`
+	// Timeline 编译后的执行计划，与functions一一对应
+	Timeline *Timeline `json:"timeline,omitempty"`
+	// DeviceType functions已翻译成该型号的设备动作
+	DeviceType string `json:"device_type,omitempty"`
+	// ConversationID Dify会话ID，作为后续请求的conversation_id继续对话；缓存命中时为空
+	ConversationID string `json:"conversation_id,omitempty"`
+	// Cache 回答来自缓存时的命中信息
+	Cache *CacheInfo `json:"cache,omitempty"`
+}
+
+// 缓存命中方式
+const (
+	CacheMatchExact   = "exact"
+	CacheMatchSimilar = "similar"
+)
+
+// CacheInfo 缓存命中信息，相似命中时Score为两个问题的相似度
+type CacheInfo struct {
+	Match string  `json:"match"`
+	Score float64 `json:"score"`
+	// Query 相似命中时被复用回答的原始问题
+	Query string `json:"query,omitempty"`
 }
 
 type CompletionResponse struct {
@@ -55,3 +123,93 @@ type CompletionResponse struct {
 	Msg  string                  `json:"msg"`
 	Data *CompletionOptimizeData `json:"data"`
 }
+
+// 流式响应事件类型
+const (
+	StreamEventContent    = "content"
+	StreamEventFunction   = "function"
+	StreamEventDiagnostic = "diagnostic"
+	StreamEventDone       = "done"
+	StreamEventError      = "error"
+)
+
+// StreamEvent 流式响应中的一条事件：content增量、单个function、校验诊断、结束或错误
+type StreamEvent struct {
+	Event string `json:"event"`
+	// Delta content的增量文本
+	Delta string `json:"delta,omitempty"`
+	// Index function在LLM输出的functions数组中的位置
+	Index      int                  `json:"index"`
+	Function   *CompletionFunctions `json:"function,omitempty"`
+	Diagnostic *Diagnostic          `json:"diagnostic,omitempty"`
+	Code       int                  `json:"code,omitempty"`
+	Msg        string               `json:"msg,omitempty"`
+	// Data done事件携带与非流式接口相同的完整结果
+	Data *CompletionOptimizeData `json:"data,omitempty"`
+}
+
+// Timeline 把functions的delay解析成绝对时间的执行计划，时间单位为毫秒
+type Timeline struct {
+	// DelayMode delay的解释方式：absolute、relative 或 sequential
+	DelayMode string             `json:"delay_mode"`
+	Duration  int                `json:"duration"`
+	Entries   []TimelineEntry    `json:"entries"`
+	Conflicts []TimelineConflict `json:"conflicts,omitempty"`
+}
+
+// TimelineEntry 单个动作的执行区间，Index 为其在functions中的下标
+type TimelineEntry struct {
+	Index     int      `json:"index"`
+	Action    string   `json:"action"`
+	Start     int      `json:"start"`
+	Duration  int      `json:"duration"`
+	End       int      `json:"end"`
+	Actuators []string `json:"actuators,omitempty"`
+}
+
+// TimelineConflict 两个动作在同一执行器上的时间重叠
+type TimelineConflict struct {
+	Actuator string `json:"actuator"`
+	First    int    `json:"first"`
+	Second   int    `json:"second"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// TimelinePreviewRequest 时间线预览请求：给出functions时直接编译，否则按query生成回答后编译
+type TimelinePreviewRequest struct {
+	Query      string                `json:"query"`
+	Inputs     map[string]string     `json:"inputs"`
+	User       string                `json:"user,omitempty"`
+	DeviceType string                `json:"device_type,omitempty"`
+	DeviceID   string                `json:"device_id,omitempty"`
+	Content    string                `json:"content"`
+	Functions  []CompletionFunctions `json:"functions"`
+}
+
+// TimelinePreview 按执行器分泳道的时间线，供前端绘制甘特图
+type TimelinePreview struct {
+	DeviceType  string             `json:"device_type,omitempty"`
+	DelayMode   string             `json:"delay_mode"`
+	Duration    int                `json:"duration"`
+	Content     string             `json:"content"`
+	Lanes       []TimelineLane     `json:"lanes"`
+	Conflicts   []TimelineConflict `json:"conflicts,omitempty"`
+	Diagnostics []Diagnostic       `json:"diagnostics,omitempty"`
+}
+
+// TimelineLane 一个执行器上的动作区间，不占用执行器的动作归入 other 泳道
+type TimelineLane struct {
+	Actuator string         `json:"actuator"`
+	Spans    []TimelineSpan `json:"spans"`
+}
+
+// TimelineSpan 泳道上的一个动作，Label 为语音文本等需要直接显示的内容
+type TimelineSpan struct {
+	Index    int    `json:"index"`
+	Action   string `json:"action"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Label    string `json:"label,omitempty"`
+	Conflict bool   `json:"conflict,omitempty"`
+}
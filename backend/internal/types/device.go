@@ -0,0 +1,51 @@
+package types
+
+// 下发给机器人的指令类型
+const (
+	DeviceCommandStop    = "stop"
+	DeviceCommandPerform = "perform"
+)
+
+// 指令优先级，数值越大越先处理
+const (
+	PriorityNormal    = 0
+	PriorityEmergency = 100
+)
+
+// DeviceCommand 通过设备订阅通道下发给机器人的指令
+type DeviceCommand struct {
+	ID        string `json:"id"`
+	DeviceID  string `json:"device_id"`
+	Type      string `json:"type"`
+	Priority  int    `json:"priority"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	// Data perform指令要执行的内容
+	Data *CompletionOptimizeData `json:"data,omitempty"`
+}
+
+// EmergencyStopRequest 急停请求，DeviceIDs为空表示停止全部机器人
+type EmergencyStopRequest struct {
+	DeviceIDs []string `json:"device_ids"`
+	Reason    string   `json:"reason"`
+}
+
+// EmergencyStopResult 急停结果，统计的是处理该请求的实例，其他实例通过Redis广播执行
+type EmergencyStopResult struct {
+	CommandID      string   `json:"command_id"`
+	Delivered      []string `json:"delivered"`
+	CancelledTasks int      `json:"cancelled_tasks"`
+	PurgedActions  int      `json:"purged_actions"`
+	Broadcast      bool     `json:"broadcast"`
+	AuditID        string   `json:"audit_id,omitempty"`
+}
+
+// AuditEntry 一条审计记录
+type AuditEntry struct {
+	ID     string                 `json:"id"`
+	Time   int64                  `json:"time"`
+	Actor  string                 `json:"actor"`
+	Action string                 `json:"action"`
+	Target string                 `json:"target,omitempty"`
+	Detail map[string]interface{} `json:"detail,omitempty"`
+}
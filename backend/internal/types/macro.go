@@ -0,0 +1,14 @@
+package types
+
+// Macro 服务端维护的编排宏：一个具名动作（如 wave、bow）展开为一组带时序的基础动作。
+// 步骤params中的 "${name}" 会被调用时的参数或Params中的默认值替换。
+type Macro struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+	Steps       []CompletionFunctions  `json:"steps"`
+	// Variants 按设备型号覆盖的步骤
+	Variants  map[string][]CompletionFunctions `json:"variants,omitempty"`
+	UpdatedAt int64                            `json:"updated_at,omitempty"`
+	UpdatedBy string                           `json:"updated_by,omitempty"`
+}
@@ -0,0 +1,45 @@
+package types
+
+// Performance 保存下来的一段表演：一次满意的回答（content + functions），可以不经过LLM在任意机器人上重放。
+// Functions 保存翻译前的通用动作，可以引用编排宏，重放时按目标设备的型号展开和翻译。
+type Performance struct {
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Content     string                `json:"content"`
+	Functions   []CompletionFunctions `json:"functions"`
+	// SourceQuery 从LLM录制时使用的问题
+	SourceQuery string `json:"source_query,omitempty"`
+	CreatedAt   int64  `json:"created_at,omitempty"`
+	UpdatedAt   int64  `json:"updated_at,omitempty"`
+	UpdatedBy   string `json:"updated_by,omitempty"`
+}
+
+// PerformanceExport 表演库的导入导出格式
+type PerformanceExport struct {
+	Version      int            `json:"version"`
+	ExportedAt   int64          `json:"exported_at,omitempty"`
+	Performances []*Performance `json:"performances"`
+}
+
+// PerformanceImportResult 导入结果，已存在且未要求覆盖的表演跳过，校验失败的记录原因
+type PerformanceImportResult struct {
+	Imported []string          `json:"imported"`
+	Skipped  []string          `json:"skipped"`
+	Failed   map[string]string `json:"failed,omitempty"`
+}
+
+// RecordPerformanceRequest 由LLM生成回答并保存为表演
+type RecordPerformanceRequest struct {
+	Query       string            `json:"query" binding:"required"`
+	Inputs      map[string]string `json:"inputs"`
+	User        string            `json:"user,omitempty"`
+	Description string            `json:"description,omitempty"`
+}
+
+// PlayPerformanceRequest 重放表演：按目标设备翻译后返回，Push为true时同时下发到已连接的机器人
+type PlayPerformanceRequest struct {
+	DeviceType   string `json:"device_type,omitempty"`
+	DeviceID     string `json:"device_id,omitempty"`
+	ParamsFormat string `json:"params_format,omitempty"`
+	Push         bool   `json:"push,omitempty"`
+}
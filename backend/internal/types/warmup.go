@@ -0,0 +1,57 @@
+package types
+
+// WarmupItem 预热的一个问题，按正常请求的方式计算缓存键
+type WarmupItem struct {
+	Query      string            `json:"query"`
+	Inputs     map[string]string `json:"inputs,omitempty"`
+	DeviceType string            `json:"device_type,omitempty"`
+	DeviceID   string            `json:"device_id,omitempty"`
+	User       string            `json:"user,omitempty"`
+	// Line 在问题清单中的行号，用于报告
+	Line int `json:"line,omitempty"`
+}
+
+// WarmupRequest 预热请求
+type WarmupRequest struct {
+	Items []WarmupItem `json:"items"`
+	// Concurrency 同时请求Dify的数量，默认4，最多32
+	Concurrency int `json:"concurrency,omitempty"`
+	// Refresh 已缓存的问题也重新生成，默认跳过
+	Refresh bool `json:"refresh,omitempty"`
+}
+
+// 预热结果
+const (
+	WarmupWarmed = "warmed"
+	// WarmupSkipped 已有缓存，未重新生成
+	WarmupSkipped = "skipped"
+	WarmupFailed  = "failed"
+	// WarmupViolation 回答不符合格式（降级为纯文本或无法解析）未缓存，或部分动作未通过校验
+	WarmupViolation = "schema_violation"
+)
+
+// WarmupIssue 预热失败或回答不合格的问题
+type WarmupIssue struct {
+	Line        int          `json:"line,omitempty"`
+	Query       string       `json:"query"`
+	DeviceType  string       `json:"device_type,omitempty"`
+	Status      string       `json:"status"`
+	Code        int          `json:"code,omitempty"`
+	Message     string       `json:"message"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	// Cached 回答是否已写入缓存，部分动作未通过校验时仍会缓存
+	Cached bool `json:"cached"`
+}
+
+// WarmupResult 预热报告
+type WarmupResult struct {
+	Total      int            `json:"total"`
+	Warmed     int            `json:"warmed"`
+	Skipped    int            `json:"skipped"`
+	Failed     int            `json:"failed"`
+	Violations int            `json:"violations"`
+	Issues     []*WarmupIssue `json:"issues"`
+	// Duration 总耗时(毫秒)
+	Duration int64  `json:"duration"`
+	AuditID  string `json:"audit_id,omitempty"`
+}
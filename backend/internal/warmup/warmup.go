@@ -0,0 +1,143 @@
+// Package warmup 解析缓存预热的问题清单（JSONL或CSV），服务端接口和命令行工具共用。
+package warmup
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/ai-generation/internal/types"
+)
+
+// 问题清单格式
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// Format 按文件名或Content-Type判断问题清单格式，无法判断时为JSONL
+func Format(filename, contentType string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return FormatCSV
+	case ".jsonl", ".ndjson", ".json":
+		return FormatJSONL
+	}
+	if strings.Contains(strings.ToLower(contentType), "csv") {
+		return FormatCSV
+	}
+	return FormatJSONL
+}
+
+// Parse 读取问题清单。
+// JSONL每行一个 {"query", "inputs", "device_type", "device_id", "user"}；
+// CSV第一行为表头，query 列必填，device_type、device_id、user 列可选，
+// inputs 列为JSON对象，其余列按列名作为inputs的字段
+func Parse(r io.Reader, format string) ([]types.WarmupItem, error) {
+	var items []types.WarmupItem
+	var err error
+	switch format {
+	case FormatCSV:
+		items, err = parseCSV(r)
+	case FormatJSONL, "":
+		items, err = parseJSONL(r)
+	default:
+		return nil, fmt.Errorf("unknown warmup format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errors.New("no queries to warm up")
+	}
+	return items, nil
+}
+
+func parseJSONL(r io.Reader) ([]types.WarmupItem, error) {
+	var items []types.WarmupItem
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var item types.WarmupItem
+		if err := json.Unmarshal([]byte(text), &item); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		item.Line = line
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read warmup list: %w", err)
+	}
+	return items, nil
+}
+
+func parseCSV(r io.Reader) ([]types.WarmupItem, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %v", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+	}
+	if !contains(header, "query") {
+		return nil, errors.New("csv header must contain a query column")
+	}
+	var items []types.WarmupItem
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read csv: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		item := types.WarmupItem{Line: line, Inputs: make(map[string]string)}
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			switch header[i] {
+			case "query":
+				item.Query = value
+			case "device_type":
+				item.DeviceType = value
+			case "device_id":
+				item.DeviceID = value
+			case "user":
+				item.User = value
+			case "inputs":
+				if value == "" {
+					continue
+				}
+				if err := json.Unmarshal([]byte(value), &item.Inputs); err != nil {
+					return nil, fmt.Errorf("line %d: inputs: %v", line, err)
+				}
+			default:
+				if value != "" && header[i] != "" {
+					item.Inputs[header[i]] = value
+				}
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,643 @@
+package dify
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// 修复规则名称，记录在RepairResult.Repairs中，便于统计LLM常见的输出问题
+const (
+	RepairCodeFence      = "code_fence"      // 去除markdown代码块
+	RepairSurrounding    = "surrounding"     // 去除JSON前后的说明文字
+	RepairDoubleEncoded  = "double_encoded"  // 整个回答被编码成了JSON字符串
+	RepairFullWidth      = "full_width"      // 全角标点 ｛｝［］：，“” 转为半角
+	RepairSingleQuote    = "single_quote"    // 单引号字符串转为双引号
+	RepairUnquotedKey    = "unquoted_key"    // 为未加引号的键补引号
+	RepairTrailingComma  = "trailing_comma"  // 删除多余的逗号
+	RepairMissingComma   = "missing_comma"   // 补全值之间缺失的逗号
+	RepairMissingColon   = "missing_colon"   // 补全键值之间缺失的冒号
+	RepairComment        = "comment"         // 删除 // 和 /* */ 注释
+	RepairLiteral        = "literal"         // True/False/None/NaN 等转为JSON字面量
+	RepairControlChar    = "control_char"    // 转义字符串中的换行、制表符
+	RepairInnerQuote     = "inner_quote"     // 转义字符串内部未转义的双引号
+	RepairBareWord       = "bare_word"       // 未加引号的值作为字符串
+	RepairTruncated      = "truncated"       // 补全被截断的字符串、数组和对象
+	RepairMismatched     = "mismatched"      // 修正不匹配的括号
+	RepairMerged         = "merged"          // 合并分散在多个对象中的content/functions
+	RepairUnwrapped      = "unwrapped"       // 从 {"answer": {...}} 等包装中取出回答
+	RepairInvisibleChars = "invisible_chars" // 删除BOM和零宽字符
+)
+
+// ErrNoJSONObject 回答中找不到可修复的JSON对象
+var ErrNoJSONObject = errors.New("no JSON object found in answer")
+
+// answerKeys 机器人回答对象的顶层字段，用于在多个候选对象中选择
+var answerKeys = []string{"content", "functions"}
+
+// maxCandidates 限制扫描的起始位置数量，避免超长文本退化为平方复杂度
+const maxCandidates = 32
+
+var codeFencePattern = regexp.MustCompile("(?s)```[a-zA-Z]*[ \t]*\r?\n?(.*?)```")
+
+var invisibleChars = strings.NewReplacer("\ufeff", "", "\u200b", "", "\u200c", "", "\u200d", "", "\u2060", "")
+
+// RepairResult 修复后的JSON及应用过的修复规则
+type RepairResult struct {
+	JSON    string
+	Repairs []string
+}
+
+func (r *RepairResult) add(rule string) {
+	for _, existing := range r.Repairs {
+		if existing == rule {
+			return
+		}
+	}
+	r.Repairs = append(r.Repairs, rule)
+}
+
+// ExtractAnswerJSON 从LLM回答中提取并修复JSON对象。
+// 按以下顺序处理：去除不可见字符 -> 解开被编码为字符串的JSON -> 优先使用代码块内容 ->
+// 在每个候选起点上做容错扫描修复 -> 选择包含content/functions的对象，必要时合并或解包。
+func ExtractAnswerJSON(input string) (*RepairResult, error) {
+	result := &RepairResult{}
+
+	text := invisibleChars.Replace(input)
+	if text != input {
+		result.add(RepairInvisibleChars)
+	}
+	text = strings.TrimSpace(text)
+
+	// 整个回答被编码成JSON字符串，如 "{\"content\": ...}"
+	if strings.HasPrefix(text, `"`) {
+		var decoded string
+		if err := json.Unmarshal([]byte(text), &decoded); err == nil && strings.Contains(decoded, "{") {
+			text = strings.TrimSpace(decoded)
+			result.add(RepairDoubleEncoded)
+		}
+	}
+
+	// 直接是合法JSON对象时不做任何修改
+	if strings.HasPrefix(text, "{") && json.Valid([]byte(text)) {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(text), &obj); err == nil {
+			if unwrapped, ok := unwrapAnswer(obj); ok {
+				return finishUnwrapped(result, unwrapped)
+			}
+			if hasAnswerKey(obj) {
+				result.JSON = text
+				return result, nil
+			}
+		}
+	}
+
+	var sources []string
+	for _, match := range codeFencePattern.FindAllStringSubmatch(text, -1) {
+		sources = append(sources, match[1])
+	}
+	if len(sources) > 0 {
+		result.add(RepairCodeFence)
+	}
+	sources = append(sources, text)
+
+	for _, source := range sources {
+		objects := scanObjects(source)
+		best, used, unwrapped := pickAnswer(objects)
+		if best == nil {
+			continue
+		}
+		for _, i := range used {
+			for _, rule := range objects[i].repairs {
+				result.add(rule)
+			}
+		}
+		merged := len(used) > 1
+		if merged {
+			result.add(RepairMerged)
+		}
+		if unwrapped {
+			result.add(RepairUnwrapped)
+		}
+		if len(objects) > 1 || strings.TrimSpace(source) != strings.TrimSpace(objects[used[0]].raw) {
+			result.add(RepairSurrounding)
+		}
+		// 未做结构性修改时保留修复后的原文，避免重新序列化改变字段顺序
+		if !merged && !unwrapped {
+			result.JSON = objects[used[0]].repaired
+			return result, nil
+		}
+		data, err := json.Marshal(best)
+		if err != nil {
+			return nil, err
+		}
+		result.JSON = string(data)
+		return result, nil
+	}
+	return nil, ErrNoJSONObject
+}
+
+// RepairJSON 修复文本中的第一个JSON对象，不要求包含回答字段，用于修复Dify响应体
+func RepairJSON(input string) (string, error) {
+	text := strings.TrimSpace(invisibleChars.Replace(input))
+	if json.Valid([]byte(text)) {
+		return text, nil
+	}
+	objects := scanObjects(text)
+	if len(objects) == 0 {
+		return "", ErrNoJSONObject
+	}
+	return objects[0].repaired, nil
+}
+
+func finishUnwrapped(result *RepairResult, obj map[string]interface{}) (*RepairResult, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	result.add(RepairUnwrapped)
+	result.JSON = string(data)
+	return result, nil
+}
+
+type candidate struct {
+	raw      string
+	repaired string
+	value    map[string]interface{}
+	repairs  []string
+}
+
+// scanObjects 从每个 '{' 起点尝试修复出一个完整对象，已被前一个对象覆盖的起点会跳过
+func scanObjects(source string) []candidate {
+	var objects []candidate
+	runes := []rune(source)
+	attempts := 0
+	for i := 0; i < len(runes) && attempts < maxCandidates; i++ {
+		if runes[i] != '{' && runes[i] != '｛' {
+			continue
+		}
+		attempts++
+		repaired, consumed, rules := repairJSON(runes[i:])
+		var value map[string]interface{}
+		if err := json.Unmarshal([]byte(repaired), &value); err != nil {
+			continue
+		}
+		objects = append(objects, candidate{
+			raw:      string(runes[i : i+consumed]),
+			repaired: repaired,
+			value:    value,
+			repairs:  rules,
+		})
+		i += consumed - 1
+	}
+	return objects
+}
+
+// pickAnswer 选择第一个包含回答字段的对象；content和functions分散在多个对象时合并。
+// 返回选中的对象、参与合并的候选下标，以及是否解包过。没有任何候选包含回答字段时返回nil。
+func pickAnswer(objects []candidate) (map[string]interface{}, []int, bool) {
+	for i, object := range objects {
+		best, unwrapped := object.value, false
+		if inner, ok := unwrapAnswer(best); ok {
+			best, unwrapped = inner, true
+		}
+		if !hasAnswerKey(best) {
+			continue
+		}
+
+		used := []int{i}
+		for j := i + 1; j < len(objects); j++ {
+			contributed := false
+			for _, key := range answerKeys {
+				if _, ok := best[key]; ok {
+					continue
+				}
+				if v, ok := objects[j].value[key]; ok {
+					best[key] = v
+					contributed = true
+				}
+			}
+			if contributed {
+				used = append(used, j)
+			}
+		}
+		return best, used, unwrapped
+	}
+	return nil, nil, false
+}
+
+func hasAnswerKey(obj map[string]interface{}) bool {
+	for _, key := range answerKeys {
+		if _, ok := obj[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// unwrapAnswer 处理 {"answer": {...}}、{"data": "{...}"} 这类包装
+func unwrapAnswer(obj map[string]interface{}) (map[string]interface{}, bool) {
+	if hasAnswerKey(obj) || len(obj) != 1 {
+		return nil, false
+	}
+	for _, v := range obj {
+		switch inner := v.(type) {
+		case map[string]interface{}:
+			if hasAnswerKey(inner) {
+				return inner, true
+			}
+		case string:
+			var decoded map[string]interface{}
+			if err := json.Unmarshal([]byte(inner), &decoded); err == nil && hasAnswerKey(decoded) {
+				return decoded, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// fullWidth 字符串外的全角标点映射
+var fullWidth = map[rune]rune{
+	'｛': '{', '｝': '}', '［': '[', '］': ']', '：': ':', '，': ',',
+}
+
+// closingQuote 字符串起始引号对应的结束引号
+var closingQuote = map[rune]rune{
+	'"': '"', '\'': '\'', '“': '”', '‘': '’', '”': '”',
+}
+
+// repairJSON 从起点开始单遍扫描，按修复规则输出合法JSON，返回输出、消耗的字符数和应用的规则。
+// 顶层对象闭合后立即停止，其后的文字不处理。
+func repairJSON(runes []rune) (string, int, []string) {
+	var out []rune
+	var rules []string
+	apply := func(rule string) {
+		for _, r := range rules {
+			if r == rule {
+				return
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	var stack []rune
+	// last 记录最后一个有效记号：'{' '[' ',' ':' 'k'(键) 'v'(值)
+	last := rune(0)
+	lastComma := -1
+	keyStart := -1
+
+	inObject := func() bool { return len(stack) > 0 && stack[len(stack)-1] == '{' }
+	expectKey := func() bool { return inObject() && (last == '{' || last == ',') }
+	colon := func() {
+		if last == 'k' {
+			apply(RepairMissingColon)
+			out = append(out, ':')
+			last = ':'
+		}
+	}
+	separate := func() {
+		colon()
+		if last == 'v' {
+			apply(RepairMissingComma)
+			lastComma = len(out)
+			out = append(out, ',')
+			last = ','
+		}
+	}
+	closeTop := func() {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if top == '{' {
+			out = append(out, '}')
+		} else {
+			out = append(out, ']')
+		}
+		last = 'v'
+	}
+
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		if mapped, ok := fullWidth[r]; ok {
+			apply(RepairFullWidth)
+			r = mapped
+		}
+
+		switch {
+		case unicode.IsSpace(r):
+			out = append(out, r)
+			i++
+
+		case r == '/' && i+1 < len(runes) && (runes[i+1] == '/' || runes[i+1] == '*'):
+			apply(RepairComment)
+			if runes[i+1] == '/' {
+				for i < len(runes) && runes[i] != '\n' {
+					i++
+				}
+			} else {
+				end := indexRunes(runes[i+2:], []rune("*/"))
+				if end < 0 {
+					i = len(runes)
+				} else {
+					i += end + 4
+				}
+			}
+
+		case closingQuote[r] != 0:
+			if r == '\'' || r == '‘' {
+				apply(RepairSingleQuote)
+			} else if r != '"' {
+				apply(RepairFullWidth)
+			}
+			isKey := expectKey()
+			if !isKey {
+				separate()
+				isKey = expectKey()
+			}
+			if isKey {
+				keyStart = len(out)
+				if last == ',' {
+					keyStart = lastComma
+				}
+			}
+			str, consumed, strRules, closed := readString(runes[i:], r)
+			for _, rule := range strRules {
+				apply(rule)
+			}
+			out = append(out, str...)
+			i += consumed
+			if !closed {
+				apply(RepairTruncated)
+			}
+			if isKey {
+				last = 'k'
+			} else {
+				last = 'v'
+			}
+
+		case r == '{' || r == '[':
+			separate()
+			stack = append(stack, r)
+			out = append(out, r)
+			last = r
+			i++
+
+		case r == '}' || r == ']':
+			i++
+			if len(stack) == 0 {
+				continue
+			}
+			if last == ',' {
+				apply(RepairTrailingComma)
+				out = append(out[:lastComma], out[lastComma+1:]...)
+				last = 'v'
+			}
+			if last == ':' {
+				out = append(out, []rune("null")...)
+			}
+			if last == 'k' {
+				out = append(out, []rune(":null")...)
+			}
+			want := '{'
+			if r == ']' {
+				want = '['
+			}
+			if stack[len(stack)-1] != want {
+				apply(RepairMismatched)
+				// 多余的闭合括号直接忽略，否则先闭合内层
+				if !containsRune(stack, want) {
+					continue
+				}
+				for stack[len(stack)-1] != want {
+					closeTop()
+				}
+			}
+			closeTop()
+			if len(stack) == 0 {
+				return string(out), i, rules
+			}
+
+		case r == ',':
+			i++
+			if last == ',' || last == '{' || last == '[' || last == ':' {
+				apply(RepairTrailingComma)
+				continue
+			}
+			if last == 'k' {
+				out = append(out, []rune(":null")...)
+			}
+			lastComma = len(out)
+			out = append(out, ',')
+			last = ','
+
+		case r == ':':
+			i++
+			if last != 'k' {
+				continue
+			}
+			out = append(out, ':')
+			last = ':'
+
+		default:
+			word, consumed := readWord(runes[i:])
+			i += consumed
+			if word == "" {
+				i++
+				continue
+			}
+			if expectKey() {
+				apply(RepairUnquotedKey)
+				keyStart = len(out)
+				if last == ',' {
+					keyStart = lastComma
+				}
+				out = append(out, []rune(quote(word))...)
+				last = 'k'
+				continue
+			}
+			separate()
+			literal, rule := normalizeLiteral(word)
+			if rule != "" {
+				apply(rule)
+			}
+			out = append(out, []rune(literal)...)
+			last = 'v'
+		}
+	}
+
+	// 输出被截断：丢弃悬空的键和逗号，补齐未闭合的括号
+	if len(stack) > 0 {
+		apply(RepairTruncated)
+		switch last {
+		case 'k':
+			out = out[:keyStart]
+		case ':':
+			out = append(out, []rune("null")...)
+		case ',':
+			out = out[:lastComma]
+		}
+		for len(stack) > 0 {
+			closeTop()
+		}
+	}
+	return string(out), len(runes), rules
+}
+
+// readString 读取一个字符串并输出为合法的JSON双引号字符串
+func readString(runes []rune, open rune) ([]rune, int, []string, bool) {
+	var rules []string
+	closer := closingQuote[open]
+	out := []rune{'"'}
+	i := 1
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			next := runes[i+1]
+			switch next {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't', 'u':
+				out = append(out, '\\', next)
+			case '\'':
+				out = append(out, '\'')
+			default:
+				// 非法转义按字面输出反斜杠
+				out = append(out, '\\', '\\', next)
+			}
+			i += 2
+			continue
+		case r == closer:
+			// 未转义的引号：后面不是分隔符或下一个键时视为内容
+			if (closer == '"' || closer == '\'') && !endsValue(runes[i+1:]) {
+				rules = append(rules, RepairInnerQuote)
+				if closer == '\'' {
+					out = append(out, '\'')
+				} else {
+					out = append(out, '\\', '"')
+				}
+				i++
+				continue
+			}
+			out = append(out, '"')
+			return out, i + 1, rules, true
+		case r == '"':
+			out = append(out, '\\', '"')
+		case r == '\n':
+			rules = append(rules, RepairControlChar)
+			out = append(out, '\\', 'n')
+		case r == '\r':
+			rules = append(rules, RepairControlChar)
+			out = append(out, '\\', 'r')
+		case r == '\t':
+			rules = append(rules, RepairControlChar)
+			out = append(out, '\\', 't')
+		case r < 0x20:
+			rules = append(rules, RepairControlChar)
+			out = append(out, []rune(`\u00`)...)
+			out = append(out, rune("0123456789abcdef"[r>>4]), rune("0123456789abcdef"[r&0xf]))
+		default:
+			out = append(out, r)
+		}
+		i++
+	}
+	// 字符串被截断，去掉结尾不完整的转义后闭合
+	if len(out) > 1 && out[len(out)-1] == '\\' {
+		out = out[:len(out)-1]
+	}
+	out = append(out, '"')
+	return out, len(runes), rules, false
+}
+
+// endsValue 判断引号之后是否是字符串的结束位置：后面是分隔符，或是缺少逗号的下一个键
+func endsValue(rest []rune) bool {
+	for i, r := range rest {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		switch r {
+		case ',', '}', ']', ':', '，', '｝', '］', '：':
+			return true
+		case '"':
+			end := indexRunes(rest[i+1:], []rune{'"'})
+			if end < 0 {
+				return false
+			}
+			for _, next := range rest[i+1+end+1:] {
+				if unicode.IsSpace(next) {
+					continue
+				}
+				return next == ':' || next == '：'
+			}
+			return false
+		}
+		return false
+	}
+	return true
+}
+
+// readWord 读取未加引号的单词，直到遇到分隔符
+func readWord(runes []rune) (string, int) {
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		if unicode.IsSpace(r) || strings.ContainsRune(`,:{}[]"'“”‘’，：｛｝［］`, r) {
+			break
+		}
+		if r == '/' && i+1 < len(runes) && (runes[i+1] == '/' || runes[i+1] == '*') {
+			break
+		}
+		i++
+	}
+	return string(runes[:i]), i
+}
+
+var numberPattern = regexp.MustCompile(`^-?(0|[1-9]\d*)(\.\d+)?([eE][+-]?\d+)?$`)
+
+// normalizeLiteral 将单词转换为JSON字面量，非字面量按字符串处理
+func normalizeLiteral(word string) (string, string) {
+	switch word {
+	case "true", "false", "null":
+		return word, ""
+	case "True", "TRUE":
+		return "true", RepairLiteral
+	case "False", "FALSE":
+		return "false", RepairLiteral
+	case "None", "NULL", "Null", "undefined", "NaN", "Infinity", "-Infinity":
+		return "null", RepairLiteral
+	}
+	if numberPattern.MatchString(word) {
+		return word, ""
+	}
+	trimmed := strings.TrimPrefix(word, "+")
+	if strings.HasPrefix(trimmed, ".") {
+		trimmed = "0" + trimmed
+	}
+	if numberPattern.MatchString(trimmed) {
+		return trimmed, RepairLiteral
+	}
+	return quote(word), RepairBareWord
+}
+
+func quote(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func indexRunes(runes, sub []rune) int {
+	for i := 0; i+len(sub) <= len(runes); i++ {
+		if string(runes[i:i+len(sub)]) == string(sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsRune(runes []rune, r rune) bool {
+	for _, x := range runes {
+		if x == r {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,253 @@
+package dify
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// AnswerScanner 增量扫描流式输出的回答JSON。
+// content字符串的内容一边到达一边通过OnContent输出，functions数组中的每个元素在语法上完整后
+// 立即通过OnFunction输出，不必等待整个对象闭合。第一个 '{' 之前（如代码块标记）和顶层对象闭合
+// 之后的文字会被忽略。扫描器只做切分，元素的解析和校验由调用方完成。
+type AnswerScanner struct {
+	OnContent  func(delta string) error
+	OnFunction func(index int, raw string) error
+
+	started bool
+	done    bool
+	stack   []rune
+
+	inString bool
+	escaped  bool
+
+	// 顶层对象中的位置：key、colon、value、next
+	expect     string
+	readingKey bool
+	key        strings.Builder
+	currentKey string
+
+	// content字符串的流式解码
+	inContent bool
+	escape    []rune
+	surrogate rune
+	delta     strings.Builder
+
+	// functions数组元素的捕获
+	inFunctions   bool
+	capturing     bool
+	captureDepth  int
+	element       strings.Builder
+	functionIndex int
+}
+
+// Done 顶层对象是否已经闭合
+func (s *AnswerScanner) Done() bool {
+	return s.done
+}
+
+// Write 输入一段流式文本
+func (s *AnswerScanner) Write(chunk string) error {
+	for _, r := range chunk {
+		if s.done {
+			break
+		}
+		if err := s.feed(r); err != nil {
+			return err
+		}
+	}
+	return s.flushContent()
+}
+
+func (s *AnswerScanner) feed(r rune) error {
+	if !s.started {
+		if r != '{' {
+			return nil
+		}
+		s.started = true
+	}
+
+	if s.capturing {
+		s.element.WriteRune(r)
+	}
+
+	if s.inString {
+		return s.feedString(r)
+	}
+
+	switch r {
+	case '"':
+		s.inString = true
+		if len(s.stack) == 1 {
+			switch s.expect {
+			case "key":
+				s.readingKey = true
+				s.key.Reset()
+			case "value":
+				s.inContent = s.currentKey == "content"
+			}
+		}
+	case '{', '[':
+		depth := len(s.stack)
+		s.stack = append(s.stack, r)
+		if depth == 0 {
+			s.expect = "key"
+			return nil
+		}
+		if depth == 1 && s.expect == "value" {
+			s.inFunctions = r == '[' && s.currentKey == "functions"
+			s.expect = "next"
+		}
+		if s.inFunctions && depth == 2 && r == '{' && !s.capturing {
+			s.capturing = true
+			s.captureDepth = depth
+			s.element.Reset()
+			s.element.WriteRune(r)
+		}
+	case '}', ']':
+		if len(s.stack) == 0 {
+			return nil
+		}
+		s.stack = s.stack[:len(s.stack)-1]
+		depth := len(s.stack)
+		if s.capturing && depth == s.captureDepth {
+			s.capturing = false
+			index := s.functionIndex
+			s.functionIndex++
+			if s.OnFunction != nil {
+				if err := s.OnFunction(index, s.element.String()); err != nil {
+					return err
+				}
+			}
+		}
+		if depth == 1 {
+			s.inFunctions = false
+			s.expect = "next"
+		}
+		if depth == 0 {
+			s.done = true
+		}
+	case ':':
+		if len(s.stack) == 1 && s.expect == "colon" {
+			s.expect = "value"
+		}
+	case ',':
+		if len(s.stack) == 1 {
+			s.expect = "key"
+		}
+	case ' ', '\t', '\n', '\r':
+		// 空白不改变所处位置
+	default:
+		// 数字、true/false/null等非字符串值
+		if len(s.stack) == 1 && s.expect == "value" {
+			s.expect = "next"
+		}
+	}
+	return nil
+}
+
+func (s *AnswerScanner) feedString(r rune) error {
+	if s.escaped {
+		s.escaped = false
+		if s.inContent {
+			return s.feedContentEscape(r)
+		}
+		if s.readingKey {
+			s.key.WriteRune(unescapeSimple(r))
+		}
+		return nil
+	}
+	if len(s.escape) > 0 {
+		// \uXXXX 的十六进制部分
+		return s.feedContentEscape(r)
+	}
+
+	switch r {
+	case '\\':
+		s.escaped = true
+		if s.inContent {
+			s.escape = append(s.escape[:0], '\\')
+		}
+	case '"':
+		s.inString = false
+		if s.readingKey {
+			s.readingKey = false
+			s.currentKey = s.key.String()
+			s.expect = "colon"
+		} else if len(s.stack) == 1 && s.expect == "value" {
+			s.expect = "next"
+		}
+		if s.inContent {
+			s.inContent = false
+			return s.flushContent()
+		}
+	default:
+		if s.readingKey {
+			s.key.WriteRune(r)
+		} else if s.inContent {
+			s.delta.WriteRune(r)
+		}
+	}
+	return nil
+}
+
+// feedContentEscape 解码content中的转义序列，\uXXXX可能跨多个chunk到达
+func (s *AnswerScanner) feedContentEscape(r rune) error {
+	if len(s.escape) == 1 {
+		if r != 'u' {
+			s.escape = s.escape[:0]
+			s.delta.WriteRune(unescapeSimple(r))
+			return nil
+		}
+		s.escape = append(s.escape, r)
+		return nil
+	}
+	s.escape = append(s.escape, r)
+	if len(s.escape) < 6 {
+		return nil
+	}
+	code, err := strconv.ParseUint(string(s.escape[2:6]), 16, 32)
+	s.escape = s.escape[:0]
+	if err != nil {
+		return nil
+	}
+	decoded := rune(code)
+	switch {
+	case utf16.IsSurrogate(decoded) && s.surrogate == 0:
+		s.surrogate = decoded
+	case s.surrogate != 0:
+		s.delta.WriteRune(utf16.DecodeRune(s.surrogate, decoded))
+		s.surrogate = 0
+	default:
+		s.delta.WriteRune(decoded)
+	}
+	return nil
+}
+
+func (s *AnswerScanner) flushContent() error {
+	if s.delta.Len() == 0 {
+		return nil
+	}
+	delta := s.delta.String()
+	s.delta.Reset()
+	if s.OnContent != nil {
+		return s.OnContent(delta)
+	}
+	return nil
+}
+
+func unescapeSimple(r rune) rune {
+	switch r {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	case 'b':
+		return '\b'
+	case 'f':
+		return '\f'
+	}
+	return r
+}
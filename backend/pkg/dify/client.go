@@ -9,7 +9,6 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"strings"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -63,6 +62,8 @@ type CompletionRequest struct {
 	Inputs       map[string]string `json:"inputs"`
 	User         string            `json:"user,omitempty"`
 	ResponseMode string            `json:"response_mode,omitempty"`
+	// ConversationID 为空时Dify创建新会话，否则在该会话中继续对话
+	ConversationID string `json:"conversation_id,omitempty"`
 }
 
 type CompletionOriginResponse struct {
@@ -75,21 +76,28 @@ type CompletionOriginResponse struct {
 	Answer         string                 `json:"answer"`
 	CreatedAt      int64                  `json:"created_at"`
 	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	// AnswerRepairs 提取Answer中的JSON时应用的修复规则，不来自Dify
+	AnswerRepairs []string `json:"-"`
 }
 
 func (c *Client) Completion(req *CompletionRequest) (*CompletionOriginResponse, error) {
+	return c.CompletionWithContext(context.Background(), req)
+}
+
+// CompletionWithContext 与Completion相同，但在parent取消或超时时中止请求
+func (c *Client) CompletionWithContext(parent context.Context, req *CompletionRequest) (*CompletionOriginResponse, error) {
 	// 应用限流
-	if err := c.limiter.Wait(context.Background()); err != nil {
+	if err := c.limiter.Wait(parent); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := context.WithTimeout(parent, c.timeout)
 	defer cancel()
 
-	// 创建一个channel用于接收结果
-	respCh := make(chan *CompletionOriginResponse)
-	errCh := make(chan error)
-	taskIDCh := make(chan string)
+	// 创建一个channel用于接收结果，带缓冲避免调用方提前返回后goroutine阻塞
+	respCh := make(chan *CompletionOriginResponse, 1)
+	errCh := make(chan error, 1)
+	taskIDCh := make(chan string, 1)
 	// 设置默认的response_mode为blocking
 	if req.ResponseMode == "" {
 		req.ResponseMode = "blocking"
@@ -97,9 +105,6 @@ func (c *Client) Completion(req *CompletionRequest) (*CompletionOriginResponse,
 
 	// 启动goroutine处理请求
 	go func() {
-		defer close(respCh)
-		defer close(errCh)
-		defer close(taskIDCh)
 
 		// 实现重试机制
 		backoff := time.Second
@@ -152,26 +157,24 @@ func (c *Client) Completion(req *CompletionRequest) (*CompletionOriginResponse,
 			// 尝试解析JSON响应
 			var result CompletionOriginResponse
 			if err := json.Unmarshal(body, &result); err != nil {
-				// 如果解析失败，尝试提取有效的JSON部分
-				validJSON := extractValidJSON(string(body))
-				if validJSON != "" {
-					if err := json.Unmarshal([]byte(validJSON), &result); err != nil {
-						errCh <- fmt.Errorf("parse extracted json: %w, original body: %s", err, string(body))
-						return
-					}
-				} else {
+				// 如果解析失败，尝试修复响应中的JSON
+				validJSON, repairErr := RepairJSON(string(body))
+				if repairErr != nil {
 					errCh <- fmt.Errorf("invalid json response: %s", string(body))
 					return
 				}
+				if err := json.Unmarshal([]byte(validJSON), &result); err != nil {
+					errCh <- fmt.Errorf("parse extracted json: %w, original body: %s", err, string(body))
+					return
+				}
 			}
 
 			// 处理Answer字段中的JSON内容
 			if result.Answer != "" {
-				// 尝试修复和提取Answer中的JSON内容
-				validAnswerJSON := extractValidJSON(result.Answer)
-				if validAnswerJSON != "" {
-					// 使用修复后的JSON内容
-					result.Answer = validAnswerJSON
+				// 尝试修复和提取Answer中的JSON内容，失败时保留原文由上层处理
+				if repaired, err := ExtractAnswerJSON(result.Answer); err == nil {
+					result.Answer = repaired.JSON
+					result.AnswerRepairs = repaired.Repairs
 				}
 			}
 
@@ -209,28 +212,6 @@ func (c *Client) Completion(req *CompletionRequest) (*CompletionOriginResponse,
 	}
 }
 
-// extractValidJSON 尝试从可能包含无效字符的字符串中提取有效的JSON
-func extractValidJSON(input string) string {
-	// 查找第一个 '{' 和最后一个 '}'
-	start := strings.Index(input, "{")
-	end := strings.LastIndex(input, "}")
-
-	if start == -1 || end == -1 || end <= start {
-		return ""
-	}
-
-	// 提取可能的JSON部分
-	potentialJSON := input[start : end+1]
-
-	// 验证是否为有效的JSON
-	var js json.RawMessage
-	if err := json.Unmarshal([]byte(potentialJSON), &js); err != nil {
-		return ""
-	}
-
-	return potentialJSON
-}
-
 // 判断是否是可重试的错误
 func isRetryableError(err error) bool {
 	// 网络超时、连接重置等错误可以重试
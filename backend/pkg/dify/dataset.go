@@ -0,0 +1,340 @@
+package dify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DatasetClient 封装Dify知识库(dataset)接口，使用知识库API密钥而非应用密钥
+type DatasetClient struct {
+	apiKey   string
+	endpoint string
+	client   *http.Client
+	timeout  time.Duration
+}
+
+func NewDatasetClient(apiKey, endpoint string) *DatasetClient {
+	return &DatasetClient{
+		apiKey:   apiKey,
+		endpoint: endpoint,
+		timeout:  2 * time.Minute, // 文件上传可能较慢
+		client: &http.Client{
+			Transport: &http.Transport{
+				MaxIdleConns:        10,
+				MaxIdleConnsPerHost: 10,
+				IdleConnTimeout:     90 * time.Second,
+				DialContext: (&net.Dialer{
+					KeepAlive: 30 * time.Second,
+					Timeout:   30 * time.Second,
+				}).DialContext,
+			},
+		},
+	}
+}
+
+// APIError Dify接口返回的非200错误，保留状态码以便上层透传
+type APIError struct {
+	StatusCode int    `json:"status"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("dify api error: status=%d code=%s message=%s", e.StatusCode, e.Code, e.Message)
+}
+
+// ProcessRule 文档分段规则，默认使用automatic
+type ProcessRule struct {
+	Mode  string                 `json:"mode"`
+	Rules map[string]interface{} `json:"rules,omitempty"`
+}
+
+// DocumentRequest 通过文本或文件创建/更新文档的参数
+type DocumentRequest struct {
+	Name              string       `json:"name,omitempty"`
+	Text              string       `json:"text,omitempty"`
+	IndexingTechnique string       `json:"indexing_technique,omitempty"`
+	ProcessRule       *ProcessRule `json:"process_rule,omitempty"`
+}
+
+type Document struct {
+	ID             string `json:"id"`
+	Position       int    `json:"position"`
+	DataSourceType string `json:"data_source_type"`
+	Name           string `json:"name"`
+	CreatedFrom    string `json:"created_from"`
+	CreatedAt      int64  `json:"created_at"`
+	Tokens         int    `json:"tokens"`
+	IndexingStatus string `json:"indexing_status"`
+	Error          string `json:"error,omitempty"`
+	Enabled        bool   `json:"enabled"`
+	Archived       bool   `json:"archived"`
+	DisplayStatus  string `json:"display_status"`
+	WordCount      int    `json:"word_count"`
+	HitCount       int    `json:"hit_count"`
+	DocForm        string `json:"doc_form"`
+}
+
+// DocumentResponse 创建/更新文档的返回，batch用于查询索引进度
+type DocumentResponse struct {
+	Document Document `json:"document"`
+	Batch    string   `json:"batch"`
+}
+
+type DocumentList struct {
+	Data    []Document `json:"data"`
+	HasMore bool       `json:"has_more"`
+	Limit   int        `json:"limit"`
+	Total   int        `json:"total"`
+	Page    int        `json:"page"`
+}
+
+type Segment struct {
+	ID          string   `json:"id"`
+	Position    int      `json:"position"`
+	DocumentID  string   `json:"document_id"`
+	Content     string   `json:"content"`
+	Answer      string   `json:"answer"`
+	WordCount   int      `json:"word_count"`
+	Tokens      int      `json:"tokens"`
+	Keywords    []string `json:"keywords"`
+	HitCount    int      `json:"hit_count"`
+	Enabled     bool     `json:"enabled"`
+	Status      string   `json:"status"`
+	CreatedAt   int64    `json:"created_at"`
+	IndexingAt  int64    `json:"indexing_at"`
+	CompletedAt int64    `json:"completed_at"`
+	Error       string   `json:"error,omitempty"`
+}
+
+type SegmentList struct {
+	Data    []Segment `json:"data"`
+	DocForm string    `json:"doc_form"`
+}
+
+type IndexingStatus struct {
+	ID                   string  `json:"id"`
+	IndexingStatus       string  `json:"indexing_status"`
+	ProcessingStartedAt  float64 `json:"processing_started_at"`
+	ParsingCompletedAt   float64 `json:"parsing_completed_at"`
+	CleaningCompletedAt  float64 `json:"cleaning_completed_at"`
+	SplittingCompletedAt float64 `json:"splitting_completed_at"`
+	CompletedAt          float64 `json:"completed_at"`
+	PausedAt             float64 `json:"paused_at"`
+	Error                string  `json:"error"`
+	StoppedAt            float64 `json:"stopped_at"`
+	CompletedSegments    int     `json:"completed_segments"`
+	TotalSegments        int     `json:"total_segments"`
+}
+
+type IndexingStatusList struct {
+	Data []IndexingStatus `json:"data"`
+}
+
+// withDefaults 补全Dify要求的索引方式与分段规则
+func (r *DocumentRequest) withDefaults() *DocumentRequest {
+	out := *r
+	if out.IndexingTechnique == "" {
+		out.IndexingTechnique = "high_quality"
+	}
+	if out.ProcessRule == nil {
+		out.ProcessRule = &ProcessRule{Mode: "automatic"}
+	}
+	return &out
+}
+
+// CreateDocumentByText 通过文本创建文档
+func (c *DatasetClient) CreateDocumentByText(datasetID string, req *DocumentRequest) (*DocumentResponse, error) {
+	var result DocumentResponse
+	path := fmt.Sprintf("/v1/datasets/%s/document/create-by-text", url.PathEscape(datasetID))
+	if err := c.doJSON("POST", path, req.withDefaults(), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CreateDocumentByFile 通过上传文件创建文档
+func (c *DatasetClient) CreateDocumentByFile(datasetID string, req *DocumentRequest, filename string, file io.Reader) (*DocumentResponse, error) {
+	var result DocumentResponse
+	path := fmt.Sprintf("/v1/datasets/%s/document/create-by-file", url.PathEscape(datasetID))
+	if err := c.doMultipart(path, req.withDefaults(), filename, file, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UpdateDocumentByText 使用文本更新已有文档
+func (c *DatasetClient) UpdateDocumentByText(datasetID, documentID string, req *DocumentRequest) (*DocumentResponse, error) {
+	var result DocumentResponse
+	path := fmt.Sprintf("/v1/datasets/%s/documents/%s/update-by-text", url.PathEscape(datasetID), url.PathEscape(documentID))
+	if err := c.doJSON("POST", path, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UpdateDocumentByFile 使用上传文件更新已有文档
+func (c *DatasetClient) UpdateDocumentByFile(datasetID, documentID string, req *DocumentRequest, filename string, file io.Reader) (*DocumentResponse, error) {
+	var result DocumentResponse
+	path := fmt.Sprintf("/v1/datasets/%s/documents/%s/update-by-file", url.PathEscape(datasetID), url.PathEscape(documentID))
+	if err := c.doMultipart(path, req, filename, file, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteDocument 删除文档
+func (c *DatasetClient) DeleteDocument(datasetID, documentID string) error {
+	path := fmt.Sprintf("/v1/datasets/%s/documents/%s", url.PathEscape(datasetID), url.PathEscape(documentID))
+	return c.doJSON("DELETE", path, nil, nil)
+}
+
+// ListDocuments 分页列出知识库中的文档
+func (c *DatasetClient) ListDocuments(datasetID, keyword string, page, limit int) (*DocumentList, error) {
+	query := url.Values{}
+	if keyword != "" {
+		query.Set("keyword", keyword)
+	}
+	if page > 0 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	path := fmt.Sprintf("/v1/datasets/%s/documents", url.PathEscape(datasetID))
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var result DocumentList
+	if err := c.doJSON("GET", path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListSegments 列出文档的分段
+func (c *DatasetClient) ListSegments(datasetID, documentID, keyword, status string) (*SegmentList, error) {
+	query := url.Values{}
+	if keyword != "" {
+		query.Set("keyword", keyword)
+	}
+	if status != "" {
+		query.Set("status", status)
+	}
+	path := fmt.Sprintf("/v1/datasets/%s/documents/%s/segments", url.PathEscape(datasetID), url.PathEscape(documentID))
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var result SegmentList
+	if err := c.doJSON("GET", path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// IndexingStatus 查询一次上传批次的索引进度
+func (c *DatasetClient) IndexingStatus(datasetID, batch string) (*IndexingStatusList, error) {
+	path := fmt.Sprintf("/v1/datasets/%s/documents/%s/indexing-status", url.PathEscape(datasetID), url.PathEscape(batch))
+	var result IndexingStatusList
+	if err := c.doJSON("GET", path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *DatasetClient) doJSON(method, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, reader)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	return c.do(httpReq, result)
+}
+
+func (c *DatasetClient) doMultipart(path string, req *DocumentRequest, filename string, file io.Reader, result interface{}) error {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+	if err := writer.WriteField("data", string(data)); err != nil {
+		return fmt.Errorf("write data field: %w", err)
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return fmt.Errorf("create file field: %w", err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return fmt.Errorf("copy file: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("close multipart writer: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.endpoint+path, &buf)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", writer.FormDataContentType())
+	return c.do(httpReq, result)
+}
+
+func (c *DatasetClient) do(httpReq *http.Request, result interface{}) error {
+	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response body: %w", err)
+	}
+
+	// 删除接口成功时返回204
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if err := json.Unmarshal(body, apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = string(body)
+		}
+		apiErr.StatusCode = resp.StatusCode
+		return apiErr
+	}
+
+	if result == nil || len(body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package dify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// StreamEvent Dify streaming模式下的一条SSE事件
+type StreamEvent struct {
+	Event          string                 `json:"event"`
+	TaskID         string                 `json:"task_id"`
+	ID             string                 `json:"id"`
+	MessageID      string                 `json:"message_id"`
+	ConversationId string                 `json:"conversation_id"`
+	Answer         string                 `json:"answer"`
+	CreatedAt      int64                  `json:"created_at"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	Status         int                    `json:"status,omitempty"`
+	Code           string                 `json:"code,omitempty"`
+	Message        string                 `json:"message,omitempty"`
+}
+
+// CompletionStream 以streaming模式调用chat-messages，每收到一段answer调用一次onChunk。
+// 返回拼接完整并经过JSON修复的回答；ctx取消时会通知Dify停止生成。
+func (c *Client) CompletionStream(ctx context.Context, req *CompletionRequest, onChunk func(event *StreamEvent) error) (*CompletionOriginResponse, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("rate limit exceeded: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	streamReq := *req
+	streamReq.ResponseMode = "streaming"
+	data, err := json.Marshal(&streamReq)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.endpoint+"/v1/chat-messages", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	result := &CompletionOriginResponse{Mode: "chat"}
+	var answer strings.Builder
+	stopped := false
+	stop := func() {
+		if stopped || result.TaskID == "" {
+			return
+		}
+		stopped = true
+		if err := c.StopChatMessage(result.TaskID, req.User); err != nil {
+			fmt.Printf("Failed to stop chat message: %v\n", err)
+		}
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				stop()
+				return nil, ctx.Err()
+			}
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("read stream: %w", err)
+		}
+
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if payload == "" {
+			continue
+		}
+
+		var event StreamEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			fmt.Printf("invalid stream event: %v, payload: %s\n", err, payload)
+			continue
+		}
+		if result.TaskID == "" {
+			result.TaskID = event.TaskID
+			result.ConversationId = event.ConversationId
+			result.MessageID = event.MessageID
+			result.ID = event.ID
+			result.CreatedAt = event.CreatedAt
+		}
+
+		switch event.Event {
+		case "message", "agent_message":
+			answer.WriteString(event.Answer)
+			if err := onChunk(&event); err != nil {
+				stop()
+				return nil, err
+			}
+		case "message_replace":
+			// 内容审查替换了整段回答
+			answer.Reset()
+			answer.WriteString(event.Answer)
+			if err := onChunk(&event); err != nil {
+				stop()
+				return nil, err
+			}
+		case "message_end":
+			result.Event = event.Event
+			result.Metadata = event.Metadata
+		case "error":
+			return nil, fmt.Errorf("dify stream error: status=%d code=%s message=%s", event.Status, event.Code, event.Message)
+		}
+	}
+
+	result.Answer = answer.String()
+	if repaired, err := ExtractAnswerJSON(result.Answer); err == nil {
+		result.Answer = repaired.JSON
+		result.AnswerRepairs = repaired.Repairs
+	}
+	return result, nil
+}
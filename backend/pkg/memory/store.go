@@ -0,0 +1,495 @@
+// Package memory 进程内的键值存储，提供与 pkg/redis 相同的操作，
+// 用于不依赖Redis的单机部署，或作为Redis前面的一级缓存。
+package memory
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound Get的key不存在或已过期
+var ErrNotFound = errors.New("memory: key not found")
+
+// ErrWrongType 对不同类型的值执行了操作，如对列表执行Get
+var ErrWrongType = errors.New("memory: operation against a key holding the wrong kind of value")
+
+// IsNotFound 判断Get的错误是否为key不存在
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindList
+	kindHash
+)
+
+type entry struct {
+	key     string
+	kind    kind
+	data    []byte
+	list    []string
+	hash    map[string]string
+	expires time.Time
+	// elem 设置了过期时间的key在LRU链表中的位置，永久key为nil
+	elem *list.Element
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// Store 带容量上限的进程内存储。只有设置了过期时间的key参与LRU淘汰，
+// 永久保存的数据（宏、表演等）不会因为缓存写满而丢失
+type Store struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	lru     *list.List
+
+	subMu       sync.Mutex
+	subscribers map[string]map[chan []byte]struct{}
+}
+
+// NewStore 创建存储，maxEntries为参与淘汰的key的上限，0表示不限制
+func NewStore(maxEntries int) *Store {
+	return &Store{
+		maxEntries:  maxEntries,
+		entries:     make(map[string]*entry),
+		lru:         list.New(),
+		subscribers: make(map[string]map[chan []byte]struct{}),
+	}
+}
+
+// Ping 进程内存储总是可用
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+// lookup 返回未过期的key并标记为最近使用，调用方必须持有锁
+func (s *Store) lookup(key string, now time.Time) *entry {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if e.expired(now) {
+		s.remove(e)
+		return nil
+	}
+	if e.elem != nil {
+		s.lru.MoveToFront(e.elem)
+	}
+	return e
+}
+
+// put 保存key并按过期时间加入或移出LRU链表，超出容量时淘汰最久未使用的key，调用方必须持有锁
+func (s *Store) put(e *entry, expiration time.Duration) {
+	if old, ok := s.entries[e.key]; ok && old != e {
+		s.remove(old)
+	}
+	s.entries[e.key] = e
+	s.setExpiration(e, expiration)
+}
+
+func (s *Store) setExpiration(e *entry, expiration time.Duration) {
+	if expiration > 0 {
+		e.expires = time.Now().Add(expiration)
+		if e.elem == nil {
+			e.elem = s.lru.PushFront(e)
+		} else {
+			s.lru.MoveToFront(e.elem)
+		}
+	} else {
+		e.expires = time.Time{}
+		if e.elem != nil {
+			s.lru.Remove(e.elem)
+			e.elem = nil
+		}
+	}
+	for s.maxEntries > 0 && s.lru.Len() > s.maxEntries {
+		s.remove(s.lru.Back().Value.(*entry))
+	}
+}
+
+func (s *Store) remove(e *entry) {
+	if e.elem != nil {
+		s.lru.Remove(e.elem)
+		e.elem = nil
+	}
+	delete(s.entries, e.key)
+}
+
+// Set 把值编码为JSON后保存，expiration为0表示永久保存
+func (s *Store) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(&entry{key: key, kind: kindString, data: data}, expiration)
+	return nil
+}
+
+// SetNX 仅在key不存在时设置原始字符串值
+func (s *Store) SetNX(ctx context.Context, key, value string, expiration time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lookup(key, time.Now()) != nil {
+		return false, nil
+	}
+	s.put(&entry{key: key, kind: kindString, data: []byte(value)}, expiration)
+	return true, nil
+}
+
+// DelIfValue 仅在key的原始值等于value时删除
+func (s *Store) DelIfValue(ctx context.Context, key, value string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookup(key, time.Now())
+	if e == nil || e.kind != kindString || string(e.data) != value {
+		return false, nil
+	}
+	s.remove(e)
+	return true, nil
+}
+
+// Get 读取并解码JSON值，key不存在时返回 ErrNotFound
+func (s *Store) Get(ctx context.Context, key string, value interface{}) error {
+	s.mu.Lock()
+	e := s.lookup(key, time.Now())
+	var data []byte
+	if e != nil && e.kind == kindString {
+		data = e.data
+	}
+	s.mu.Unlock()
+	if e == nil {
+		return ErrNotFound
+	}
+	if data == nil {
+		return ErrWrongType
+	}
+	return json.Unmarshal(data, value)
+}
+
+// Del 删除key
+func (s *Store) Del(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		if e, ok := s.entries[key]; ok {
+			s.remove(e)
+		}
+	}
+	return nil
+}
+
+// Scan 返回匹配glob模式（支持 * 和 ?）的全部key，按字典序排列；count仅为与Redis保持一致
+func (s *Store) Scan(ctx context.Context, pattern string, count int64) ([]string, error) {
+	now := time.Now()
+	s.mu.Lock()
+	var keys []string
+	for key, e := range s.entries {
+		if e.expired(now) {
+			s.remove(e)
+			continue
+		}
+		if Match(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.Unlock()
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Exists 检查key是否存在
+func (s *Store) Exists(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lookup(key, time.Now()) != nil, nil
+}
+
+// TTL 返回key的剩余有效期，永久key返回0，key不存在时返回 ErrNotFound
+func (s *Store) TTL(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookup(key, time.Now())
+	if e == nil {
+		return 0, ErrNotFound
+	}
+	if e.expires.IsZero() {
+		return 0, nil
+	}
+	return time.Until(e.expires), nil
+}
+
+// LPush 把值编码为JSON后插入列表头部，并只保留最新的maxLen条
+func (s *Store) LPush(ctx context.Context, key string, value interface{}, maxLen int64) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookup(key, time.Now())
+	if e == nil {
+		e = &entry{key: key, kind: kindList}
+		s.put(e, 0)
+	}
+	if e.kind != kindList {
+		return ErrWrongType
+	}
+	e.list = append([]string{string(data)}, e.list...)
+	if maxLen > 0 && int64(len(e.list)) > maxLen {
+		e.list = e.list[:maxLen]
+	}
+	return nil
+}
+
+// LRange 读取列表中[start, stop]范围的原始JSON，stop为负数时从末尾计算
+func (s *Store) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookup(key, time.Now())
+	if e == nil {
+		return []string{}, nil
+	}
+	if e.kind != kindList {
+		return nil, ErrWrongType
+	}
+	n := int64(len(e.list))
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return []string{}, nil
+	}
+	return append([]string{}, e.list[start:stop+1]...), nil
+}
+
+// HSet 设置哈希字段，expiration大于0时刷新整个哈希的过期时间
+func (s *Store) HSet(ctx context.Context, key, field, value string, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookup(key, time.Now())
+	if e == nil {
+		e = &entry{key: key, kind: kindHash, hash: make(map[string]string)}
+		s.put(e, expiration)
+	} else if expiration > 0 {
+		s.setExpiration(e, expiration)
+	}
+	if e.kind != kindHash {
+		return ErrWrongType
+	}
+	e.hash[field] = value
+	return nil
+}
+
+// HGetAll 读取哈希的全部字段，key不存在时返回空map
+func (s *Store) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make(map[string]string)
+	e := s.lookup(key, time.Now())
+	if e == nil {
+		return result, nil
+	}
+	if e.kind != kindHash {
+		return nil, ErrWrongType
+	}
+	for field, value := range e.hash {
+		result[field] = value
+	}
+	return result, nil
+}
+
+// HGet 读取哈希字段，字段不存在时返回 ErrNotFound
+func (s *Store) HGet(ctx context.Context, key, field string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookup(key, time.Now())
+	if e == nil {
+		return "", ErrNotFound
+	}
+	if e.kind != kindHash {
+		return "", ErrWrongType
+	}
+	value, ok := e.hash[field]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// HIncrBy 增加哈希字段的整数值并返回新值，字段不存在时从0开始
+func (s *Store) HIncrBy(ctx context.Context, key, field string, incr int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookup(key, time.Now())
+	if e == nil {
+		e = &entry{key: key, kind: kindHash, hash: make(map[string]string)}
+		s.put(e, 0)
+	}
+	if e.kind != kindHash {
+		return 0, ErrWrongType
+	}
+	var value int64
+	if current, ok := e.hash[field]; ok {
+		parsed, err := strconv.ParseInt(current, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("memory: hash value is not an integer: %w", err)
+		}
+		value = parsed
+	}
+	value += incr
+	e.hash[field] = strconv.FormatInt(value, 10)
+	return value, nil
+}
+
+// HLen 返回哈希的字段数
+func (s *Store) HLen(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookup(key, time.Now())
+	if e == nil {
+		return 0, nil
+	}
+	if e.kind != kindHash {
+		return 0, ErrWrongType
+	}
+	return int64(len(e.hash)), nil
+}
+
+// HDel 删除哈希字段，字段全部删除后删除key
+func (s *Store) HDel(ctx context.Context, key string, fields ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookup(key, time.Now())
+	if e == nil {
+		return nil
+	}
+	if e.kind != kindHash {
+		return ErrWrongType
+	}
+	for _, field := range fields {
+		delete(e.hash, field)
+	}
+	if len(e.hash) == 0 {
+		s.remove(e)
+	}
+	return nil
+}
+
+// Publish 把值编码为JSON后发送给本进程内的订阅者，订阅者处理不过来时丢弃
+func (s *Store) Publish(ctx context.Context, channel string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	for ch := range s.subscribers[channel] {
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe 订阅频道并对每条消息调用handler，直到ctx取消
+func (s *Store) Subscribe(ctx context.Context, channel string, handler func(payload []byte)) error {
+	ch := make(chan []byte, 16)
+	s.subMu.Lock()
+	if s.subscribers[channel] == nil {
+		s.subscribers[channel] = make(map[chan []byte]struct{})
+	}
+	s.subscribers[channel][ch] = struct{}{}
+	s.subMu.Unlock()
+	defer func() {
+		s.subMu.Lock()
+		delete(s.subscribers[channel], ch)
+		s.subMu.Unlock()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case payload := <-ch:
+			handler(payload)
+		}
+	}
+}
+
+// Close 清空存储
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(map[string]*entry)
+	s.lru.Init()
+	return nil
+}
+
+// Match 按Redis的glob规则匹配key，支持 *、? 和 \ 转义
+func Match(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if Match(pattern, key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if key == "" {
+				return false
+			}
+			_, size := firstRune(key)
+			pattern, key = pattern[1:], key[size:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if key == "" || key[0] != pattern[0] {
+				return false
+			}
+			pattern, key = pattern[1:], key[1:]
+		}
+	}
+	return key == ""
+}
+
+func firstRune(s string) (rune, int) {
+	for _, r := range s {
+		return r, len(string(r))
+	}
+	return 0, 0
+}
@@ -3,6 +3,7 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -47,6 +48,25 @@ func (c *Client) Set(ctx context.Context, key string, value interface{}, expirat
 	return c.rdb.Set(ctx, key, data, expiration).Err()
 }
 
+// SetNX 仅在key不存在时设置原始字符串值，用于分布式锁
+func (c *Client) SetNX(ctx context.Context, key, value string, expiration time.Duration) (bool, error) {
+	return c.rdb.SetNX(ctx, key, value, expiration).Result()
+}
+
+// delIfValueScript 值相等时才删除，用于只释放自己持有的锁
+var delIfValueScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// DelIfValue 仅在key的原始值等于value时删除
+func (c *Client) DelIfValue(ctx context.Context, key, value string) (bool, error) {
+	n, err := delIfValueScript.Run(ctx, c.rdb, []string{key}, value).Int64()
+	return n > 0, err
+}
+
 // Get 获取缓存
 func (c *Client) Get(ctx context.Context, key string, value interface{}) error {
 	data, err := c.rdb.Get(ctx, key).Bytes()
@@ -56,9 +76,34 @@ func (c *Client) Get(ctx context.Context, key string, value interface{}) error {
 	return json.Unmarshal(data, value)
 }
 
+// IsNotFound 判断Get的错误是否为key不存在
+func IsNotFound(err error) bool {
+	return errors.Is(err, redis.Nil)
+}
+
 // Del 删除缓存
-func (c *Client) Del(ctx context.Context, key string) error {
-	return c.rdb.Del(ctx, key).Err()
+func (c *Client) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return c.rdb.Del(ctx, keys...).Err()
+}
+
+// Scan 使用SCAN遍历匹配pattern的所有key，避免KEYS阻塞Redis
+func (c *Client) Scan(ctx context.Context, pattern string, count int64) ([]string, error) {
+	var keys []string
+	var cursor uint64
+	for {
+		batch, next, err := c.rdb.Scan(ctx, cursor, pattern, count).Result()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+		cursor = next
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
 }
 
 // Exists 检查key是否存在
@@ -67,6 +112,110 @@ func (c *Client) Exists(ctx context.Context, key string) (bool, error) {
 	return result > 0, err
 }
 
+// LPush 把值编码为JSON后插入列表头部，并只保留最新的maxLen条
+func (c *Client) LPush(ctx context.Context, key string, value interface{}, maxLen int64) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	pipe := c.rdb.TxPipeline()
+	pipe.LPush(ctx, key, data)
+	if maxLen > 0 {
+		pipe.LTrim(ctx, key, 0, maxLen-1)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// LRange 读取列表中[start, stop]范围的原始JSON
+func (c *Client) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return c.rdb.LRange(ctx, key, start, stop).Result()
+}
+
+// HSet 设置哈希字段，expiration大于0时刷新整个哈希的过期时间
+func (c *Client) HSet(ctx context.Context, key, field, value string, expiration time.Duration) error {
+	pipe := c.rdb.TxPipeline()
+	pipe.HSet(ctx, key, field, value)
+	if expiration > 0 {
+		pipe.Expire(ctx, key, expiration)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// HGetAll 读取哈希的全部字段，key不存在时返回空map
+func (c *Client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return c.rdb.HGetAll(ctx, key).Result()
+}
+
+// HGet 读取哈希字段的原始值，字段不存在时返回的错误满足 IsNotFound
+func (c *Client) HGet(ctx context.Context, key, field string) (string, error) {
+	return c.rdb.HGet(ctx, key, field).Result()
+}
+
+// HIncrBy 原子地增加哈希字段的整数值并返回新值，字段不存在时从0开始
+func (c *Client) HIncrBy(ctx context.Context, key, field string, incr int64) (int64, error) {
+	return c.rdb.HIncrBy(ctx, key, field, incr).Result()
+}
+
+// HLen 返回哈希的字段数
+func (c *Client) HLen(ctx context.Context, key string) (int64, error) {
+	return c.rdb.HLen(ctx, key).Result()
+}
+
+// HDel 删除哈希字段
+func (c *Client) HDel(ctx context.Context, key string, fields ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return c.rdb.HDel(ctx, key, fields...).Err()
+}
+
+// Publish 把值编码为JSON后发布到频道
+func (c *Client) Publish(ctx context.Context, channel string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.rdb.Publish(ctx, channel, data).Err()
+}
+
+// Subscribe 订阅频道并对每条消息调用handler，直到ctx取消
+func (c *Client) Subscribe(ctx context.Context, channel string, handler func(payload []byte)) error {
+	pubsub := c.rdb.Subscribe(ctx, channel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			handler([]byte(msg.Payload))
+		}
+	}
+}
+
+// Script Lua脚本，执行时优先使用EVALSHA，脚本未加载时自动回退为EVAL
+type Script struct {
+	script *redis.Script
+}
+
+// NewScript 创建Lua脚本
+func NewScript(src string) *Script {
+	return &Script{script: redis.NewScript(src)}
+}
+
+// RunScript 原子地执行脚本，脚本必须返回整数数组
+func (c *Client) RunScript(ctx context.Context, script *Script, keys []string, args ...interface{}) ([]int64, error) {
+	return script.script.Run(ctx, c.rdb, keys, args...).Int64Slice()
+}
+
 // Close 关闭连接
 func (c *Client) Close() error {
 	return c.rdb.Close()
@@ -0,0 +1,14 @@
+#!/bin/bash
+
+# 使用回答样本集检查LLM回答的JSON修复效果
+# 线上出现 "invalid JSON format in answer" 时，把原始answer追加到样本集后重新运行
+CORPUS=${1:-"testdata/answer_corpus.jsonl"}
+
+echo "正在检查回答样本集: ${CORPUS}"
+
+if go run ./cmd/answercheck "$CORPUS"; then
+    echo "✅ 所有样本修复成功"
+else
+    echo "❌ 存在修复失败的样本"
+    exit 1
+fi
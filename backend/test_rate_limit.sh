@@ -0,0 +1,14 @@
+#!/bin/bash
+
+# 回归限流算法：令牌桶的突发与补充、滑动窗口的边界、并发请求不超过配额，以及策略的适用范围（如同一IP后的多个用户）
+# 并发样本默认使用进程内计数，用 -redis 127.0.0.1:6379 在Redis脚本上执行
+CORPUS=${1:-"testdata/rate_limit_corpus.jsonl"}
+
+echo "正在检查限流样本集: ${CORPUS}"
+
+if go run ./cmd/ratelimitcheck "${@:2}" "$CORPUS"; then
+    echo "✅ 所有样本符合预期"
+else
+    echo "❌ 存在不符合预期的样本"
+    exit 1
+fi
@@ -0,0 +1,14 @@
+#!/bin/bash
+
+# 回归舵机安全限位：角度夹紧与拒绝、按角速度延长运行时间、禁止姿态
+# 修改型号的 safety 配置后重新运行；自定义型号文件用 -profiles 指定
+CORPUS=${1:-"testdata/safety_corpus.jsonl"}
+
+echo "正在检查安全限位样本集: ${CORPUS}"
+
+if go run ./cmd/safetycheck "${@:2}" "$CORPUS"; then
+    echo "✅ 所有样本符合预期"
+else
+    echo "❌ 存在不符合预期的样本"
+    exit 1
+fi
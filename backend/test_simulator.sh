@@ -0,0 +1,14 @@
+#!/bin/bash
+
+# 在模拟器上回归动作序列，检查是否出现执行器冲突、转速超限等真机上无法完成的情况
+# 调整提示词或宏之后，把有代表性的functions追加到样本集后重新运行；加 -trace 查看状态轨迹
+CORPUS=${1:-"testdata/simulator_corpus.jsonl"}
+
+echo "正在模拟动作样本集: ${CORPUS}"
+
+if go run ./cmd/simulate "${@:2}" "$CORPUS"; then
+    echo "✅ 所有样本符合预期"
+else
+    echo "❌ 存在不符合预期的样本"
+    exit 1
+fi
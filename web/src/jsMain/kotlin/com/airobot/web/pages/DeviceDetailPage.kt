@@ -21,6 +21,7 @@ import mui.material.Grid
 import mui.material.IconButton
 import mui.material.LinearProgress
 import mui.material.Paper
+import mui.material.TextField
 import mui.material.Typography
 import mui.material.styles.TypographyVariant
 import mui.system.Box
@@ -30,6 +31,7 @@ import react.FC
 import react.Props
 import react.ReactNode
 import react.create
+import react.dom.html.ReactHTML.img
 import react.router.useNavigate
 import react.router.useParams
 import react.useState
@@ -38,6 +40,7 @@ import web.cssom.Color
 import web.cssom.Display
 import web.cssom.JustifyContent
 import web.cssom.Margin
+import web.cssom.Overflow
 import web.cssom.px
 import web.cssom.rgb
 
@@ -59,6 +62,10 @@ val DeviceDetailPage = FC<Props> {
     // 控制状态
     var isControlling by useState(false)
 
+    // 动作预览
+    var previewQuery by useState("")
+    var previewUrl by useState<String?>(null)
+
     Box {
         sx {
             padding = 24.px
@@ -287,6 +294,60 @@ val DeviceDetailPage = FC<Props> {
                     }
                 }
             }
+            // 动作预览：由后端生成回答并绘制执行时间线
+            Card {
+                sx {
+                    marginTop = 24.px
+                }
+
+                CardContent {
+                    Typography {
+                        variant = TypographyVariant.h6
+                        sx {
+                            marginBottom = 16.px
+                        }
+                        +"动作预览"
+                    }
+
+                    Box {
+                        sx {
+                            display = Display.flex
+                            alignItems = AlignItems.center
+                            marginBottom = 16.px
+                        }
+
+                        TextField {
+                            label = ReactNode("输入对机器人说的话")
+                            value = previewQuery
+                            fullWidth = true
+                            onChange = { event -> previewQuery = event.target.asDynamic().value as String }
+                        }
+
+                        Button {
+                            variant = ButtonVariant.contained
+                            sx {
+                                marginLeft = 16.px
+                            }
+                            disabled = previewQuery.isBlank()
+                            onClick = { previewUrl = timelinePreviewUrl(previewQuery) }
+                            +"预览"
+                        }
+                    }
+
+                    previewUrl?.let { url ->
+                        Box {
+                            sx {
+                                overflowX = Overflow.auto
+                            }
+
+                            img {
+                                src = url
+                                alt = "动作时间线"
+                            }
+                        }
+                    }
+                }
+            }
         } else {
             // 设备不存在提示
             Paper {
@@ -319,6 +380,14 @@ val DeviceDetailPage = FC<Props> {
     }
 }
 
+// 时间线预览接口，返回SVG甘特图；页面中的设备尚未绑定后端的设备ID，按通用型号预览
+private const val TIMELINE_PREVIEW_PATH = "/timeline/preview"
+
+private fun timelinePreviewUrl(query: String): String =
+    "$TIMELINE_PREVIEW_PATH?format=svg&query=${encodeURIComponent(query)}"
+
+private fun encodeURIComponent(text: String): String = js("encodeURIComponent(text)") as String
+
 // 辅助函数，将Double转为FlexGrow
 private fun number(value: Double): web.cssom.FlexGrow {
     return jso<web.cssom.FlexGrow> { this.asDynamic().valueOf = { value } }